@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"amorenoz/ovs-flowmon/pkg/netflow"
+	"amorenoz/ovs-flowmon/pkg/ovn"
+	"amorenoz/ovs-flowmon/pkg/view"
+	"fmt"
+	"strconv"
+
+	"github.com/rivo/tview"
+	"github.com/spf13/cobra"
+)
+
+var ovnACLSamplingCmd = &cobra.Command{
+	Use:   "acl-sampling",
+	Short: "Configure and visualize OVN per-ACL sampling (experimental)",
+	Long: `In this mode ovs-flowmon connects to a OVN NB database and configures sampling of the selected ACLs
+using the Sample and Sample_Collector tables (requires a recent OVN version). Both allowed and dropped traffic is sampled
+and each flow is attributed to the ACL that generated it.`,
+	Run: runACLSampling,
+}
+
+func runACLSampling(cmd *cobra.Command, args []string) {
+	app := view.NewApp(log)
+	app.FlowTable().SetChassis(true).SetACLSampling(true).SetTunnels(true)
+	ovnAddOVSInstances(cmd, app)
+	ovnSetExtraMenu(app, false, true)
+
+	nb, err := cmd.Flags().GetString("nbdb")
+	if err != nil {
+		log.Fatal(err)
+	}
+	selector := &ovn.ACLSelector{}
+	if selector.PortGroups, err = cmd.Flags().GetStringArray("port-group"); err != nil {
+		log.Fatal(err)
+	}
+	if selector.Names, err = cmd.Flags().GetStringArray("acl-name"); err != nil {
+		log.Fatal(err)
+	}
+	if selector.Tiers, err = cmd.Flags().GetIntSlice("tier"); err != nil {
+		log.Fatal(err)
+	}
+	all, err := cmd.Flags().GetBool("all")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if selector.Empty() && !all {
+		log.Fatal("Select the ACLs to sample with --port-group, --acl-name or --tier, or sample all of them with --all")
+	}
+	if !selector.Empty() && all {
+		log.Fatal("--all cannot be used along with --port-group, --acl-name or --tier")
+	}
+	probability, err := cmd.Flags().GetInt("probability")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sampler, err := ovn.NewACLSampler(nb, &tlsOpts, log)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := sampler.Start(); err != nil {
+		log.Fatal(err)
+	}
+	for _, instance := range ovsInstances {
+		ovnOvsStart(instance)
+	}
+	used, err := sampler.CollectorSetIDs()
+	if err != nil {
+		log.Fatal(err)
+	}
+	collectorSet := collectorSetID(cmd, used)
+	// Registered before configuring sampling so that the configuration is also removed if
+	// a fatal error or a signal stops us from here on.
+	app.OnExit(func() {
+		if err := sampler.Close(); err != nil {
+			log.Error(err)
+		}
+	})
+	if err := sampler.Configure(selector, probability, collectorSet); err != nil {
+		log.Fatal(err)
+	}
+	aclAddConfigPage(app, sampler, probability)
+	target, err := ipfixTargetHint()
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.WelcomePage(fmt.Sprintf(`OVN ACL sampling mode. Sampling has been enabled on the selected ACLs.
+However, IPFIX configuration needs to be added to each chassis that you want to sample. To do that, run the following command on them:
+
+ovs-vsctl --id=@br get Bridge br-int --
+	  --id=@i create IPFIX targets=\"%s\"
+	  --  create Flow_Sample_Collector_Set bridge=@br id=%d ipfix=@i
+`, target, collectorSet))
+
+	enrichers := append(ovsEnrichers(), sampler)
+	k8s, err := cmd.Flags().GetBool("k8s")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if k8s {
+		pods, err := ovn.NewPodEnricher(nb, &tlsOpts, log)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := pods.Start(); err != nil {
+			log.Fatal(err)
+		}
+		app.FlowTable().SetPods(true)
+		enrichers = append(enrichers, pods)
+	}
+
+	listen, err := listenAddress()
+	if err != nil {
+		log.Fatal(err)
+	}
+	nf, err := netflow.NewNFReader(1,
+		"netflow://"+listen,
+		&view.FlowConsumer{FlowTable: app.FlowTable(), App: app.App()},
+		enrichers,
+		log)
+	if err != nil {
+		log.Fatal(err)
+	}
+	setIPFIXMapping(app, nf, true)
+	go nf.Listen()
+
+	for _, instance := range ovsInstances {
+		ovnOvsConfig(instance, collectorSet)
+	}
+
+	if err := app.Run(); err != nil {
+		panic(err)
+	}
+}
+
+// ACLConfigPage is the OVN ACL sampling configuration page.
+const ACLConfigPage view.PageName = "aclconfig"
+
+func aclAddConfigPage(app *view.App, sampler *ovn.ACLSampler, probability int) {
+	form := tview.NewForm()
+	form.AddInputField("Probability", strconv.Itoa(probability), 6, func(textToCheck string, _ rune) bool {
+		_, err := strconv.ParseInt(textToCheck, 0, 32)
+		return err == nil
+	}, func(text string) {
+		intVal, err := strconv.ParseInt(text, 0, 32)
+		if err == nil {
+			probability = int(intVal)
+		}
+	}).
+		AddButton("Save", func() {
+			if err := sampler.SetProbability(probability); err != nil {
+				log.Error(err)
+			}
+			app.ShowPage(view.MainPage)
+		}).
+		AddButton("Cancel", func() {
+			app.ShowPage(view.MainPage)
+		})
+	configMenu := tview.NewFlex()
+	configMenu.SetTitle("OVN ACL Sampling Configuration").SetBorder(true)
+	configMenu.SetDirection(tview.FlexRow).AddItem(tview.NewTextView().SetText(fmt.Sprintf(`Configure the probability the selected ACLs are sampled with
+in units of 1/%d (%d samples every packet)
+
+Use <Tab> to move around the form
+Press <Save> to save the configuration
+Press <Cancel> to go back to the main menu
+`, ovn.MaxACLSampleProbability, ovn.MaxACLSampleProbability)), 0, 1, false).
+		AddItem(form, 0, 2, true)
+	app.AddPage(ACLConfigPage, view.Center(configMenu, 60, 20), true, false)
+}
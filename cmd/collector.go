@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"amorenoz/ovs-flowmon/pkg/flowmon"
+	"amorenoz/ovs-flowmon/pkg/netflow"
+	"amorenoz/ovs-flowmon/pkg/view"
+
+	"github.com/spf13/cobra"
+)
+
+// DefaultCollectorPort is the default UDP port the IPFIX collector listens on.
+const DefaultCollectorPort = "2055"
+
+// addCollectorFlags adds the flags that control the collector's listen and advertised
+// addresses.
+func addCollectorFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&listenAddr, "listen", ":"+DefaultCollectorPort,
+		"Address ([ip]:port) the IPFIX collector listens on. IPv6 addresses must be enclosed in square brackets")
+	cmd.Flags().StringVar(&advertiseAddr, "advertise", "",
+		"IP address (ip[:port]) OVS is told to export IPFIX to. Default: the local address used to reach the OVSDB server and the listen port")
+}
+
+// splitAddress splits an address in host and port. The port is optional, in which case
+// defPort is returned. IPv6 addresses must be enclosed in square brackets if a port is given.
+func splitAddress(addr, defPort string) (string, string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		// No port.
+		host = addr
+		if len(host) > 1 && host[0] == '[' && host[len(host)-1] == ']' {
+			host = host[1 : len(host)-1]
+		}
+		port = defPort
+	}
+	// Both goflow2 and OVS IPFIX targets require IP addresses.
+	if host != "" && net.ParseIP(host) == nil {
+		return "", "", fmt.Errorf("Invalid address %q: host must be an IP address", addr)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", "", fmt.Errorf("Invalid port in address %q", addr)
+	}
+	return host, port, nil
+}
+
+// listenAddress returns the normalized address the collector must listen on.
+func listenAddress() (string, error) {
+	host, port, err := splitAddress(listenAddr, DefaultCollectorPort)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// advertiseAddress returns the IPFIX target OVS must export flows to. If not explicitly
+// configured, it is derived from the OVSDB target and the listen port.
+func advertiseAddress(ovsdb string) (string, error) {
+	_, listenPort, err := splitAddress(listenAddr, DefaultCollectorPort)
+	if err != nil {
+		return "", err
+	}
+	if advertiseAddr != "" {
+		host, port, err := splitAddress(advertiseAddr, listenPort)
+		if err != nil {
+			return "", err
+		}
+		if host == "" {
+			return "", fmt.Errorf("Invalid advertise address %q: missing host", advertiseAddr)
+		}
+		return net.JoinHostPort(host, port), nil
+	}
+	ipAddr, err := ipAddressFromOvsdb(ovsdb)
+	if err != nil {
+		return "", fmt.Errorf("Bad OvS target %s", err.Error())
+	}
+	return net.JoinHostPort(ipAddr, listenPort), nil
+}
+
+// ipfixTargetHint returns the IPFIX target exporters configured by hand must send flows
+// to. The advertised address or the listen address are used if they are known, otherwise
+// the host is left as a ${HOST_IP} placeholder.
+func ipfixTargetHint() (string, error) {
+	listenHost, port, err := splitAddress(listenAddr, DefaultCollectorPort)
+	if err != nil {
+		return "", err
+	}
+	host := ""
+	if advertiseAddr != "" {
+		if host, port, err = splitAddress(advertiseAddr, port); err != nil {
+			return "", err
+		}
+	} else if ip := net.ParseIP(listenHost); ip != nil && !ip.IsUnspecified() {
+		host = listenHost
+	}
+	if host == "" {
+		return "${HOST_IP}:" + port, nil
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// setIPFIXMapping loads the --ipfix-mapping file (if given), adds its fields to the flow
+// table and makes the reader decode them. needOVS is whether the mode relies on the OVS
+// elements, in which case the mapping cannot disable them.
+func setIPFIXMapping(app *view.App, nf *netflow.NFReader, needOVS bool) {
+	if mappingFile == "" {
+		return
+	}
+	mapping, err := flowmon.LoadMapping(mappingFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if needOVS && !mapping.DecodesOVS() {
+		log.Fatalf("Invalid IPFIX mapping %s: the OVS elements can only be disabled in listen mode", mappingFile)
+	}
+	app.FlowTable().SetCustomFields(mapping.Names())
+	nf.SetMapping(mapping)
+}
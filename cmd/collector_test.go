@@ -0,0 +1,37 @@
+package cmd
+
+import "testing"
+
+func TestIPFIXTargetHint(t *testing.T) {
+	tests := []struct {
+		name      string
+		listen    string
+		advertise string
+		target    string
+		ok        bool
+	}{
+		{name: "default", listen: ":" + DefaultCollectorPort, target: "${HOST_IP}:2055", ok: true},
+		{name: "listen port", listen: ":4739", target: "${HOST_IP}:4739", ok: true},
+		{name: "unspecified listen address", listen: "[::]:4739", target: "${HOST_IP}:4739", ok: true},
+		{name: "listen address", listen: "10.0.0.5:4739", target: "10.0.0.5:4739", ok: true},
+		{name: "advertise without port", listen: ":4739", advertise: "fd00::10", target: "[fd00::10]:4739", ok: true},
+		{name: "advertise with port", listen: "10.0.0.5:2055", advertise: "192.168.1.1:9995", target: "192.168.1.1:9995", ok: true},
+		{name: "invalid listen address", listen: "localhost:2055"},
+		{name: "invalid advertise address", listen: ":2055", advertise: "collector.example.com"},
+	}
+	defer func(listen, advertise string) {
+		listenAddr, advertiseAddr = listen, advertise
+	}(listenAddr, advertiseAddr)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listenAddr, advertiseAddr = tt.listen, tt.advertise
+			target, err := ipfixTargetHint()
+			if (err == nil) != tt.ok {
+				t.Fatalf("ipfixTargetHint() error = %v, want ok %v", err, tt.ok)
+			}
+			if target != tt.target {
+				t.Errorf("ipfixTargetHint() = %s, want %s", target, tt.target)
+			}
+		})
+	}
+}
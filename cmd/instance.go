@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"amorenoz/ovs-flowmon/pkg/endpoint"
+	"amorenoz/ovs-flowmon/pkg/flowmon"
+	"amorenoz/ovs-flowmon/pkg/netflow"
+	"amorenoz/ovs-flowmon/pkg/ovs"
+	"amorenoz/ovs-flowmon/pkg/stats"
+	"amorenoz/ovs-flowmon/pkg/unixctl"
+	"amorenoz/ovs-flowmon/pkg/view"
+
+	flowmessage "github.com/netsampler/goflow2/pb"
+	"github.com/sirupsen/logrus"
+)
+
+// ovsInstance is one of the monitored OVS instances.
+type ovsInstance struct {
+	// target is the OVSDB target (see "Connection Methods" in man(7) ovsdb).
+	target string
+	// ipfixTarget is the address this instance must export IPFIX to.
+	ipfixTarget string
+	// chassis is the name used to label flows exported by this instance.
+	chassis string
+	client  *ovs.OVSClient
+}
+
+// newOVSInstances creates an ovsInstance for each of the given OVSDB targets.
+func newOVSInstances(targets []string, statsBackend stats.StatsBackend) ([]*ovsInstance, error) {
+	instances := []*ovsInstance{}
+	for _, target := range targets {
+		ipfixTarget, err := advertiseAddress(target)
+		if err != nil {
+			return nil, err
+		}
+		client, err := ovs.NewOVSClient(target, &tlsOpts, statsBackend, log)
+		if err != nil {
+			return nil, err
+		}
+		if appctl := vswitchdAppCtl(target); appctl != nil {
+			client.SetAppCtl(appctl)
+		}
+		instances = append(instances, &ovsInstance{
+			target:      target,
+			ipfixTarget: ipfixTarget,
+			chassis:     target,
+			client:      client,
+		})
+	}
+	return instances, nil
+}
+
+// vswitchdAppCtl returns the unixctl client of the ovs-vswitchd daemon managed by the
+// OVSDB target. This is only possible if the target is local (unix). The run directory
+// is the one containing the OVSDB socket unless OVS_RUNDIR is set.
+func vswitchdAppCtl(target string) *unixctl.Client {
+	endpoints, err := endpoint.ParseList(target)
+	if err != nil || len(endpoints) != 1 || endpoints[0].IsRemote() {
+		return nil
+	}
+	rundir := os.Getenv("OVS_RUNDIR")
+	if rundir == "" {
+		rundir = filepath.Dir(endpoints[0].Path)
+	}
+	appctl, err := unixctl.NewDaemonClient(rundir, "ovs-vswitchd")
+	if err != nil {
+		log.Warningf("ovs-vswitchd control socket not available, datapath statistics disabled: %s", err.Error())
+		return nil
+	}
+	return appctl
+}
+
+// start connects to the instance's OVSDB server, enables statistics and registers the
+// instance's exporter addresses in the chassisEnricher. If named is true, statistics are
+// labeled with the chassis name.
+func (i *ovsInstance) start(named bool) error {
+	if i.client.Started() {
+		return nil
+	}
+	if err := i.client.Start(); err != nil {
+		return err
+	}
+	if systemID, err := i.client.SystemID(); err != nil {
+		log.Warningf("Cannot determine chassis name of %s: %s", i.target, err.Error())
+	} else {
+		i.chassis = systemID
+	}
+	for _, addr := range i.exporterAddresses() {
+		chassisEnricher.AddExporter(addr, i.chassis)
+	}
+	if named {
+		i.client.SetName(i.chassis)
+	}
+	if err := i.client.EnableStatistics(); err != nil {
+		return err
+	}
+	if interfaceStats != nil {
+		return i.client.EnableInterfaceStatistics(interfaceStats)
+	}
+	return nil
+}
+
+// InterfacesPage is the per-interface statistics page.
+const InterfacesPage view.PageName = "interfaces"
+
+// addInterfacesPage adds the per-interface statistics page to the application.
+func addInterfacesPage(app *view.App) {
+	interfaceStats = stats.NewInterfaceStatsView(app.App())
+	interfaceStats.SetDoneFunc(func() {
+		app.ShowPage(view.MainPage)
+	})
+	app.AddPage(InterfacesPage, interfaceStats.View(), true, false)
+}
+
+// exporterAddresses returns the addresses IPFIX messages from this instance are
+// expected to be sent from.
+func (i *ovsInstance) exporterAddresses() []net.IP {
+	addrs := []net.IP{}
+	endpoints, err := endpoint.ParseList(i.target)
+	if err != nil {
+		return addrs
+	}
+	for _, ep := range endpoints {
+		if !ep.IsRemote() {
+			// Local instance: it exports from the advertised address or the loopback.
+			if host, _, err := net.SplitHostPort(i.ipfixTarget); err == nil {
+				if ip := net.ParseIP(host); ip != nil {
+					addrs = append(addrs, ip)
+				}
+			}
+			addrs = append(addrs, net.IPv4(127, 0, 0, 1), net.IPv6loopback)
+			continue
+		}
+		if ip := net.ParseIP(ep.Host); ip != nil {
+			addrs = append(addrs, ip)
+		} else if ips, err := net.LookupIP(ep.Host); err == nil {
+			addrs = append(addrs, ips...)
+		}
+	}
+	return addrs
+}
+
+// Enrich implements netflow.Enricher. If several instances are monitored, only the flows
+// exported by this instance's chassis are enriched. Requires the chassisEnricher to run first.
+func (i *ovsInstance) Enrich(msg *flowmessage.FlowMessage, extra map[string]interface{}, log *logrus.Logger) map[string]interface{} {
+	if len(ovsInstances) > 1 && extra["Chassis"] != i.chassis {
+		return extra
+	}
+	return i.client.Enrich(msg, extra, log)
+}
+
+// ovsEnrichers returns the enrichers of all the monitored OVS instances, starting with the
+// chassisEnricher.
+func ovsEnrichers() []netflow.Enricher {
+	enrichers := []netflow.Enricher{chassisEnricher}
+	for _, instance := range ovsInstances {
+		enrichers = append(enrichers, instance)
+	}
+	return enrichers
+}
+
+// instanceForAggregate returns the instance that exported the flows of the aggregate.
+func instanceForAggregate(agg *flowmon.FlowAggregate) (*ovsInstance, error) {
+	if len(ovsInstances) == 0 {
+		return nil, fmt.Errorf("No OVS instance configured")
+	}
+	if len(ovsInstances) == 1 {
+		return ovsInstances[0], nil
+	}
+	chassis, err := agg.GetFieldString("Chassis")
+	if err != nil {
+		return nil, err
+	}
+	for _, instance := range ovsInstances {
+		if instance.chassis == chassis {
+			return instance, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown chassis %q. Add Chassis to the aggregate to select the OVS instance", chassis)
+}
+
+// datapathFlowsDetail returns the datapath flows that cover the aggregate's flow key.
+func datapathFlowsDetail(agg *flowmon.FlowAggregate) (string, error) {
+	instance, err := instanceForAggregate(agg)
+	if err != nil {
+		return "", err
+	}
+	if len(agg.Flows) == 0 {
+		return "", fmt.Errorf("Empty Aggregate")
+	}
+	flows, err := instance.client.MatchingDatapathFlows(agg.Flows[0].Key, agg.Keys)
+	if err != nil {
+		return "", err
+	}
+	if len(flows) == 0 {
+		return "  No datapath flow covers this flow: it is either being handled in userspace (upcalls) or the datapath flow has expired", nil
+	}
+	lines := []string{}
+	for _, flow := range flows {
+		lines = append(lines, "  "+flow.String())
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// ofprotoTraceAction runs ofproto/trace on the instance that exported the aggregate's flows.
+func ofprotoTraceAction(agg *flowmon.FlowAggregate) (string, error) {
+	instance, err := instanceForAggregate(agg)
+	if err != nil {
+		return "", err
+	}
+	if len(agg.Flows) == 0 {
+		return "", fmt.Errorf("Empty Aggregate")
+	}
+	return instance.client.OFProtoTrace(agg.Flows[0].Key, agg.Keys)
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"amorenoz/ovs-flowmon/pkg/netflow"
+	"amorenoz/ovs-flowmon/pkg/ovn"
+	"amorenoz/ovs-flowmon/pkg/view"
+
+	"github.com/spf13/cobra"
+)
+
+// addPodFlags adds the flags needed to attribute flows to OVN-Kubernetes pods in modes
+// that do not connect to OVN.
+func addPodFlags(cmd *cobra.Command) {
+	cmd.Flags().String("k8s-nbdb", "", "OVN-Kubernetes NB database connection. If given, flows are attributed to pods, namespaces and nodes")
+}
+
+// podEnrichers returns the enrichers that attribute flows to OVN-Kubernetes pods (if
+// configured) and adds the pod fields to the flow table.
+func podEnrichers(cmd *cobra.Command, app *view.App) []netflow.Enricher {
+	nbdb, err := cmd.Flags().GetString("k8s-nbdb")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if nbdb == "" {
+		return []netflow.Enricher{}
+	}
+	pods, err := ovn.NewPodEnricher(nbdb, &tlsOpts, log)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := pods.Start(); err != nil {
+		log.Fatalf("Failed to connect to OVN-Kubernetes NB database %s: %s", nbdb, err.Error())
+	}
+	app.FlowTable().SetPods(true)
+	return []netflow.Enricher{pods}
+}
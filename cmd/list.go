@@ -3,6 +3,7 @@ package cmd
 import (
 	"amorenoz/ovs-flowmon/pkg/netflow"
 	"amorenoz/ovs-flowmon/pkg/view"
+	"fmt"
 
 	"github.com/spf13/cobra"
 )
@@ -10,34 +11,47 @@ import (
 var listenCmd = &cobra.Command{
 	Use:   "listen [host:port]",
 	Short: "Listen to exisiting IPFIX traffic",
-	Long:  "An IPFIX exporter muxt be configured manually. Default listen address is: *:2055.",
-	Run:   runListen,
-	Args:  cobra.MaximumNArgs(1),
+	Long: `An IPFIX exporter muxt be configured manually. The listen address can be given with --listen
+or as an argument. Default listen address is: *:` + DefaultCollectorPort + ".",
+	Run:  runListen,
+	Args: cobra.MaximumNArgs(1),
 }
 
 func runListen(cmd *cobra.Command, args []string) {
-	ipPort := ":2055"
 	if len(args) == 1 {
-		ipPort = args[0]
+		if cmd.Flags().Changed("listen") {
+			log.Fatal("The listen address cannot be given both with --listen and as an argument")
+		}
+		listenAddr = args[0]
+	}
+	ipPort, err := listenAddress()
+	if err != nil {
+		log.Fatal(err)
+	}
+	target, err := ipfixTargetHint()
+	if err != nil {
+		log.Fatal(err)
 	}
 	app := view.NewApp(log)
-	app.WelcomePage(`In "listen" mode you must manually start an IPFIX exporter to send flows to this host.
+	app.FlowTable().SetTunnels(true)
+	app.WelcomePage(fmt.Sprintf(`In "listen" mode you must manually start an IPFIX exporter to send flows to this host.
 In OpenvSwitch you can run something like:
 "ovs-vsctl -- set Bridge br-int ipfix=@i \
-           -- --id=@i create IPFIX targets=\"${HOST_IP}:2055\"
+           -- --id=@i create IPFIX targets=\"%s\"
 
 Note that if you had already started the IPFIX exporter, it might take some time (e.g: 10mins in OvS) before it sends us the Templates, without which we cannot
-decode the IPFIX Flow Records. It is possible that re-starting the exporter helps.`)
+decode the IPFIX Flow Records. It is possible that re-starting the exporter helps.`, target))
 
 	nf, err := netflow.NewNFReader(1,
 		"netflow://"+ipPort,
 		&view.FlowConsumer{FlowTable: app.FlowTable(), App: app.App()},
-		[]netflow.Enricher{},
+		podEnrichers(cmd, app),
 		log)
 
 	if err != nil {
 		log.Fatal(err)
 	}
+	setIPFIXMapping(app, nf, false)
 	go nf.Listen()
 
 	if err := app.Run(); err != nil {
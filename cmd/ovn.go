@@ -1,11 +1,14 @@
 package cmd
 
 import (
+	"amorenoz/ovs-flowmon/pkg/flowmon"
 	"amorenoz/ovs-flowmon/pkg/netflow"
 	"amorenoz/ovs-flowmon/pkg/ovn"
-	"amorenoz/ovs-flowmon/pkg/ovs"
 	"amorenoz/ovs-flowmon/pkg/view"
+	"fmt"
 
+	"github.com/rivo/tview"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -17,63 +20,123 @@ var ovnCmd = &cobra.Command{
 }
 
 func runOvn(cmd *cobra.Command, args []string) {
-	var ovsClient *ovs.OVSClient = nil
-
 	app := view.NewApp(log)
-	app.FlowTable().SetOVN(true)
-	app.WelcomePage(`OVN mode. Drop sampling has been enabled in the remote OVN cluster.
-However, IPFIX configuration needs to be added to each chassis that you want to sample. To do that, run the following command on them:
-
-ovs-vsctl --id=@br get Bridge br-int --
-	  --id=@i create IPFIX targets=\"${HOST_IP}:2055\"
-	  --  create Flow_Sample_Collector_Set bridge=@br id=1 ipfix=@i
-`)
+	app.FlowTable().SetOVN(true).SetChassis(true).SetTunnels(true)
+	ovnAddOVSInstances(cmd, app)
+	ovnSetExtraMenu(app, true, false)
 
-	ovsdb, err := cmd.Flags().GetString("ovs")
+	nb, err := cmd.Flags().GetString("nbdb")
 	if err != nil {
 		log.Fatal(err)
 	}
-	if ovsdb != "" {
-		log.Infof("Starting OVS client: %s", ovsdb)
-		ovsClient, err = ovs.NewOVSClient(ovsdb, app.Stats(), log)
+	sb, err := cmd.Flags().GetString("sbdb")
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	nb, err := cmd.Flags().GetString("nbdb")
+	ovnClient, err := ovn.NewOVNClient(nb, sb, &tlsOpts, log)
 	if err != nil {
 		log.Fatal(err)
 	}
-	sb, err := cmd.Flags().GetString("sbdb")
+	traceCmd, err := cmd.Flags().GetString("ovn-trace")
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	ovnClient, err := ovn.NewOVNClient(nb, sb, log)
+	ovnClient.SetTraceCommand(traceCmd)
+	app.AddFlowAction("ovn-trace", 'r', func(agg *flowmon.FlowAggregate) (string, error) {
+		if len(agg.Flows) == 0 {
+			return "", fmt.Errorf("Empty Aggregate")
+		}
+		return ovnClient.Trace(agg.Flows[0].Key, agg.Keys)
+	})
+	err = ovnClient.Start()
 	if err != nil {
 		log.Fatal(err)
 	}
-	err = ovnClient.Start()
+	for _, instance := range ovsInstances {
+		ovnOvsStart(instance)
+	}
+	used, err := ovnClient.CollectorSetIDs()
 	if err != nil {
 		log.Fatal(err)
 	}
-	err = ovnClient.SetDebugMode()
+	collectorSet := collectorSetID(cmd, used)
+	usedDomains, err := ovnClient.DomainIDs()
 	if err != nil {
 		log.Fatal(err)
 	}
-	log.Info("OVN Client started")
+	domain := domainID(cmd, usedDomains)
+	leaveEnabled, err := cmd.Flags().GetBool("leave-enabled")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	enrichers := append(ovsEnrichers(), ovnClient)
+	if ovnClient.TunnelEnricher().Enabled() {
+		app.FlowTable().SetTunnelChassis(true)
+		enrichers = append(enrichers, ovnClient.TunnelEnricher())
+	}
+	k8s, err := cmd.Flags().GetBool("k8s")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if k8s {
+		app.FlowTable().SetPods(true)
+		enrichers = append(enrichers, ovnClient.PodEnricher())
+	}
 
-	ipAddr := ""
+	listen, err := listenAddress()
+	if err != nil {
+		log.Fatal(err)
+	}
 	nf, err := netflow.NewNFReader(1,
-		"netflow://"+ipAddr+":2055",
-		&view.FlowConsumer{FlowTable: app.FlowTable(), App: app.App()},
-		[]netflow.Enricher{ovnClient},
+		"netflow://"+listen,
+		&view.FlowConsumer{FlowTable: app.FlowTable(), DropTree: addDropTreePage(app), App: app.App()},
+		enrichers,
 		log)
 	if err != nil {
 		log.Fatal(err)
 	}
+	// Load the mapping before enabling drop sampling since a bad file is fatal.
+	setIPFIXMapping(app, nf, true)
+
+	ovnClient.SetLeaveEnabled(leaveEnabled)
+	ovnClient.OnDebugModeChange(app.Notify)
+	// Registered before enabling drop sampling so that it is also restored if a fatal
+	// error or a signal stops us from here on.
+	app.OnExit(func() {
+		if !leaveEnabled {
+			for _, instance := range ovsInstances {
+				if err := instance.client.ClearFlowSampling(collectorSet); err != nil {
+					log.Error(err)
+				}
+			}
+		}
+		if err := ovnClient.Close(); err != nil {
+			log.Error(err)
+		}
+	})
+	err = ovnClient.SetDebugMode(collectorSet, domain)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Info("OVN Client started")
+	target, err := ipfixTargetHint()
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.WelcomePage(fmt.Sprintf(`OVN mode. Drop sampling has been enabled in the remote OVN cluster.
+However, IPFIX configuration needs to be added to each chassis that you want to sample. To do that, run the following command on them:
+
+ovs-vsctl --id=@br get Bridge br-int --
+	  --id=@i create IPFIX targets=\"%s\"
+	  --  create Flow_Sample_Collector_Set bridge=@br id=%d ipfix=@i
+`, target, collectorSet))
+
 	go nf.Listen()
 
-	if ovsClient != nil {
-		ovnOvsStartAndConfig(ovsClient, ovsdb)
+	for _, instance := range ovsInstances {
+		ovnOvsConfig(instance, collectorSet)
 	}
 
 	if err := app.Run(); err != nil {
@@ -81,28 +144,77 @@ ovs-vsctl --id=@br get Bridge br-int --
 	}
 }
 
-func ovnOvsStart(ovs *ovs.OVSClient) {
-	err := ovs.Start()
+// ovnAddOVSInstances creates the OVS instances given with --ovs (if any) and adds their
+// pages, details and actions to the app.
+func ovnAddOVSInstances(cmd *cobra.Command, app *view.App) {
+	ovsdbs, err := cmd.Flags().GetStringArray("ovs")
 	if err != nil {
-		log.Error("Failed to start Ovs Client")
+		log.Fatal(err)
+	}
+	if len(ovsdbs) == 0 {
 		return
 	}
-	err = ovs.EnableStatistics()
+	log.Infof("Starting OVS clients: %v", ovsdbs)
+	ovsInstances, err = newOVSInstances(ovsdbs, app.Stats())
 	if err != nil {
 		log.Fatal(err)
 	}
+	app.FlowTable().SetInterfaces(true)
+	addInterfacesPage(app)
+	app.AddFlowDetail("Datapath flows", datapathFlowsDetail)
+	app.AddFlowAction("ofproto/trace", 't', ofprotoTraceAction)
 }
 
-func ovnOvsStartAndConfig(ovs *ovs.OVSClient, ovsdb string) {
-	if !ovs.Started() {
-		ovnOvsStart(ovs)
-	}
-	ipAddr, err := ipAddressFromOvsdb(ovsdb)
+// ovnSetExtraMenu adds the interface statistics page (if OVS instances were given) and,
+// depending on the mode, the drop summary or the ACL sampling configuration page to the
+// main menu.
+func ovnSetExtraMenu(app *view.App, dropSampling, aclSampling bool) {
+	app.ExtraMenu(func(menu *tview.List, log *logrus.Logger) error {
+		if dropSampling {
+			menu.AddItem("OVN drop summary", "", 'd', func() {
+				app.ShowPage(view.DropTreePage)
+			})
+		}
+		if aclSampling {
+			menu.AddItem("Configure OVN ACL sampling", "", 'c', func() {
+				app.ShowPage(ACLConfigPage)
+			})
+		}
+		if len(ovsInstances) > 0 {
+			menu.AddItem("Interface statistics", "", 'n', func() {
+				app.ShowPage(InterfacesPage)
+			})
+		}
+		return nil
+	})
+}
+
+// addDropTreePage adds the OVN drop summary page to the application.
+func addDropTreePage(app *view.App) *view.DropTree {
+	dropTree := view.NewDropTree(app.App())
+	dropTree.SetDoneFunc(func() {
+		app.ShowPage(view.MainPage)
+	})
+	app.AddPage(view.DropTreePage, dropTree.View(), true, false)
+	return dropTree
+}
+
+func ovnOvsStart(instance *ovsInstance) {
+	err := instance.start(len(ovsInstances) > 1)
 	if err != nil {
-		log.Fatalf("Bad OvS target %s", err.Error())
+		log.Errorf("Failed to start Ovs Client %s: %s", instance.target, err.Error())
+	}
+}
+
+// ovnOvsConfig makes a started OVS instance send the samples of the given
+// Flow_Sample_Collector_Set to us.
+func ovnOvsConfig(instance *ovsInstance, collectorSetID int) {
+	if !instance.client.Started() {
+		return
 	}
-	err = ovs.SetFlowSampling(ipAddr + ":2055")
+	err := instance.client.SetFlowSampling(instance.ipfixTarget, collectorSetID)
 	if err != nil {
-		log.Fatalf("Failed to configure OVS Flow sampling: %s", err.Error())
+		// Not fatal so that the exit hooks restore the configuration done so far.
+		log.Errorf("Failed to configure OVS Flow sampling on %s: %s", instance.chassis, err.Error())
 	}
 }
@@ -7,7 +7,9 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	"amorenoz/ovs-flowmon/pkg/endpoint"
 	"amorenoz/ovs-flowmon/pkg/netflow"
 	"amorenoz/ovs-flowmon/pkg/ovs"
 	"amorenoz/ovs-flowmon/pkg/view"
@@ -18,54 +20,48 @@ import (
 )
 
 var ovsCmd = &cobra.Command{
-	Use:   "ovs [target]",
+	Use:   "ovs [target...]",
 	Short: "Configure a local or remote ovs-vswitchd",
 	Long: `Configure per-bridge IPFIX sampling on a local or remote ovs-vswitchd daemon. This mode allows you to also visualize life OvS statistics.
-The target must be specified in "Connection Methods" (man(7) ovsdb). Default is: unix:/var/run/openvswitch/db.sock`,
+The target must be specified in "Connection Methods" (man(7) ovsdb), e.g: tcp:[fd00::5]:6640 or ssl:10.0.0.1:6640.
+A comma-separated list of targets is also accepted. Default is: unix:/var/run/openvswitch/db.sock
+Several targets can be given to monitor multiple OVS instances at once. Flows are then labeled with the originating chassis.`,
 	Run:  runOvs,
-	Args: cobra.MaximumNArgs(1),
+	Args: cobra.ArbitraryArgs,
 }
 
 // ConfigPage is the OVS configuration page.
 const ConfigPage view.PageName = "config"
 
 func ovsStart(bridge string, sampling, cacheMax, cacheTimeout int) {
-	if ovsdb == "" {
+	if len(ovsInstances) == 0 {
 		log.Error("OVSDB not configured")
 		return
 	}
-	if !ovsClient.Started() {
-		err := ovsClient.Start()
+	for _, instance := range ovsInstances {
+		err := instance.start(len(ovsInstances) > 1)
 		if err != nil {
-			log.Error("Failed to start Ovs Client")
-			return
+			log.Errorf("Failed to start Ovs Client %s: %s", instance.target, err.Error())
+			continue
 		}
-		err = ovsClient.EnableStatistics()
+		err = instance.client.SetIPFIX(bridge, instance.ipfixTarget, sampling, cacheMax, cacheTimeout)
 		if err != nil {
-			log.Fatal(err)
+			log.Errorf("Failed to set OVS configuration on %s", instance.chassis)
+			log.Error(err)
+		} else {
+			log.Infof("OVS configuration changed on %s", instance.chassis)
 		}
 	}
-	ipAddr, err := ipAddressFromOvsdb(ovsdb)
-	if err != nil {
-		log.Fatalf("Bad OvS target %s", err.Error())
-	}
-	err = ovsClient.SetIPFIX(bridge, ipAddr+":2055", sampling, cacheMax, cacheTimeout)
-	if err != nil {
-		log.Error("Failed to set OVS configuration")
-		log.Error(err)
-	} else {
-		log.Info("OVS configuration changed")
-	}
 }
 
 func ovsStop() {
-	if ovsClient != nil {
-		log.Info("Stopping IPFIX exporter")
-		err := ovsClient.ClearIPFIX()
+	for _, instance := range ovsInstances {
+		log.Infof("Stopping IPFIX exporter on %s", instance.chassis)
+		err := instance.client.ClearIPFIX()
 		if err != nil {
 			log.Error(err)
 		}
-		err = ovsClient.Close()
+		err = instance.client.Close()
 		if err != nil {
 			log.Error(err)
 		}
@@ -73,15 +69,9 @@ func ovsStop() {
 }
 
 func ovsAddConfigPage(app *view.App) {
-	var err error
-	if ovsdb == "" {
+	if len(ovsInstances) == 0 {
 		return
 	}
-	// Initialize OVS Configuration client
-	ovsClient, err = ovs.NewOVSClient(ovsdb, app.Stats(), log)
-	if err != nil {
-		log.Fatal(err)
-	}
 
 	sampling := 400
 	bridge := "br-int"
@@ -121,17 +111,22 @@ Press <Cancel> to go back to the main menu
 }
 
 func runOvs(cmd *cobra.Command, args []string) {
-	if len(args) == 1 {
-		ovsdb = args[0]
-	} else {
-		ovsdb = "unix:/var/run/openvswitch/db.sock"
+	targets := args
+	if len(targets) == 0 {
+		targets = []string{"unix:/var/run/openvswitch/db.sock"}
 	}
-	ipAddr, err := ipAddressFromOvsdb(ovsdb)
+	listen, err := listenAddress()
 	if err != nil {
-		log.Fatalf("Bad OvS target %s", err.Error())
+		log.Fatal(err)
 	}
 
 	app := view.NewApp(log)
+	// Initialize OVS Configuration clients
+	ovsInstances, err = newOVSInstances(targets, app.Stats())
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.FlowTable().SetChassis(len(ovsInstances) > 1).SetInterfaces(true).SetTunnels(true)
 	app.OnExit(ovsStop)
 	app.ExtraMenu(func(menu *tview.List, log *logrus.Logger) error {
 		menu.AddItem("Start OvS IPFIX Exporter", "", 's', func() {
@@ -144,20 +139,27 @@ func runOvs(cmd *cobra.Command, args []string) {
 		menu.AddItem("Stop OvS IPFIX Exporter", "", 't', func() {
 			ovsStop()
 		})
+		menu.AddItem("Interface statistics", "", 'n', func() {
+			app.ShowPage(InterfacesPage)
+		})
 		return nil
 	})
 
 	ovsAddConfigPage(app)
+	addInterfacesPage(app)
+	app.AddFlowDetail("Datapath flows", datapathFlowsDetail)
+	app.AddFlowAction("ofproto/trace", 't', ofprotoTraceAction)
 	app.WelcomePage(`In "ovs" mode you'll be able to configure OvS IPFIX sampling as well as to visualize live OvS statistics`)
 
 	nf, err := netflow.NewNFReader(1,
-		"netflow://"+ipAddr+":2055",
+		"netflow://"+listen,
 		&view.FlowConsumer{FlowTable: app.FlowTable(), App: app.App()},
-		[]netflow.Enricher{},
+		append(ovsEnrichers(), podEnrichers(cmd, app)...),
 		log)
 	if err != nil {
 		log.Fatal(err)
 	}
+	setIPFIXMapping(app, nf, true)
 	go nf.Listen()
 
 	if err := app.Run(); err != nil {
@@ -166,23 +168,34 @@ func runOvs(cmd *cobra.Command, args []string) {
 }
 
 // ipAddressFromOvsdb returns the local IP address we use to listen based on an ovsdb string.
-// If it's unix, we use localhost. If it's a remote connection, we use the source IP address that
-// would be used to contact such remote host.
+// If it's unix, we use localhost. If it's a remote connection (tcp or ssl), we use the source IP
+// address that would be used to contact such remote host. If a comma-separated list of targets
+// is given, the first reachable one is used.
 func ipAddressFromOvsdb(ovsdb string) (string, error) {
-	parts := strings.Split(ovsdb, ":")
-	switch parts[0] {
-	case "tcp":
-		conn, err := net.Dial("tcp", strings.Join(parts[1:], ":"))
+	endpoints, err := endpoint.ParseList(ovsdb)
+	if err != nil {
+		return "", err
+	}
+	errs := []string{}
+	for _, ep := range endpoints {
+		if !ep.IsRemote() {
+			if _, err := os.Stat(ep.Path); errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, fmt.Sprintf("OvS socket file does not exist: %s", ep.Path))
+				continue
+			}
+			return "127.0.0.1", nil
+		}
+		conn, err := net.DialTimeout("tcp", ep.Address(), 5*time.Second)
 		if err != nil {
-			return "", fmt.Errorf("Failed to connect to remote OvS at %s", ovsdb)
+			errs = append(errs, fmt.Sprintf("Failed to connect to remote OvS at %s", ep.String()))
+			continue
 		}
-		return strings.Split(conn.LocalAddr().String(), ":")[0], nil
-	case "unix":
-		if _, err := os.Stat(parts[1]); errors.Is(err, os.ErrNotExist) {
-			return "", fmt.Errorf("OvS socket file does not exist: %s", parts[1])
+		defer conn.Close()
+		host, _, err := net.SplitHostPort(conn.LocalAddr().String())
+		if err != nil {
+			return "", err
 		}
-		return "127.0.0.1", nil
-	default:
-		return "", fmt.Errorf("Unsupported OvS target. Only unix and tcp are supported %s", ovsdb)
+		return host, nil
 	}
+	return "", fmt.Errorf("%s", strings.Join(errs, ". "))
 }
@@ -1,7 +1,14 @@
 package cmd
 
 import (
+	"amorenoz/ovs-flowmon/pkg/endpoint"
+	"amorenoz/ovs-flowmon/pkg/flowmon"
+	"amorenoz/ovs-flowmon/pkg/ovn"
 	"amorenoz/ovs-flowmon/pkg/ovs"
+	"amorenoz/ovs-flowmon/pkg/stats"
+	"fmt"
+	"os"
+	"path/filepath"
 
 	_ "github.com/netsampler/goflow2/format/protobuf"
 	"github.com/sirupsen/logrus"
@@ -12,10 +19,16 @@ var (
 	//app *tview.Application
 	//flowTable   *view.FlowTable
 	//statsViewer *stats.StatsView
-	ovsClient *ovs.OVSClient
-	log       = logrus.New()
-	logLevel  string
-	ovsdb     string
+	ovsInstances    []*ovsInstance
+	chassisEnricher = ovs.NewChassisEnricher()
+	interfaceStats  *stats.InterfaceStatsView
+	log             = logrus.New()
+	logLevel        string
+	mappingFile     string
+	tlsOpts         endpoint.TLSOptions
+	// IPFIX collector addresses
+	listenAddr    string
+	advertiseAddr string
 
 	rootCmd = &cobra.Command{
 		Use:   "ovs-flowmon",
@@ -36,18 +49,77 @@ func Execute() error {
 func init() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().StringVarP(&logLevel, "loglevel", "l", "info", "Log level")
+	withOVS, _ := flowmon.MappingCapacity(true)
+	withoutOVS, _ := flowmon.MappingCapacity(false)
+	rootCmd.PersistentFlags().StringVar(&mappingFile, "ipfix-mapping", "",
+		fmt.Sprintf("YAML file with up to %d additional IPFIX information elements to decode as flow fields (%d with 'ovs: false' in listen mode)",
+			withOVS, withoutOVS))
 
 	// listen
 	rootCmd.AddCommand(listenCmd)
+	addTLSFlags(listenCmd)
+	addPodFlags(listenCmd)
+	addCollectorFlags(listenCmd)
 
 	// OVS
 	rootCmd.AddCommand(ovsCmd)
+	addTLSFlags(ovsCmd)
+	addCollectorFlags(ovsCmd)
+	addPodFlags(ovsCmd)
 
 	// OVN
 	rootCmd.AddCommand(ovnCmd)
-	ovnCmd.Flags().StringP("nbdb", "n", "unix:/var/run/ovn/ovnnb_db.sock", "OVN NB database connection")
-	ovnCmd.Flags().StringP("sbdb", "s", "unix:/var/run/ovn/ovnsb_db.sock", "OVN SB database connection") // TODO Override with OVN_NB_DB and OVN_SB_DB and OVN_RUNDIR
-	ovnCmd.Flags().StringP("ovs", "o", "", "Optional OVS DB to configure")
+	addNBFlag(ovnCmd)
+	ovnCmd.Flags().StringP("sbdb", "s", ovnDefaultDB("OVN_SB_DB", "ovnsb_db.sock"), "OVN SB database connection. Can be a comma-separated list of cluster members. Overrides $OVN_SB_DB")
+	ovnCmd.Flags().String("ovn-trace", ovn.DefaultTraceCommand, "ovn-trace binary used to trace sampled flows")
+	ovnCmd.Flags().Bool("k8s", false, "Attribute flows to OVN-Kubernetes pods, namespaces and nodes")
+	ovnCmd.Flags().StringArrayP("ovs", "o", []string{}, "Optional OVS DB to configure. Can be given several times to configure multiple chassis")
+	ovnCmd.Flags().Int("domain-id", 0,
+		"Observation domain ID (1-255) of OVN drop samples. Default: the lowest ID not used by other tools or OVN Sampling_Apps")
+	ovnCmd.Flags().Bool("leave-enabled", false, "Leave OVN drop sampling enabled on exit instead of restoring the original NB options")
+	addCollectorSetFlags(ovnCmd)
+	addTLSFlags(ovnCmd)
+	addCollectorFlags(ovnCmd)
+
+	// OVN ACL sampling
+	ovnCmd.AddCommand(ovnACLSamplingCmd)
+	addNBFlag(ovnACLSamplingCmd)
+	ovnACLSamplingCmd.Flags().StringArray("port-group", []string{}, "Sample the ACLs applied on this Port Group. Can be given several times")
+	ovnACLSamplingCmd.Flags().StringArray("acl-name", []string{}, "Sample the ACLs with this name. Can be given several times")
+	ovnACLSamplingCmd.Flags().IntSlice("tier", []int{}, "Sample the ACLs in these tiers")
+	ovnACLSamplingCmd.Flags().Bool("all", false, "Sample all ACLs. Required if no other ACL selector is given")
+	ovnACLSamplingCmd.Flags().Int("probability", ovn.DefaultACLSampleProbability, "Sampling probability in units of 1/65535")
+	ovnACLSamplingCmd.Flags().Bool("k8s", false, "Attribute flows to OVN-Kubernetes pods, namespaces and nodes")
+	ovnACLSamplingCmd.Flags().StringArrayP("ovs", "o", []string{}, "Optional OVS DB to configure. Can be given several times to configure multiple chassis")
+	addCollectorSetFlags(ovnACLSamplingCmd)
+	addTLSFlags(ovnACLSamplingCmd)
+	addCollectorFlags(ovnACLSamplingCmd)
+}
+
+// addNBFlag adds the flag that sets the OVN NB database connection.
+func addNBFlag(cmd *cobra.Command) {
+	cmd.Flags().StringP("nbdb", "n", ovnDefaultDB("OVN_NB_DB", "ovnnb_db.sock"), "OVN NB database connection. Can be a comma-separated list of cluster members. Overrides $OVN_NB_DB")
+}
+
+// ovnDefaultDB returns the default connection to an OVN database the same way
+// ovn-nbctl and ovn-sbctl do: the value of envVar if set, otherwise the unix socket in
+// $OVN_RUNDIR (/var/run/ovn by default).
+func ovnDefaultDB(envVar, socket string) string {
+	if db := os.Getenv(envVar); db != "" {
+		return db
+	}
+	rundir := os.Getenv("OVN_RUNDIR")
+	if rundir == "" {
+		rundir = "/var/run/ovn"
+	}
+	return "unix:" + filepath.Join(rundir, socket)
+}
+
+// addTLSFlags adds the flags needed to connect to OVSDB servers using ssl.
+func addTLSFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&tlsOpts.PrivateKey, "private-key", "", "Private key file used for ssl connections")
+	cmd.Flags().StringVar(&tlsOpts.Certificate, "certificate", "", "Certificate file used for ssl connections")
+	cmd.Flags().StringVar(&tlsOpts.CACert, "ca-cert", "", "CA certificate file used to verify the server in ssl connections")
 }
 
 func initConfig() {
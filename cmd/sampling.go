@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"amorenoz/ovs-flowmon/pkg/ovn"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// maxCollectorSetID is the highest Flow_Sample_Collector_Set ID (32 bits).
+	maxCollectorSetID = 1<<32 - 1
+	// maxDomainID is the highest observation domain ID of OVN drop samples (8 bits).
+	maxDomainID = 255
+)
+
+// addCollectorSetFlags adds the flags that select the OVS Flow_Sample_Collector_Set OVN
+// samples are sent to.
+func addCollectorSetFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("collector-set-id", 0,
+		"OVS Flow_Sample_Collector_Set ID OVN samples are sent to. Default: the lowest ID not used by other tools")
+}
+
+// selectID returns requested, warning if it is in use, or, if requested is 0, the lowest
+// ID between first and max that is not in use. what describes the ID in messages.
+func selectID(what string, requested int, inUse map[int]bool, first, max int) (int, error) {
+	if requested != 0 {
+		if requested < 0 || requested > max {
+			return 0, fmt.Errorf("Invalid %s %d: must be between 1 and %d", what, requested, max)
+		}
+		if inUse[requested] {
+			log.Warningf("%s %d is already used by another tool", what, requested)
+		}
+		return requested, nil
+	}
+	for id := first; id <= max; id++ {
+		if !inUse[id] {
+			log.Infof("Using %s %d", what, id)
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("No free %s", what)
+}
+
+// collectorSetID returns the Flow_Sample_Collector_Set ID given with --collector-set-id or,
+// if not given, the lowest ID that is neither in used nor configured by other tools on the
+// started OVS instances.
+func collectorSetID(cmd *cobra.Command, used []int) int {
+	id, err := cmd.Flags().GetInt("collector-set-id")
+	if err != nil {
+		log.Fatal(err)
+	}
+	inUse := map[int]bool{}
+	for _, usedID := range used {
+		inUse[usedID] = true
+	}
+	for _, instance := range ovsInstances {
+		if !instance.client.Started() {
+			continue
+		}
+		ids, err := instance.client.CollectorSetIDs()
+		if err != nil {
+			log.Warningf("Cannot list the Flow_Sample_Collector_Sets of %s: %s", instance.target, err.Error())
+			continue
+		}
+		for _, usedID := range ids {
+			inUse[usedID] = true
+		}
+	}
+	id, err = selectID("Flow_Sample_Collector_Set ID", id, inUse, ovn.DefaultDebugCollectorSetID, maxCollectorSetID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return id
+}
+
+// domainID returns the observation domain ID of OVN drop samples given with --domain-id
+// or, if not given, the lowest ID that is not in used.
+func domainID(cmd *cobra.Command, used []int) int {
+	id, err := cmd.Flags().GetInt("domain-id")
+	if err != nil {
+		log.Fatal(err)
+	}
+	inUse := map[int]bool{}
+	for _, usedID := range used {
+		inUse[usedID] = true
+	}
+	id, err = selectID("observation domain ID", id, inUse, ovn.DefaultDebugDomainID, maxDomainID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return id
+}
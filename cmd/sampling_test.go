@@ -0,0 +1,37 @@
+package cmd
+
+import "testing"
+
+func TestSelectID(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested int
+		inUse     []int
+		max       int
+		id        int
+		ok        bool
+	}{
+		{name: "first free", max: 255, id: 1, ok: true},
+		{name: "skip used", inUse: []int{1, 2, 4}, max: 255, id: 3, ok: true},
+		{name: "requested", requested: 7, inUse: []int{1}, max: 255, id: 7, ok: true},
+		{name: "requested in use", requested: 1, inUse: []int{1}, max: 255, id: 1, ok: true},
+		{name: "requested too big", requested: 256, max: 255},
+		{name: "negative", requested: -1, max: 255},
+		{name: "exhausted", inUse: []int{1, 2, 3}, max: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inUse := map[int]bool{}
+			for _, id := range tt.inUse {
+				inUse[id] = true
+			}
+			id, err := selectID("ID", tt.requested, inUse, 1, tt.max)
+			if (err == nil) != tt.ok {
+				t.Fatalf("selectID() error = %v, want ok %v", err, tt.ok)
+			}
+			if id != tt.id {
+				t.Errorf("selectID() = %d, want %d", id, tt.id)
+			}
+		})
+	}
+}
@@ -100,7 +100,8 @@ if [[ ${MODE} == "ovn" ]]; then
     if [[ ${#ovn_db_hosts[@]} == 0 ]]; then
         error "Cannot determine ovn endpoint"
     fi
-    OVN_CENTRAL=${ovn_db_hosts[0]}
+    # Pass all the members of the (RAFT) cluster, ovs-flowmon connects to the NB leader.
+    OVN_CENTRAL=$(IFS=,; echo "${ovn_db_hosts[*]}")
 fi
 
 deployment=$(uuidgen | cut -d "-" -f 1)
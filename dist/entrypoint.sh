@@ -4,12 +4,26 @@ set -eux
 OVS_FLOWMON_MODE=${OVS_FLOWMON_MODE:-ovs}
 OVS_TARGET=${OVS_TARGET:-unix:/var/run/openvswitch/db.sock}
 
+# ovn_db prints the connection to an OVN database listening on port $1 on every host of
+# the comma-separated $OVN_CENTRAL list.
+ovn_db() {
+    local port=$1
+    local db=""
+    for host in ${OVN_CENTRAL//,/ }; do
+        if [[ ${host} == *:* ]]; then
+            host="[${host}]"
+        fi
+        db="${db:+${db},}tcp:${host}:${port}"
+    done
+    echo ${db}
+}
+
 case ${OVS_FLOWMON_MODE} in
     ovs)
         cmd="ovs-flowmon ovs ${OVS_TARGET}"
         ;;
     ovn)
-        cmd="ovs-flowmon ovn --nbdb tcp:${OVN_CENTRAL}:6641 --sbdb tcp:${OVN_CENTRAL}:6642 --ovs ${OVS_TARGET}"
+        cmd="ovs-flowmon ovn --nbdb $(ovn_db 6641) --sbdb $(ovn_db 6642) --ovs ${OVS_TARGET}"
         ;;
     *)
         echo "unkown mode"
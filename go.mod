@@ -4,6 +4,7 @@ go 1.16
 
 require (
 	github.com/bombsimon/logrusr/v2 v2.0.1
+	github.com/cenkalti/backoff/v4 v4.1.1
 	github.com/gdamore/tcell/v2 v2.4.1-0.20210905002822-f057f0a857a1
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/netsampler/goflow2 v1.1.1-0.20220825033856-d6caeaacddbb
@@ -12,4 +13,5 @@ require (
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/cobra v0.0.3
 	google.golang.org/protobuf v1.27.1
+	gopkg.in/yaml.v2 v2.4.0
 )
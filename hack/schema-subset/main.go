@@ -0,0 +1,172 @@
+// schema-subset writes the subset of an upstream OVSDB schema that ovs-flowmon generates
+// its models from. The tables and columns to keep are read from a list file with one
+// table per line followed by its columns:
+//
+//	# comment
+//	Logical_Switch name ports acls external_ids
+//
+// Column definitions are copied verbatim from the upstream schema. Indexes over columns
+// that are not kept are dropped, as is the checksum, which no longer matches.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type tableList struct {
+	names   []string
+	columns map[string][]string
+}
+
+func parseTableList(r io.Reader) (*tableList, error) {
+	list := &tableList{columns: map[string][]string{}}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) == 1 {
+			return nil, fmt.Errorf("line %d: table %s has no columns", n, fields[0])
+		}
+		if _, ok := list.columns[fields[0]]; ok {
+			return nil, fmt.Errorf("line %d: duplicated table %s", n, fields[0])
+		}
+		list.names = append(list.names, fields[0])
+		list.columns[fields[0]] = fields[1:]
+	}
+	return list, scanner.Err()
+}
+
+// subset returns the schema in upstream with only the tables and columns in list.
+func subset(upstream []byte, list *tableList) ([]byte, error) {
+	var schema map[string]json.RawMessage
+	if err := json.Unmarshal(upstream, &schema); err != nil {
+		return nil, err
+	}
+	var tables map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(schema["tables"], &tables); err != nil {
+		return nil, fmt.Errorf("tables: %w", err)
+	}
+
+	out := map[string]map[string]json.RawMessage{}
+	for _, name := range list.names {
+		table, ok := tables[name]
+		if !ok {
+			return nil, fmt.Errorf("table %s not found", name)
+		}
+		var columns map[string]json.RawMessage
+		if err := json.Unmarshal(table["columns"], &columns); err != nil {
+			return nil, fmt.Errorf("table %s: %w", name, err)
+		}
+		kept := map[string]json.RawMessage{}
+		for _, column := range list.columns[name] {
+			def, ok := columns[column]
+			if !ok {
+				return nil, fmt.Errorf("column %s.%s not found", name, column)
+			}
+			kept[column] = def
+		}
+
+		t := map[string]json.RawMessage{}
+		for key, value := range table {
+			t[key] = value
+		}
+		var err error
+		if t["columns"], err = json.Marshal(kept); err != nil {
+			return nil, err
+		}
+		if raw, ok := table["indexes"]; ok {
+			var indexes [][]string
+			if err := json.Unmarshal(raw, &indexes); err != nil {
+				return nil, fmt.Errorf("table %s indexes: %w", name, err)
+			}
+			if indexes = keptIndexes(indexes, kept); len(indexes) == 0 {
+				delete(t, "indexes")
+			} else if t["indexes"], err = json.Marshal(indexes); err != nil {
+				return nil, err
+			}
+		}
+		out[name] = t
+	}
+
+	delete(schema, "cksum")
+	var err error
+	if schema["tables"], err = json.Marshal(out); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// keptIndexes returns the indexes whose columns are all in columns.
+func keptIndexes(indexes [][]string, columns map[string]json.RawMessage) [][]string {
+	kept := [][]string{}
+next:
+	for _, index := range indexes {
+		for _, column := range index {
+			if _, ok := columns[column]; !ok {
+				continue next
+			}
+		}
+		kept = append(kept, index)
+	}
+	return kept
+}
+
+func main() {
+	tablesFile := flag.String("tables", "", "file with the tables and columns to keep")
+	output := flag.String("o", "", "output schema file (default stdout)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s -tables FILE [-o FILE] UPSTREAM_SCHEMA\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *tablesFile == "" || flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*tablesFile, flag.Arg(0), *output); err != nil {
+		fmt.Fprintf(os.Stderr, "schema-subset: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(tablesFile, upstreamFile, output string) error {
+	f, err := os.Open(tablesFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	list, err := parseTableList(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", tablesFile, err)
+	}
+	upstream, err := os.ReadFile(upstreamFile)
+	if err != nil {
+		return err
+	}
+	data, err := subset(upstream, list)
+	if err != nil {
+		return fmt.Errorf("%s: %w", upstreamFile, err)
+	}
+	if output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(output, data, 0644)
+}
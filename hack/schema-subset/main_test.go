@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const upstream = `{
+  "name": "Test",
+  "version": "1.2.3",
+  "cksum": "123 456",
+  "tables": {
+    "A": {
+      "columns": {
+        "name": {"type": "string"},
+        "ref": {"type": {"key": {"type": "uuid", "refTable": "B"}, "min": 0, "max": 1}},
+        "other": {"type": "integer"}},
+      "indexes": [["name"], ["other"]],
+      "isRoot": true},
+    "B": {
+      "columns": {
+        "value": {"type": "integer"}},
+      "indexes": [["value"]],
+      "maxRows": 1}}}`
+
+func TestSubset(t *testing.T) {
+	tests := []struct {
+		name   string
+		tables string
+		want   string
+		err    string
+	}{
+		{
+			name:   "columns and indexes",
+			tables: "# comment\nA name ref # trailing\n",
+			want: `{"name": "Test", "version": "1.2.3", "tables": {
+				"A": {
+					"columns": {
+						"name": {"type": "string"},
+						"ref": {"type": {"key": {"type": "uuid", "refTable": "B"}, "min": 0, "max": 1}}},
+					"indexes": [["name"]],
+					"isRoot": true}}}`,
+		},
+		{
+			name:   "dropped indexes",
+			tables: "A other\nB value\n",
+			want: `{"name": "Test", "version": "1.2.3", "tables": {
+				"A": {"columns": {"other": {"type": "integer"}}, "indexes": [["other"]], "isRoot": true},
+				"B": {"columns": {"value": {"type": "integer"}}, "indexes": [["value"]], "maxRows": 1}}}`,
+		},
+		{
+			name:   "no index left",
+			tables: "A ref\n",
+			want: `{"name": "Test", "version": "1.2.3", "tables": {
+				"A": {"columns": {"ref": {"type": {"key": {"type": "uuid", "refTable": "B"}, "min": 0, "max": 1}}},
+					"isRoot": true}}}`,
+		},
+		{
+			name:   "unknown table",
+			tables: "C name\n",
+			err:    "table C not found",
+		},
+		{
+			name:   "unknown column",
+			tables: "A name missing\n",
+			err:    "column A.missing not found",
+		},
+		{
+			name:   "no columns",
+			tables: "A\n",
+			err:    "line 1: table A has no columns",
+		},
+		{
+			name:   "duplicated table",
+			tables: "A name\nA ref\n",
+			err:    "line 2: duplicated table A",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := parseTableList(strings.NewReader(tt.tables))
+			var data []byte
+			if err == nil {
+				data, err = subset([]byte(upstream), list)
+			}
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("error = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, want interface{}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("subset() = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+#!/bin/bash
+# Fetches the OVSDB schemas of the pinned OVS and OVN releases, writes the subsets listed
+# in the *.tables files next to each model package and regenerates the models.
+set -euo pipefail
+
+OVS_VERSION=${OVS_VERSION:-v3.4.0}
+OVN_VERSION=${OVN_VERSION:-v24.09.0}
+
+ROOT=$(cd "$(dirname "$0")/.." && pwd)
+TMP=$(mktemp -d)
+trap 'rm -rf "$TMP"' EXIT
+
+fetch() {
+    local url=$1 out=$2
+    echo "Fetching $url"
+    curl -fsSL -o "$out" "$url"
+}
+
+fetch "https://raw.githubusercontent.com/openvswitch/ovs/$OVS_VERSION/vswitchd/vswitch.ovsschema" "$TMP/vswitch.ovsschema"
+fetch "https://raw.githubusercontent.com/ovn-org/ovn/$OVN_VERSION/ovn-nb.ovsschema" "$TMP/ovn-nb.ovsschema"
+fetch "https://raw.githubusercontent.com/ovn-org/ovn/$OVN_VERSION/ovn-sb.ovsschema" "$TMP/ovn-sb.ovsschema"
+
+cd "$ROOT"
+for dir in pkg/ovs/vswitchd pkg/ovn/nbdb pkg/ovn/sbdb; do
+    for tables in "$dir"/*.tables; do
+        name=$(basename "$tables" .tables)
+        go run ./hack/schema-subset -tables "$tables" -o "$dir/$name.ovsschema" "$TMP/$name.ovsschema"
+    done
+    (cd "$dir" && go generate)
+done
@@ -0,0 +1,421 @@
+// Package dbmodel adapts libovsdb database models to the schema of the server they
+// connect to, so that tables and columns which only exist in newer versions can be used
+// when available without breaking on older deployments.
+package dbmodel
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ovn-org/libovsdb/cache"
+	"github.com/ovn-org/libovsdb/client"
+	"github.com/ovn-org/libovsdb/mapper"
+	"github.com/ovn-org/libovsdb/model"
+	"github.com/ovn-org/libovsdb/ovsdb"
+	"github.com/sirupsen/logrus"
+)
+
+// Table is the model of an OVSDB table. Optional tables are left out of the database
+// model if the server's schema doesn't have them or any of the required columns their
+// model uses. Optional columns are left out of the table's model if the server's schema
+// doesn't have them.
+type Table struct {
+	Model           model.Model
+	Optional        bool
+	OptionalColumns []string
+}
+
+// Client is a libovsdb client whose database model is adapted to the schema of the
+// server when connecting. Tables whose model is stripped of the optional columns the
+// server doesn't have are stored in the cache with an anonymous struct type. Get, List,
+// WhereCache, WithTable and AddEventHandler convert them from and to the full model, so
+// callers only ever use the full models. Stripped tables can't be written to.
+//
+// libovsdb purges the cache when it reconnects without sending delete events for the
+// rows it drops, so anything built from cache events goes stale. Functions registered
+// with OnReconnect are called to rebuild it.
+type Client struct {
+	client.Client
+	dbName string
+	tables map[string]Table
+	opts   []client.Option
+	log    *logrus.Logger
+
+	dbModel *model.DBModel
+	// missing are the optional tables and columns (table.column) the server doesn't have.
+	missing []string
+	// stripped maps the types of the full models of stripped tables to the type of the
+	// model registered in the client. full maps them back.
+	stripped map[reflect.Type]reflect.Type
+	full     map[reflect.Type]reflect.Type
+
+	reconnectMutex sync.Mutex
+	// rowCaches are the table caches of the current connection. libovsdb replaces them
+	// when the cache is purged on reconnection.
+	rowCaches   map[string]*cache.RowCache
+	onReconnect []func()
+}
+
+// NewClient returns a client of the given tables of database dbName. The model of the
+// tables is used as is unless connecting fails because the server's schema doesn't
+// support it, see Connect.
+func NewClient(dbName string, tables map[string]Table, log *logrus.Logger, opts ...client.Option) (*Client, error) {
+	models := map[string]model.Model{}
+	for name, table := range tables {
+		models[name] = table.Model
+	}
+	dbModel, err := model.NewDBModel(dbName, models)
+	if err != nil {
+		return nil, err
+	}
+	cli, err := client.NewOVSDBClient(dbModel, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		Client:   cli,
+		dbName:   dbName,
+		tables:   tables,
+		opts:     opts,
+		log:      log,
+		dbModel:  dbModel,
+		stripped: map[reflect.Type]reflect.Type{},
+		full:     map[reflect.Type]reflect.Type{},
+	}, nil
+}
+
+// Connect connects to the server. If the server's schema is older than the one the
+// models were generated from, the schema is fetched and the client is recreated with
+// the model of the tables and columns it supports. An error is returned if a required
+// table or column is not supported.
+func (c *Client) Connect(ctx context.Context) error {
+	if err := c.Client.Connect(ctx); err != nil {
+		schema, schemaErr := fetchSchema(ctx, c.dbName, c.opts)
+		if schemaErr != nil {
+			return err
+		}
+		dbModel, stripped, missing, modelErr := NewDBModel(schema, c.tables)
+		if modelErr != nil {
+			return modelErr
+		}
+		if len(missing) == 0 {
+			// The schema supports the full model, so it was not the problem.
+			return err
+		}
+		cli, cliErr := client.NewOVSDBClient(dbModel, c.opts...)
+		if cliErr != nil {
+			return cliErr
+		}
+		if err := cli.Connect(ctx); err != nil {
+			return err
+		}
+		c.Client = cli
+		c.dbModel = dbModel
+		c.missing = missing
+		for fullType, strippedType := range stripped {
+			c.stripped[fullType] = strippedType
+			c.full[strippedType] = fullType
+		}
+	}
+	c.reconnectMutex.Lock()
+	c.rowCaches = c.currentRowCaches()
+	c.reconnectMutex.Unlock()
+	schema := c.Schema()
+	c.log.Infof("%s schema version %s", schema.Name, schema.Version)
+	if len(c.missing) > 0 {
+		c.log.Warningf("%s schema version %s does not support %s: some information will not be available",
+			schema.Name, schema.Version, strings.Join(c.missing, ", "))
+	}
+	return nil
+}
+
+// fetchSchema returns the schema of the database dbName using a client with the given
+// options and a model without tables, which is valid for any schema.
+func fetchSchema(ctx context.Context, dbName string, opts []client.Option) (*ovsdb.DatabaseSchema, error) {
+	dbModel, err := model.NewDBModel(dbName, map[string]model.Model{})
+	if err != nil {
+		return nil, err
+	}
+	cli, err := client.NewOVSDBClient(dbModel, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := cli.Connect(ctx); err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+	schema := cli.Schema()
+	if schema == nil {
+		return nil, fmt.Errorf("Failed to get the schema of %s", dbName)
+	}
+	return schema, nil
+}
+
+// NewDBModel returns the model of the tables the schema supports, the stripped model
+// types indexed by the type of their full model and the names of the optional tables
+// and columns that were left out. An error is returned if a required table or column is
+// not supported.
+func NewDBModel(schema *ovsdb.DatabaseSchema, tables map[string]Table) (*model.DBModel, map[reflect.Type]reflect.Type, []string, error) {
+	models := map[string]model.Model{}
+	stripped := map[reflect.Type]reflect.Type{}
+	missing := []string{}
+	errors := []string{}
+	for name, table := range tables {
+		m, columns, err := supported(schema, name, table)
+		switch {
+		case err == nil:
+			models[name] = m
+			if len(columns) > 0 {
+				stripped[reflect.TypeOf(table.Model)] = reflect.TypeOf(m)
+				missing = append(missing, columns...)
+			}
+		case table.Optional:
+			missing = append(missing, name)
+		default:
+			errors = append(errors, err.Error())
+		}
+	}
+	if len(errors) > 0 {
+		sort.Strings(errors)
+		return nil, nil, nil, fmt.Errorf("%s schema version %s is not supported: %s",
+			schema.Name, schema.Version, strings.Join(errors, ". "))
+	}
+	sort.Strings(missing)
+	dbModel, err := model.NewDBModel(schema.Name, models)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return dbModel, stripped, missing, nil
+}
+
+// supported returns the model of the table the schema supports and the optional columns
+// (table.column) that were left out of it. An error is returned if the schema doesn't
+// have the table or any of its required columns.
+func supported(schema *ovsdb.DatabaseSchema, name string, table Table) (model.Model, []string, error) {
+	tableSchema := schema.Table(name)
+	if tableSchema == nil {
+		return nil, nil, fmt.Errorf("table %s does not exist", name)
+	}
+	optional := map[string]bool{}
+	for _, column := range table.OptionalColumns {
+		optional[column] = true
+	}
+	fullType := reflect.TypeOf(table.Model).Elem()
+	fields := []reflect.StructField{}
+	missing := []string{}
+	for i := 0; i < fullType.NumField(); i++ {
+		field := fullType.Field(i)
+		column := field.Tag.Get("ovsdb")
+		if column != "" && column != "_uuid" && tableSchema.Column(column) == nil && optional[column] {
+			missing = append(missing, name+"."+column)
+			continue
+		}
+		fields = append(fields, reflect.StructField{Name: field.Name, Type: field.Type, Tag: field.Tag})
+	}
+	m := table.Model
+	if len(missing) > 0 {
+		m = reflect.New(reflect.StructOf(fields)).Interface()
+	}
+	if _, err := mapper.NewInfo(tableSchema, m); err != nil {
+		return nil, nil, fmt.Errorf("table %s: %s", name, err.Error())
+	}
+	return m, missing, nil
+}
+
+// OnReconnect registers a function that is called after the client reconnects, once
+// the cache holds the rows of the new connection and before any cache event of the new
+// connection is handled. It is called from the cache event handling goroutine, so it must
+// not add event handlers. Only reconnections detected through the handlers added with
+// AddEventHandler are reported.
+func (c *Client) OnReconnect(fn func()) {
+	c.reconnectMutex.Lock()
+	defer c.reconnectMutex.Unlock()
+	c.onReconnect = append(c.onReconnect, fn)
+}
+
+// currentRowCaches returns the table caches of the model's tables.
+func (c *Client) currentRowCaches() map[string]*cache.RowCache {
+	rowCaches := map[string]*cache.RowCache{}
+	tableCache := c.Cache()
+	if tableCache == nil {
+		return rowCaches
+	}
+	for name := range c.dbModel.Types() {
+		rowCaches[name] = tableCache.Table(name)
+	}
+	return rowCaches
+}
+
+// checkReconnect calls the OnReconnect functions if the cache of the given table was
+// purged since the last check. libovsdb only handles the cache events of a new connection
+// once its monitors have populated the cache, so the cache is complete at this point.
+func (c *Client) checkReconnect(table string) {
+	tableCache := c.Cache()
+	if tableCache == nil {
+		return
+	}
+	rowCache := tableCache.Table(table)
+	c.reconnectMutex.Lock()
+	if rowCache == nil || rowCache == c.rowCaches[table] {
+		c.reconnectMutex.Unlock()
+		return
+	}
+	c.rowCaches = c.currentRowCaches()
+	onReconnect := c.onReconnect
+	c.reconnectMutex.Unlock()
+	c.log.Infof("Reconnected to %s at %s: rebuilding the data built from its cache", c.dbName, c.CurrentEndpoint())
+	for _, fn := range onReconnect {
+		fn()
+	}
+}
+
+// Has returns whether the client's model has the given table.
+func (c *Client) Has(table string) bool {
+	_, ok := c.dbModel.Types()[table]
+	return ok
+}
+
+// copyFields copies the fields that dst and src have in common. One of them must be
+// the stripped type of the other.
+func copyFields(dst reflect.Value, src reflect.Value) {
+	smaller := dst
+	if src.NumField() < dst.NumField() {
+		smaller = src
+	}
+	for i := 0; i < smaller.NumField(); i++ {
+		name := smaller.Type().Field(i).Name
+		dst.FieldByName(name).Set(src.FieldByName(name))
+	}
+}
+
+// convert returns a copy of m with the given model type (a pointer to struct type).
+func convert(m model.Model, to reflect.Type) model.Model {
+	converted := reflect.New(to.Elem())
+	copyFields(converted.Elem(), reflect.ValueOf(m).Elem())
+	return converted.Interface()
+}
+
+// toFull converts m to its full model if it was stripped.
+func (c *Client) toFull(m model.Model) model.Model {
+	if fullType, ok := c.full[reflect.TypeOf(m)]; ok {
+		return convert(m, fullType)
+	}
+	return m
+}
+
+// listConverted lists the rows of a stripped table with list, which must accept a
+// pointer to a slice of stripped models, and appends them to result converted to their
+// full model.
+func (c *Client) listConverted(result interface{}, list func(interface{}) error) error {
+	resultVal := reflect.ValueOf(result)
+	if resultVal.Kind() != reflect.Ptr || resultVal.Elem().Kind() != reflect.Slice {
+		return list(result)
+	}
+	strippedType, ok := c.stripped[reflect.PtrTo(resultVal.Elem().Type().Elem())]
+	if !ok {
+		return list(result)
+	}
+	rows := reflect.New(reflect.SliceOf(strippedType.Elem()))
+	if err := list(rows.Interface()); err != nil {
+		return err
+	}
+	slice := resultVal.Elem()
+	for i := 0; i < rows.Elem().Len(); i++ {
+		row := reflect.New(slice.Type().Elem()).Elem()
+		copyFields(row, rows.Elem().Index(i))
+		slice.Set(reflect.Append(slice, row))
+	}
+	return nil
+}
+
+// Get implements client.API.
+func (c *Client) Get(m model.Model) error {
+	strippedType, ok := c.stripped[reflect.TypeOf(m)]
+	if !ok {
+		return c.Client.Get(m)
+	}
+	row := convert(m, strippedType)
+	if err := c.Client.Get(row); err != nil {
+		return err
+	}
+	copyFields(reflect.ValueOf(m).Elem(), reflect.ValueOf(row).Elem())
+	return nil
+}
+
+// List implements client.API.
+func (c *Client) List(result interface{}) error {
+	return c.listConverted(result, c.Client.List)
+}
+
+// WhereCache implements client.API. predicate can take the full model of stripped
+// tables.
+func (c *Client) WhereCache(predicate interface{}) client.ConditionalAPI {
+	fn := reflect.ValueOf(predicate)
+	if fn.Kind() != reflect.Func || fn.Type().NumIn() != 1 {
+		return c.Client.WhereCache(predicate)
+	}
+	strippedType, ok := c.stripped[fn.Type().In(0)]
+	if !ok {
+		return c.Client.WhereCache(predicate)
+	}
+	fullType := fn.Type().In(0)
+	wrapped := reflect.MakeFunc(reflect.FuncOf([]reflect.Type{strippedType}, []reflect.Type{fn.Type().Out(0)}, false),
+		func(args []reflect.Value) []reflect.Value {
+			return fn.Call([]reflect.Value{reflect.ValueOf(convert(args[0].Interface(), fullType))})
+		})
+	return &conditionalAPI{
+		ConditionalAPI: c.Client.WhereCache(wrapped.Interface()),
+		client:         c,
+	}
+}
+
+// conditionalAPI converts the rows listed from stripped tables.
+type conditionalAPI struct {
+	client.ConditionalAPI
+	client *Client
+}
+
+// List implements client.ConditionalAPI.
+func (a *conditionalAPI) List(result interface{}) error {
+	return a.client.listConverted(result, a.ConditionalAPI.List)
+}
+
+// WithTable returns a client.WithTable monitor option for the table of the given full
+// model.
+func (c *Client) WithTable(m model.Model) client.MonitorOption {
+	if strippedType, ok := c.stripped[reflect.TypeOf(m)]; ok {
+		return client.WithTable(reflect.New(strippedType.Elem()).Interface())
+	}
+	return client.WithTable(m)
+}
+
+// AddEventHandler adds a handler of the cache events. The rows of stripped tables are
+// passed to it converted to their full model. Must be called after connecting.
+func (c *Client) AddEventHandler(handler cache.EventHandler) {
+	c.Cache().AddEventHandler(&eventHandler{handler: handler, client: c})
+}
+
+// eventHandler converts the rows of stripped tables before passing them to handler.
+type eventHandler struct {
+	handler cache.EventHandler
+	client  *Client
+}
+
+func (h *eventHandler) OnAdd(table string, m model.Model) {
+	h.client.checkReconnect(table)
+	h.handler.OnAdd(table, h.client.toFull(m))
+}
+
+func (h *eventHandler) OnUpdate(table string, old model.Model, new model.Model) {
+	h.client.checkReconnect(table)
+	h.handler.OnUpdate(table, h.client.toFull(old), h.client.toFull(new))
+}
+
+func (h *eventHandler) OnDelete(table string, m model.Model) {
+	h.client.checkReconnect(table)
+	h.handler.OnDelete(table, h.client.toFull(m))
+}
@@ -0,0 +1,435 @@
+package dbmodel
+
+import (
+	"amorenoz/ovs-flowmon/pkg/ovn/sbdb"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bombsimon/logrusr/v2"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/ovn-org/libovsdb/cache"
+	"github.com/ovn-org/libovsdb/client"
+	"github.com/ovn-org/libovsdb/model"
+	"github.com/ovn-org/libovsdb/ovsdb"
+	"github.com/ovn-org/libovsdb/ovsdb/serverdb"
+	"github.com/ovn-org/libovsdb/server"
+	"github.com/sirupsen/logrus"
+)
+
+// oldSchema returns the OVN_Southbound schema without the given tables and columns
+// (table.column).
+func oldSchema(remove ...string) *ovsdb.DatabaseSchema {
+	schema := sbdb.Schema()
+	for _, name := range remove {
+		parts := strings.SplitN(name, ".", 2)
+		if len(parts) == 1 {
+			delete(schema.Tables, name)
+			continue
+		}
+		delete(schema.Tables[parts[0]].Columns, parts[1])
+	}
+	return &schema
+}
+
+func TestNewDBModel(t *testing.T) {
+	tables := map[string]Table{
+		"Logical_Flow": {Model: &sbdb.LogicalFlow{},
+			OptionalColumns: []string{"logical_dp_group"}},
+		"Datapath_Binding": {Model: &sbdb.DatapathBinding{}},
+		"Logical_DP_Group": {Model: &sbdb.LogicalDPGroup{}, Optional: true},
+		"Encap":            {Model: &sbdb.Encap{}, Optional: true},
+	}
+	tests := []struct {
+		name     string
+		remove   []string
+		missing  []string
+		stripped bool
+		err      string
+	}{
+		{
+			name:    "full schema",
+			missing: []string{},
+		},
+		{
+			name:    "missing optional table",
+			remove:  []string{"Encap"},
+			missing: []string{"Encap"},
+		},
+		{
+			name:     "missing optional column",
+			remove:   []string{"Logical_DP_Group", "Logical_Flow.logical_dp_group"},
+			missing:  []string{"Logical_DP_Group", "Logical_Flow.logical_dp_group"},
+			stripped: true,
+		},
+		{
+			name:    "missing column of optional table",
+			remove:  []string{"Encap.chassis_name"},
+			missing: []string{"Encap"},
+		},
+		{
+			name:   "missing required column",
+			remove: []string{"Logical_Flow.match"},
+			err:    "table Logical_Flow",
+		},
+		{
+			name:   "missing required table",
+			remove: []string{"Datapath_Binding"},
+			err:    "table Datapath_Binding does not exist",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbModel, stripped, missing, err := NewDBModel(oldSchema(tt.remove...), tables)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(missing, tt.missing) {
+				t.Errorf("missing = %v, want %v", missing, tt.missing)
+			}
+			lflowType := dbModel.Types()["Logical_Flow"]
+			_, isStripped := stripped[reflect.TypeOf(&sbdb.LogicalFlow{})]
+			if isStripped != tt.stripped || (lflowType != reflect.TypeOf(&sbdb.LogicalFlow{})) != tt.stripped {
+				t.Errorf("Logical_Flow stripped = %v, want %v", isStripped, tt.stripped)
+			}
+			if tt.stripped {
+				if _, ok := lflowType.Elem().FieldByName("LogicalDpGroup"); ok {
+					t.Errorf("stripped Logical_Flow model has the LogicalDpGroup field")
+				}
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	dbModel, stripped, _, err := NewDBModel(oldSchema("Logical_Flow.logical_dp_group"), map[string]Table{
+		"Logical_Flow": {Model: &sbdb.LogicalFlow{},
+			OptionalColumns: []string{"logical_dp_group"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := "group"
+	lflow := &sbdb.LogicalFlow{UUID: "uuid", Match: "ip", Priority: 100, LogicalDpGroup: &group}
+	row := convert(lflow, stripped[reflect.TypeOf(lflow)])
+	if reflect.TypeOf(row) != dbModel.Types()["Logical_Flow"] {
+		t.Fatalf("converted row has type %T", row)
+	}
+	back := convert(row, reflect.TypeOf(lflow)).(*sbdb.LogicalFlow)
+	want := &sbdb.LogicalFlow{UUID: "uuid", Match: "ip", Priority: 100}
+	if !reflect.DeepEqual(back, want) {
+		t.Errorf("round trip = %+v, want %+v", back, want)
+	}
+}
+
+// oldLogicalFlow is the model of Logical_Flow in schemas without logical_dp_group.
+type oldLogicalFlow struct {
+	UUID            string            `ovsdb:"_uuid"`
+	Actions         string            `ovsdb:"actions"`
+	ExternalIDs     map[string]string `ovsdb:"external_ids"`
+	LogicalDatapath *string           `ovsdb:"logical_datapath"`
+	Match           string            `ovsdb:"match"`
+	Pipeline        string            `ovsdb:"pipeline"`
+	Priority        int               `ovsdb:"priority"`
+	TableID         int               `ovsdb:"table_id"`
+	Tags            map[string]string `ovsdb:"tags"`
+}
+
+// testLogger returns the client option that discards the libovsdb logs. Without it,
+// libovsdb sets the verbosity of its global default logger on every new client.
+func testLogger() client.Option {
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	logr := logrusr.New(log)
+	return client.WithLogger(&logr)
+}
+
+// serve serves the given databases from memory and returns the path of the unix socket.
+func serve(t *testing.T, dbs ...server.DatabaseModel) string {
+	models := map[string]*model.DBModel{}
+	for _, db := range dbs {
+		models[db.Schema.Name] = db.Model
+	}
+	srv, err := server.NewOvsdbServer(server.NewInMemoryDatabase(models), dbs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sock := filepath.Join(t.TempDir(), "db.sock")
+	go func() {
+		if err := srv.Serve("unix", sock); err != nil {
+			t.Error(err)
+		}
+	}()
+	t.Cleanup(srv.Close)
+	for i := 0; i < 100 && !srv.Ready(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return sock
+}
+
+// transact runs the operations built by ops with a new client of the given database.
+func transact(t *testing.T, sock string, dbModel *model.DBModel, ops func(client.Client) ([]ovsdb.Operation, error)) []ovsdb.OperationResult {
+	writer, err := client.NewOVSDBClient(dbModel, client.WithEndpoint("unix:"+sock), testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	if _, err := writer.MonitorAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	operations, err := ops(writer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := writer.Transact(context.Background(), operations...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opErr, err := ovsdb.CheckOperationResults(response, operations); err != nil {
+		t.Fatalf("%s: %+v", err.Error(), opErr)
+	}
+	return response
+}
+
+func TestClientStrippedTable(t *testing.T) {
+	schema := oldSchema("Logical_DP_Group", "Logical_Flow.logical_dp_group", "Encap")
+	serverModel, err := model.NewDBModel("OVN_Southbound", map[string]model.Model{
+		"Logical_Flow": &oldLogicalFlow{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sock := serve(t, server.DatabaseModel{Model: serverModel, Schema: schema})
+
+	cli, err := NewClient("OVN_Southbound", map[string]Table{
+		"Logical_Flow": {Model: &sbdb.LogicalFlow{},
+			OptionalColumns: []string{"logical_dp_group"}},
+		"Logical_DP_Group": {Model: &sbdb.LogicalDPGroup{}, Optional: true},
+	}, logrus.New(), client.WithEndpoint("unix:"+sock), testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	if cli.Has("Logical_DP_Group") || !cli.Has("Logical_Flow") {
+		t.Fatalf("unexpected tables %v", cli.dbModel.Types())
+	}
+	added := make(chan *sbdb.LogicalFlow, 1)
+	cli.AddEventHandler(&cache.EventHandlerFuncs{
+		AddFunc: func(table string, m model.Model) {
+			added <- m.(*sbdb.LogicalFlow)
+		},
+	})
+	if _, err := cli.Monitor(context.Background(), cli.NewMonitor(cli.WithTable(&sbdb.LogicalFlow{}))); err != nil {
+		t.Fatal(err)
+	}
+
+	writer, err := client.NewOVSDBClient(serverModel, client.WithEndpoint("unix:"+sock), testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	ops, err := writer.Create(&oldLogicalFlow{Match: "ip4", Actions: "drop;", Pipeline: "ingress", Priority: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Transact(context.Background(), ops...); err != nil {
+		t.Fatal(err)
+	}
+
+	var lflow *sbdb.LogicalFlow
+	select {
+	case lflow = <-added:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Logical_Flow add event not received")
+	}
+	if lflow.Match != "ip4" || lflow.LogicalDpGroup != nil {
+		t.Errorf("unexpected event row %+v", lflow)
+	}
+
+	lflows := []sbdb.LogicalFlow{}
+	if err := cli.List(&lflows); err != nil || len(lflows) != 1 || lflows[0].UUID != lflow.UUID {
+		t.Errorf("List returned %+v, %v", lflows, err)
+	}
+	got := &sbdb.LogicalFlow{UUID: lflow.UUID}
+	if err := cli.Get(got); err != nil || got.Match != "ip4" {
+		t.Errorf("Get returned %+v, %v", got, err)
+	}
+	lflows = []sbdb.LogicalFlow{}
+	err = cli.WhereCache(func(lf *sbdb.LogicalFlow) bool {
+		return lf.Priority == 10
+	}).List(&lflows)
+	if err != nil || len(lflows) != 1 || lflows[0].UUID != lflow.UUID {
+		t.Errorf("WhereCache returned %+v, %v", lflows, err)
+	}
+}
+
+// uuidSet is the set of row UUIDs of a table built from cache events.
+type uuidSet struct {
+	mutex sync.Mutex
+	uuids map[string]bool
+}
+
+func (s *uuidSet) set(uuid string, present bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if present {
+		s.uuids[uuid] = true
+	} else {
+		delete(s.uuids, uuid)
+	}
+}
+
+func (s *uuidSet) equal(uuids ...string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.uuids) != len(uuids) {
+		return false
+	}
+	for _, uuid := range uuids {
+		if !s.uuids[uuid] {
+			return false
+		}
+	}
+	return true
+}
+
+// eventually waits until cond is true.
+func eventually(t *testing.T, what string, cond func() bool) {
+	for i := 0; i < 500; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+// TestClientReconnect checks that the client reconnects when the server loses the
+// leadership and that the data built from cache events can be rebuilt afterwards,
+// including the rows deleted while disconnected.
+func TestClientReconnect(t *testing.T) {
+	sbModel, err := sbdb.FullDatabaseModel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverModel, err := serverdb.FullDatabaseModel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbSchema, serverSchema := sbdb.Schema(), serverdb.Schema()
+	sock := serve(t,
+		server.DatabaseModel{Model: sbModel, Schema: &sbSchema},
+		server.DatabaseModel{Model: serverModel, Schema: &serverSchema})
+
+	setLeader := func(leader bool) {
+		transact(t, sock, serverModel, func(writer client.Client) ([]ovsdb.Operation, error) {
+			dbs := []serverdb.Database{}
+			if err := writer.WhereCache(func(db *serverdb.Database) bool {
+				return db.Name == "OVN_Southbound"
+			}).List(&dbs); err != nil || len(dbs) == 0 {
+				return writer.Create(&serverdb.Database{
+					Name: "OVN_Southbound", Model: serverdb.DatabaseModelClustered,
+					Connected: true, Leader: leader,
+				})
+			}
+			dbs[0].Leader = leader
+			return writer.Where(&dbs[0]).Update(&dbs[0], &dbs[0].Leader)
+		})
+	}
+	lflows := []string{}
+	createLFlow := func(match string) {
+		response := transact(t, sock, sbModel, func(writer client.Client) ([]ovsdb.Operation, error) {
+			return writer.Create(&sbdb.LogicalFlow{Match: match, Actions: "drop;", Pipeline: "ingress"})
+		})
+		lflows = append(lflows, response[0].UUID.GoUUID)
+	}
+	setLeader(true)
+	createLFlow("ip4")
+	createLFlow("ip6")
+
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	cli, err := NewClient("OVN_Southbound", map[string]Table{
+		"Logical_Flow": {Model: &sbdb.LogicalFlow{}},
+	}, log, client.WithEndpoint("unix:"+sock), client.WithLeaderOnly(true), testLogger(),
+		client.WithReconnect(time.Second, backoff.NewConstantBackOff(50*time.Millisecond)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	index := &uuidSet{uuids: map[string]bool{}}
+	reconnected := make(chan struct{}, 1)
+	cli.OnReconnect(func() {
+		index.mutex.Lock()
+		index.uuids = map[string]bool{}
+		index.mutex.Unlock()
+		rows := []sbdb.LogicalFlow{}
+		if err := cli.List(&rows); err != nil {
+			t.Error(err)
+		}
+		for _, row := range rows {
+			index.set(row.UUID, true)
+		}
+		reconnected <- struct{}{}
+	})
+	cli.AddEventHandler(&cache.EventHandlerFuncs{
+		AddFunc: func(table string, m model.Model) {
+			index.set(m.(*sbdb.LogicalFlow).UUID, true)
+		},
+		DeleteFunc: func(table string, m model.Model) {
+			index.set(m.(*sbdb.LogicalFlow).UUID, false)
+		},
+	})
+	if _, err := cli.MonitorAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the initial Logical_Flows", func() bool { return index.equal(lflows...) })
+
+	// The client disconnects when the server loses the leadership and does not
+	// reconnect until it is the leader again.
+	setLeader(false)
+	eventually(t, "the client to disconnect", func() bool { return !cli.Connected() })
+	transact(t, sock, sbModel, func(writer client.Client) ([]ovsdb.Operation, error) {
+		return writer.Where(&sbdb.LogicalFlow{UUID: lflows[0]}).Delete()
+	})
+	createLFlow("arp")
+	time.Sleep(200 * time.Millisecond)
+	if cli.Connected() {
+		t.Fatal("the client reconnected to a server that is not the leader")
+	}
+	setLeader(true)
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnReconnect was not called")
+	}
+	eventually(t, "the rebuilt Logical_Flows", func() bool { return index.equal(lflows[1:]...) })
+
+	// The leadership is still monitored after reconnecting.
+	setLeader(false)
+	eventually(t, "the client to disconnect again", func() bool { return !cli.Connected() })
+}
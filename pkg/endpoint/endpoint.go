@@ -0,0 +1,227 @@
+package endpoint
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/ovn-org/libovsdb/client"
+)
+
+// Method is the OVSDB connection method (see "Connection Methods" in man(7) ovsdb).
+type Method = string
+
+const (
+	MethodTCP  Method = "tcp"
+	MethodSSL  Method = "ssl"
+	MethodUnix Method = "unix"
+)
+
+// reconnectTimeout is the timeout of each attempt to reconnect to a database.
+const reconnectTimeout = 10 * time.Second
+
+// Endpoint represents an active OVSDB connection method.
+type Endpoint struct {
+	Method Method
+	// Host and Port are only used in tcp and ssl methods.
+	Host string
+	Port string
+	// Path is only used in unix method.
+	Path string
+}
+
+// String returns the endpoint in OVSDB Connection Method format, e.g:
+// "tcp:[fd00::5]:6641".
+func (e *Endpoint) String() string {
+	if e.Method == MethodUnix {
+		return fmt.Sprintf("%s:%s", e.Method, e.Path)
+	}
+	return fmt.Sprintf("%s:%s", e.Method, e.Address())
+}
+
+// Address returns the network address of a tcp or ssl endpoint.
+func (e *Endpoint) Address() string {
+	if e.Method == MethodUnix {
+		return e.Path
+	}
+	return net.JoinHostPort(e.Host, e.Port)
+}
+
+// IsRemote returns whether the endpoint is reached through the network.
+func (e *Endpoint) IsRemote() bool {
+	return e.Method != MethodUnix
+}
+
+// Parse parses a single OVSDB connection method. IPv6 addresses must be enclosed
+// in square brackets, e.g: "ssl:[fd00::5]:6642".
+func Parse(target string) (*Endpoint, error) {
+	target = strings.TrimSpace(target)
+	parts := strings.SplitN(target, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("Malformed OVSDB target %q", target)
+	}
+	switch parts[0] {
+	case MethodUnix:
+		return &Endpoint{
+			Method: MethodUnix,
+			Path:   parts[1],
+		}, nil
+	case MethodTCP, MethodSSL:
+		host, port, err := net.SplitHostPort(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("Malformed OVSDB target %q: %s", target, err.Error())
+		}
+		if host == "" {
+			return nil, fmt.Errorf("Malformed OVSDB target %q: missing host", target)
+		}
+		if ip := net.ParseIP(host); ip == nil && strings.Contains(host, ":") {
+			return nil, fmt.Errorf("Malformed OVSDB target %q: invalid IPv6 address", target)
+		}
+		return &Endpoint{
+			Method: parts[0],
+			Host:   host,
+			Port:   port,
+		}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported OVSDB connection method %q. Only tcp, ssl and unix are supported", parts[0])
+	}
+}
+
+// ParseList parses a comma-separated list of OVSDB connection methods as
+// accepted by ovs-vsctl and ovn-nbctl, e.g: "ssl:10.0.0.1:6641,ssl:10.0.0.2:6641".
+func ParseList(targets string) ([]*Endpoint, error) {
+	endpoints := []*Endpoint{}
+	for _, target := range strings.Split(targets, ",") {
+		if strings.TrimSpace(target) == "" {
+			continue
+		}
+		ep, err := Parse(target)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, ep)
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("No OVSDB target specified")
+	}
+	return endpoints, nil
+}
+
+// TLSOptions holds the SSL/TLS files used to connect to ssl endpoints.
+type TLSOptions struct {
+	PrivateKey  string
+	Certificate string
+	CACert      string
+}
+
+// Empty returns whether no TLS option has been provided.
+func (t *TLSOptions) Empty() bool {
+	return t.PrivateKey == "" && t.Certificate == "" && t.CACert == ""
+}
+
+// Config builds a tls.Config from the TLS options.
+// Like ovs-vsctl and ovn-nbctl, the server certificate is verified against the CA
+// certificate but its hostname is not checked since OVS certificates typically do not
+// carry the server address.
+func (t *TLSOptions) Config() (*tls.Config, error) {
+	if t.PrivateKey == "" || t.Certificate == "" || t.CACert == "" {
+		return nil, fmt.Errorf("ssl connections require --private-key, --certificate and --ca-cert")
+	}
+	cert, err := tls.LoadX509KeyPair(t.Certificate, t.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load certificate and private key: %s", err.Error())
+	}
+	caPEM, err := ioutil.ReadFile(t.CACert)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read CA certificate: %s", err.Error())
+	}
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("No valid certificate found in %s", t.CACert)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      rootCAs,
+		// Hostname verification is skipped, the chain is verified below.
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyChain(rawCerts, rootCAs)
+		},
+	}, nil
+}
+
+func verifyChain(rawCerts [][]byte, rootCAs *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("Server did not present any certificate")
+	}
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         rootCAs,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+// ClientOptions returns the libovsdb client options needed to connect to the
+// (comma-separated) list of targets. TLS options are only required if any of
+// the targets uses the ssl method.
+func ClientOptions(targets string, tlsOpts *TLSOptions) ([]client.Option, error) {
+	endpoints, err := ParseList(targets)
+	if err != nil {
+		return nil, err
+	}
+	opts := []client.Option{}
+	useSSL := false
+	for _, ep := range endpoints {
+		opts = append(opts, client.WithEndpoint(ep.String()))
+		if ep.Method == MethodSSL {
+			useSSL = true
+		}
+	}
+	if useSSL {
+		if tlsOpts == nil {
+			tlsOpts = &TLSOptions{}
+		}
+		tlsConfig, err := tlsOpts.Config()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, client.WithTLSConfig(tlsConfig))
+	}
+	return opts, nil
+}
+
+// ClusterOptions returns the libovsdb client options that make the client reconnect to
+// any of its targets (e.g: another member of a RAFT cluster) if the connection is lost.
+// With leaderOnly, the client only connects to a server that reports being the leader
+// in its _Server database. libovsdb monitors the _Server database from then on and
+// disconnects, and so reconnects to another target, if the server loses the leadership.
+// The monitor is restarted with the others on every reconnection. Writes must go to the
+// leader. Standalone databases are always considered leaders.
+//
+// The cache is purged on reconnection without delete events, see dbmodel.Client.OnReconnect.
+func ClusterOptions(leaderOnly bool) []client.Option {
+	retry := backoff.NewExponentialBackOff()
+	// Keep retrying until the client is closed.
+	retry.MaxElapsedTime = 0
+	return []client.Option{
+		client.WithLeaderOnly(leaderOnly),
+		client.WithReconnect(reconnectTimeout, retry),
+	}
+}
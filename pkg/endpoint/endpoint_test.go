@@ -0,0 +1,109 @@
+package endpoint
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		endpoint *Endpoint
+		str      string
+	}{
+		{
+			name:     "tcp",
+			target:   "tcp:10.0.0.1:6641",
+			endpoint: &Endpoint{Method: MethodTCP, Host: "10.0.0.1", Port: "6641"},
+			str:      "tcp:10.0.0.1:6641",
+		},
+		{
+			name:     "ssl ipv6",
+			target:   " ssl:[fd00::5]:6642",
+			endpoint: &Endpoint{Method: MethodSSL, Host: "fd00::5", Port: "6642"},
+			str:      "ssl:[fd00::5]:6642",
+		},
+		{
+			name:     "hostname",
+			target:   "ssl:ovnkube-db.ovn-kubernetes.svc:6641",
+			endpoint: &Endpoint{Method: MethodSSL, Host: "ovnkube-db.ovn-kubernetes.svc", Port: "6641"},
+			str:      "ssl:ovnkube-db.ovn-kubernetes.svc:6641",
+		},
+		{
+			name:     "unix",
+			target:   "unix:/var/run/ovn/ovnnb_db.sock",
+			endpoint: &Endpoint{Method: MethodUnix, Path: "/var/run/ovn/ovnnb_db.sock"},
+			str:      "unix:/var/run/ovn/ovnnb_db.sock",
+		},
+		{name: "ipv6 without brackets", target: "tcp:fd00::5:6641"},
+		{name: "invalid ipv6", target: "tcp:[fd00::zz]:6641"},
+		{name: "missing host", target: "tcp::6641"},
+		{name: "missing port", target: "tcp:10.0.0.1"},
+		{name: "missing path", target: "unix:"},
+		{name: "no method", target: "10.0.0.1"},
+		{name: "passive method", target: "ptcp:6641"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep, err := Parse(tt.target)
+			if tt.endpoint == nil {
+				if err == nil {
+					t.Errorf("Parse(%q) = %+v, want an error", tt.target, ep)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %s", tt.target, err)
+			}
+			if !reflect.DeepEqual(ep, tt.endpoint) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.target, ep, tt.endpoint)
+			}
+			if ep.String() != tt.str {
+				t.Errorf("String() = %s, want %s", ep.String(), tt.str)
+			}
+		})
+	}
+}
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		name      string
+		targets   string
+		endpoints []string
+	}{
+		{
+			name:      "cluster",
+			targets:   "ssl:10.0.0.1:6641,ssl:10.0.0.2:6641, ssl:[fd00::3]:6641",
+			endpoints: []string{"ssl:10.0.0.1:6641", "ssl:10.0.0.2:6641", "ssl:[fd00::3]:6641"},
+		},
+		{
+			name:      "empty entries",
+			targets:   "unix:/run/ovn/ovnnb_db.sock,,",
+			endpoints: []string{"unix:/run/ovn/ovnnb_db.sock"},
+		},
+		{name: "empty", targets: " , "},
+		{name: "one malformed", targets: "tcp:10.0.0.1:6641,tcp:10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eps, err := ParseList(tt.targets)
+			if tt.endpoints == nil {
+				if err == nil {
+					t.Errorf("ParseList(%q) = %v, want an error", tt.targets, eps)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseList(%q) failed: %s", tt.targets, err)
+			}
+			strs := []string{}
+			for _, ep := range eps {
+				strs = append(strs, ep.String())
+			}
+			if !reflect.DeepEqual(strs, tt.endpoints) {
+				t.Errorf("ParseList(%q) = %v, want %v", tt.targets, strs, tt.endpoints)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package flowmon
 
 import (
 	"fmt"
+	"math"
 	"reflect"
 )
 
@@ -10,8 +11,12 @@ type FlowAggregate struct {
 	Keys  []string
 	Flows []*FlowInfo
 
-	TotalBytes   DecUint64
-	TotalPackets DecUint64
+	// TotalBytes and TotalPackets are estimated from the samples and their sampling
+	// rate. SampledBytes and SampledPackets are the raw counters.
+	TotalBytes     DecUint64
+	TotalPackets   DecUint64
+	SampledBytes   DecUint64
+	SampledPackets DecUint64
 
 	LastTimeReceived   DecUint64
 	FirstTimeReceived  DecUint64
@@ -22,6 +27,9 @@ type FlowAggregate struct {
 	LastDeltaBps int
 
 	LastForwardingStatus uint32
+
+	estimatedBytes   float64
+	estimatedPackets float64
 }
 
 func NewFlowAggregate(keys []string) *FlowAggregate {
@@ -31,6 +39,15 @@ func NewFlowAggregate(keys []string) *FlowAggregate {
 	}
 }
 
+// Copy returns a copy of the aggregate that is not modified when more flows are
+// appended to it. The FlowInfos are shared.
+func (fa *FlowAggregate) Copy() *FlowAggregate {
+	agg := *fa
+	agg.Keys = append([]string{}, fa.Keys...)
+	agg.Flows = append([]*FlowInfo{}, fa.Flows...)
+	return &agg
+}
+
 // Append appends the FlowInfo to the current Aggregate
 func (fa *FlowAggregate) AppendIfMatches(flowInfo *FlowInfo) (bool, error) {
 	match, err := fa.matches(flowInfo)
@@ -42,8 +59,16 @@ func (fa *FlowAggregate) AppendIfMatches(flowInfo *FlowInfo) (bool, error) {
 	}
 	fa.LastForwardingStatus = flowInfo.ForwardingStatus
 
-	fa.TotalBytes += DecUint64(flowInfo.Bytes)
-	fa.TotalPackets += DecUint64(flowInfo.Packets)
+	rate := flowInfo.SamplingRate
+	if rate < 1 {
+		rate = 1
+	}
+	fa.SampledBytes += flowInfo.Bytes
+	fa.SampledPackets += flowInfo.Packets
+	fa.estimatedBytes += float64(flowInfo.Bytes) * rate
+	fa.estimatedPackets += float64(flowInfo.Packets) * rate
+	fa.TotalBytes = DecUint64(math.Round(fa.estimatedBytes))
+	fa.TotalPackets = DecUint64(math.Round(fa.estimatedPackets))
 
 	if fa.FirstTimeReceived == 0 {
 		fa.FirstTimeReceived = DecUint64(flowInfo.TimeReceived)
@@ -104,7 +129,7 @@ func (fa *FlowAggregate) Less(fieldName string, other *FlowAggregate) (bool, err
 		return false, err
 	}
 	switch thisV.(type) {
-	case uint32, uint64, HexUint32, DecUint32, DecUint64:
+	case uint32, uint64, HexUint32, DecUint32, DecUint64, HexUint64:
 		return reflect.ValueOf(thisV).Uint() < reflect.ValueOf(otherV).Uint(), nil
 	default:
 		return fmt.Sprint(thisV) < fmt.Sprint(otherV), nil
@@ -112,6 +137,12 @@ func (fa *FlowAggregate) Less(fieldName string, other *FlowAggregate) (bool, err
 
 }
 
+// Estimated returns whether the counters of the aggregate have been compensated for
+// sampling.
+func (fa *FlowAggregate) Estimated() bool {
+	return fa.TotalPackets != fa.SampledPackets || fa.TotalBytes != fa.SampledBytes
+}
+
 func (fa *FlowAggregate) isAggregate(fieldName string) bool {
 	for _, k := range fa.Keys {
 		if k == fieldName {
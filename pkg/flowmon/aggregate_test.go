@@ -0,0 +1,44 @@
+package flowmon
+
+import "testing"
+
+func TestFlowAggregateSamplingRate(t *testing.T) {
+	tests := []struct {
+		name      string
+		rates     []float64
+		packets   DecUint64
+		bytes     DecUint64
+		estimated bool
+	}{
+		{name: "not sampled", rates: []float64{1, 1}, packets: 2, bytes: 200},
+		{name: "unset rate", rates: []float64{0}, packets: 1, bytes: 100},
+		{name: "sampled", rates: []float64{10, 10, 10}, packets: 30, bytes: 3000, estimated: true},
+		{name: "rate changed", rates: []float64{1, 2.5, 2.5}, packets: 6, bytes: 600, estimated: true},
+		{name: "fractional", rates: []float64{1.5}, packets: 2, bytes: 150, estimated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agg := NewFlowAggregate([]string{"Proto"})
+			for _, rate := range tt.rates {
+				ok, err := agg.AppendIfMatches(&FlowInfo{
+					Key:          &FlowKey{Proto: ProtoTCP},
+					Packets:      1,
+					Bytes:        100,
+					SamplingRate: rate,
+				})
+				if !ok || err != nil {
+					t.Fatalf("AppendIfMatches() = %v, %v", ok, err)
+				}
+			}
+			if agg.TotalPackets != tt.packets || agg.TotalBytes != tt.bytes {
+				t.Errorf("Total = %d packets, %d bytes, want %d, %d", agg.TotalPackets, agg.TotalBytes, tt.packets, tt.bytes)
+			}
+			if n := DecUint64(len(tt.rates)); agg.SampledPackets != n || agg.SampledBytes != 100*n {
+				t.Errorf("Sampled = %d packets, %d bytes, want %d, %d", agg.SampledPackets, agg.SampledBytes, n, 100*n)
+			}
+			if agg.Estimated() != tt.estimated {
+				t.Errorf("Estimated() = %v, want %v", agg.Estimated(), tt.estimated)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package flowmon
 
 import (
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"net"
 	"reflect"
@@ -58,6 +59,7 @@ const (
 	ProtoTCP    Proto = 0x6
 	ProtoUDP    Proto = 0x11
 	ProtoICMPv6 Proto = 0x3A
+	ProtoSCTP   Proto = 0x84
 )
 
 func (p Proto) String() string {
@@ -70,6 +72,8 @@ func (p Proto) String() string {
 		return "UDP"
 	case ProtoICMPv6:
 		return "ICMPv6"
+	case ProtoSCTP:
+		return "SCTP"
 	default:
 		return fmt.Sprintf("0x%x", int(p))
 	}
@@ -96,13 +100,44 @@ func (h DecUint64) String() string {
 	return fmt.Sprintf("%d", int(h))
 }
 
+// HexUint64 is an integer that prefers to be printed in hexadecimal format
+type HexUint64 uint64
+
+func (h HexUint64) String() string {
+	return fmt.Sprintf("0x%x", uint64(h))
+}
+
+// HexBytes is an opaque value that is printed in hexadecimal format
+type HexBytes []byte
+
+func (h HexBytes) String() string {
+	if len(h) == 0 {
+		return ""
+	}
+	return "0x" + hex.EncodeToString(h)
+}
+
 // FlowKey is the struct of common fields that conform a flow
 type FlowKey struct {
+	// Exporter information
+	Chassis string
+
 	FlowDirection FlowDirection
 
 	// Interfaces
 	InIf  DecUint32
 	OutIf DecUint32
+	// OVS Interface information
+	InIfName       string
+	InIfType       string
+	InIfaceID      string
+	InAttachedMac  string
+	InVMID         string
+	OutIfName      string
+	OutIfType      string
+	OutIfaceID     string
+	OutAttachedMac string
+	OutVMID        string
 	// Ethernet Header
 	SrcMac net.HardwareAddr
 	DstMac net.HardwareAddr
@@ -124,15 +159,58 @@ type FlowKey struct {
 	ICMPType HexUint32
 	ICMPCode HexUint32
 
+	// Tunnel information (OVS enterprise elements)
+	TunnelType    TunnelType
+	TunnelKey     DecUint64
+	TunnelSrc     net.IP
+	TunnelDst     net.IP
+	TunnelSrcPort DecUint32
+	TunnelDstPort DecUint32
+	VirtualObsID  string
+
 	// OVN Extra information
-	LFUUID     string
-	LFMatch    string
-	LFActions  string
-	LFPipeline string
-	LFStage    string
-	DPType     string
-	DPName     string
-	OFTable    DecUint32
+	LFUUID        string
+	LFMatch       string
+	LFActions     string
+	LFPipeline    string
+	LFStage       string
+	LFAmbiguity   string
+	NBDescription string
+	DPType        string
+	DPName        string
+	OFTable       DecUint32
+	OFTableName   string
+	OFTableDesc   string
+
+	// OVN Logical Port information
+	SrcLPort        string
+	SrcLPortType    string
+	SrcLPortChassis string
+	SrcLPortExtIDs  string
+	DstLPort        string
+	DstLPortType    string
+	DstLPortChassis string
+	DstLPortExtIDs  string
+
+	// OVN Chassis the flow was tunneled from and to
+	SrcChassis string
+	DstChassis string
+
+	// OVN ACL sampling information
+	ACLName   string
+	ACLAction string
+	ACLSample string
+
+	// OVN-Kubernetes information
+	SrcPod       string
+	SrcNamespace string
+	SrcNode      string
+	DstPod       string
+	DstNamespace string
+	DstNode      string
+
+	// Custom holds the fields decoded with a user-defined Mapping, indexed by name.
+	Custom map[string]interface{}
 }
 
 // GetFieldString returns the string representation of the given fieldName
@@ -144,11 +222,15 @@ func (fk *FlowKey) GetFieldString(fieldName string) (string, error) {
 	return fmt.Sprintf("%s", val), nil
 }
 
-// GetField returns the value of a given fieldName
+// GetField returns the value of a given fieldName. Custom fields are looked up if the
+// FlowKey has no such field.
 func (fk *FlowKey) GetField(fieldName string) (interface{}, error) {
 	flowKeyV := reflect.ValueOf(fk).Elem()
 	field := flowKeyV.FieldByName(fieldName)
 	if !field.IsValid() {
+		if value, ok := fk.Custom[fieldName]; ok {
+			return value, nil
+		}
 		return "", fmt.Errorf("Failed to get Field %s from FlowKey", fieldName)
 	}
 	return field.Interface(), nil
@@ -160,30 +242,72 @@ func (fk *FlowKey) Matches(other *FlowKey, mask []string) (bool, error) {
 	if len(mask) == 0 {
 		return reflect.DeepEqual(fk, other), nil
 	}
-	thisV := reflect.ValueOf(fk).Elem()
-	otherV := reflect.ValueOf(other).Elem()
 	for _, fieldName := range mask {
-		thisField := thisV.FieldByName(fieldName)
-		otherField := otherV.FieldByName(fieldName)
-		if !thisField.IsValid() || !otherField.IsValid() {
+		thisField, err := fk.GetField(fieldName)
+		if err != nil {
+			return false, fmt.Errorf("Comparison error. Field %s is not present in FlowKey", fieldName)
+		}
+		otherField, err := other.GetField(fieldName)
+		if err != nil {
 			return false, fmt.Errorf("Comparison error. Field %s is not present in FlowKey", fieldName)
 		}
-		if !reflect.DeepEqual(thisField.Interface(), otherField.Interface()) {
+		if !reflect.DeepEqual(thisField, otherField) {
 			return false, nil
 		}
 	}
 	return true, nil
 }
 
-// Fills extra information from map. Supported extra info: OVN.
+// Fills extra information from map. Supported extra info: Chassis, OVS Interfaces, OVN.
 func (fk *FlowKey) fillExtra(extra map[string]interface{}) {
+	if data, ok := extra["Chassis"]; ok {
+		fk.Chassis = data.(string)
+	}
+	for name, field := range map[string]*string{
+		"InIfName":        &fk.InIfName,
+		"InIfType":        &fk.InIfType,
+		"InIfaceID":       &fk.InIfaceID,
+		"InAttachedMac":   &fk.InAttachedMac,
+		"InVMID":          &fk.InVMID,
+		"OutIfName":       &fk.OutIfName,
+		"OutIfType":       &fk.OutIfType,
+		"OutIfaceID":      &fk.OutIfaceID,
+		"OutAttachedMac":  &fk.OutAttachedMac,
+		"OutVMID":         &fk.OutVMID,
+		"SrcLPort":        &fk.SrcLPort,
+		"SrcLPortType":    &fk.SrcLPortType,
+		"SrcLPortChassis": &fk.SrcLPortChassis,
+		"SrcLPortExtIDs":  &fk.SrcLPortExtIDs,
+		"DstLPort":        &fk.DstLPort,
+		"DstLPortType":    &fk.DstLPortType,
+		"DstLPortChassis": &fk.DstLPortChassis,
+		"DstLPortExtIDs":  &fk.DstLPortExtIDs,
+		"SrcChassis":      &fk.SrcChassis,
+		"DstChassis":      &fk.DstChassis,
+		"SrcPod":          &fk.SrcPod,
+		"SrcNamespace":    &fk.SrcNamespace,
+		"SrcNode":         &fk.SrcNode,
+		"DstPod":          &fk.DstPod,
+		"DstNamespace":    &fk.DstNamespace,
+		"DstNode":         &fk.DstNode,
+		"NBDescription":   &fk.NBDescription,
+		"OFTableName":     &fk.OFTableName,
+		"OFTableDesc":     &fk.OFTableDesc,
+		"ACLName":         &fk.ACLName,
+		"ACLAction":       &fk.ACLAction,
+		"ACLSample":       &fk.ACLSample,
+	} {
+		if data, ok := extra[name]; ok {
+			*field = data.(string)
+		}
+	}
 	if data, ok := extra["LFUUID"]; ok {
 		fk.LFUUID = data.(string)
 	}
 	if data, ok := extra["LFMatch"]; ok {
 		fk.LFMatch = data.(string)
 	}
-	if data, ok := extra["LFAction"]; ok {
+	if data, ok := extra["LFActions"]; ok {
 		fk.LFActions = data.(string)
 	}
 	if data, ok := extra["LFPipeline"]; ok {
@@ -192,6 +316,9 @@ func (fk *FlowKey) fillExtra(extra map[string]interface{}) {
 	if data, ok := extra["LFStage"]; ok {
 		fk.LFStage = data.(string)
 	}
+	if data, ok := extra["LFAmbiguity"]; ok {
+		fk.LFAmbiguity = data.(string)
+	}
 	if data, ok := extra["DPType"]; ok {
 		fk.DPType = data.(string)
 	}
@@ -201,9 +328,14 @@ func (fk *FlowKey) fillExtra(extra map[string]interface{}) {
 	if data, ok := extra["OFTable"]; ok {
 		fk.OFTable = DecUint32(data.(int))
 	}
+	if data, ok := extra[customFieldsExtra]; ok {
+		fk.Custom = data.(map[string]interface{})
+	}
 }
 
-func macFromUint64(uintMac uint64) net.HardwareAddr {
+// MacFromUint64 returns the MAC address encoded in the lower 48 bits of a FlowMessage's
+// SrcMac or DstMac.
+func MacFromUint64(uintMac uint64) net.HardwareAddr {
 	mac := make([]byte, 8)
 	binary.BigEndian.PutUint64(mac, uintMac)
 	return net.HardwareAddr(mac[2:])
@@ -219,6 +351,9 @@ type FlowInfo struct {
 
 	Bytes   DecUint64
 	Packets DecUint64
+	// SamplingRate is the number of packets each sampled packet represents. Enrichers
+	// can set it through the "SamplingRate" extra field. Defaults to 1.
+	SamplingRate float64
 
 	TimeReceived DecUint64
 
@@ -233,8 +368,8 @@ func NewFlowInfo(msg *flowmessage.FlowMessage, extra map[string]interface{}) *Fl
 		FlowDirection: FlowDirection(msg.FlowDirection),
 		InIf:          DecUint32(msg.InIf),
 		OutIf:         DecUint32(msg.OutIf),
-		SrcMac:        macFromUint64(msg.SrcMac),
-		DstMac:        macFromUint64(msg.DstMac),
+		SrcMac:        MacFromUint64(msg.SrcMac),
+		DstMac:        MacFromUint64(msg.DstMac),
 		Etype:         Etype(msg.Etype),
 		VlanID:        DecUint32(msg.VlanId),
 		SrcAddr:       ipFromBytes(msg.SrcAddr),
@@ -247,7 +382,12 @@ func NewFlowInfo(msg *flowmessage.FlowMessage, extra map[string]interface{}) *Fl
 		ICMPType:      HexUint32(msg.IcmpType),
 		ICMPCode:      HexUint32(msg.IcmpCode),
 	}
+	key.fillTunnel(msg)
 	key.fillExtra(extra)
+	samplingRate := 1.0
+	if data, ok := extra["SamplingRate"]; ok {
+		samplingRate = data.(float64)
+	}
 	return &FlowInfo{
 		Key:              key,
 		TimeReceived:     DecUint64(msg.TimeReceived),
@@ -255,6 +395,7 @@ func NewFlowInfo(msg *flowmessage.FlowMessage, extra map[string]interface{}) *Fl
 		TimeFlowEnd:      DecUint64(msg.TimeFlowEnd),
 		Bytes:            DecUint64(msg.Bytes),
 		Packets:          DecUint64(msg.Packets),
+		SamplingRate:     samplingRate,
 		ForwardingStatus: msg.ForwardingStatus,
 	}
 }
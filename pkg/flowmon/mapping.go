@@ -0,0 +1,299 @@
+package flowmon
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	flowmessage "github.com/netsampler/goflow2/pb"
+	"github.com/netsampler/goflow2/producer"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// customFieldsExtra is the extra field the values decoded by a Mapping are passed in.
+const customFieldsExtra = "CustomFields"
+
+// Types of the fields of a Mapping.
+const (
+	FieldTypeUint   = "uint"
+	FieldTypeIP     = "ip"
+	FieldTypeMAC    = "mac"
+	FieldTypeString = "string"
+	FieldTypeBytes  = "bytes"
+)
+
+// Display formats of the fields of a Mapping.
+const (
+	FieldFormatDec = "dec"
+	FieldFormatHex = "hex"
+)
+
+// fieldNameRe matches the valid names of custom fields.
+var fieldNameRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// reservedFieldNames are the names of the columns that are not part of the FlowKey.
+var reservedFieldNames = []string{"TotalBytes", "TotalPackets", "Rate(kbps)", "LastTimeReceived"}
+
+// MappingField is an IPFIX information element decoded into a custom field. Custom fields
+// are not part of the FlowKey struct: they are kept in its Custom map and looked up by name.
+type MappingField struct {
+	// Name is the name of the field (column).
+	Name string `yaml:"name"`
+	// PEN is the Private Enterprise Number of the element, 0 for IANA elements.
+	PEN uint32 `yaml:"pen"`
+	// ID is the information element ID.
+	ID uint16 `yaml:"id"`
+	// Type is how the value is decoded: uint, ip, mac, string or bytes.
+	Type string `yaml:"type"`
+	// Format is how uint and bytes values are displayed: dec (uint only) or hex.
+	Format string `yaml:"format"`
+
+	// destination is the custom field of the goflow2 FlowMessage the value is stored in.
+	destination string
+	// truncated is set once a too long uint value has been logged.
+	truncated int32
+}
+
+// Mapping is a set of user-defined IPFIX information elements that are decoded into
+// custom fields. It implements the netflow.Enricher interface.
+type Mapping struct {
+	// OVS is whether the OVS elements (OVSMapping) are decoded too. Defaults to true.
+	// Disabling them leaves more custom fields of the FlowMessage for the Mapping.
+	OVS    *bool          `yaml:"ovs"`
+	Fields []MappingField `yaml:"fields"`
+}
+
+// LoadMapping reads a Mapping from a YAML file, e.g:
+//
+//	ovs: false
+//	fields:
+//	  - name: MplsLabel
+//	    id: 70
+//	    type: uint
+//	  - name: AppName
+//	    pen: 12345
+//	    id: 1
+//	    type: string
+func LoadMapping(path string) (*Mapping, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	mapping := &Mapping{}
+	if err := yaml.UnmarshalStrict(data, mapping); err != nil {
+		return nil, fmt.Errorf("Failed to parse IPFIX mapping %s: %s", path, err.Error())
+	}
+	if err := mapping.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid IPFIX mapping %s: %s", path, err.Error())
+	}
+	return mapping, nil
+}
+
+// DecodesOVS returns whether the OVS elements are decoded along with the Mapping ones.
+// m can be nil.
+func (m *Mapping) DecodesOVS() bool {
+	return m == nil || m.OVS == nil || *m.OVS
+}
+
+// MappingCapacity returns how many fields a Mapping can have, with or without the OVS
+// elements, and how many of them can be of a type other than uint.
+func MappingCapacity(ovs bool) (fields int, nonUint int) {
+	integers, bytes := freeDestinations(ovs)
+	return len(integers) + len(bytes), len(bytes)
+}
+
+// freeDestinations returns the custom fields of the goflow2 FlowMessage that are not used
+// by OVSMapping if ovs is true, or all of them otherwise.
+func freeDestinations(ovs bool) (integers []string, bytes []string) {
+	used := map[string]bool{}
+	if ovs {
+		for _, field := range OVSMapping {
+			used[field.Destination] = true
+		}
+	}
+	msgType := reflect.TypeOf(flowmessage.FlowMessage{})
+	for i := 0; i < msgType.NumField(); i++ {
+		name := msgType.Field(i).Name
+		if used[name] {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(name, "CustomInteger"):
+			integers = append(integers, name)
+		case strings.HasPrefix(name, "CustomBytes"):
+			bytes = append(bytes, name)
+		}
+	}
+	return integers, bytes
+}
+
+// validate checks the fields and assigns each of them a custom field of the goflow2
+// FlowMessage. uint fields prefer integer custom fields but can also be decoded from
+// bytes ones, as long as the element is at most 8 bytes long.
+func (m *Mapping) validate() error {
+	ovs := m.DecodesOVS()
+	integers, bytes := freeDestinations(ovs)
+	maxFields, maxNonUint := MappingCapacity(ovs)
+	names := map[string]bool{}
+	for _, name := range reservedFieldNames {
+		names[name] = true
+	}
+	keyType := reflect.TypeOf(FlowKey{})
+	for i := 0; i < keyType.NumField(); i++ {
+		names[keyType.Field(i).Name] = true
+	}
+	elements := map[string]bool{}
+	if ovs {
+		for _, field := range OVSMapping {
+			elements[fmt.Sprintf("%d/%d", field.Pen, field.Type)] = true
+		}
+	}
+	for i := range m.Fields {
+		field := &m.Fields[i]
+		if !fieldNameRe.MatchString(field.Name) {
+			return fmt.Errorf("invalid field name %q", field.Name)
+		}
+		if names[field.Name] {
+			return fmt.Errorf("field name %s is already used", field.Name)
+		}
+		names[field.Name] = true
+		element := fmt.Sprintf("%d/%d", field.PEN, field.ID)
+		if elements[element] {
+			return fmt.Errorf("%s: information element %s is already mapped", field.Name, element)
+		}
+		elements[element] = true
+
+		switch field.Type {
+		case FieldTypeUint:
+			if field.Format == "" {
+				field.Format = FieldFormatDec
+			}
+			if field.Format != FieldFormatDec && field.Format != FieldFormatHex {
+				return fmt.Errorf("%s: unsupported format %q for type %s", field.Name, field.Format, field.Type)
+			}
+			if len(integers) > 0 {
+				field.destination, integers = integers[0], integers[1:]
+				continue
+			}
+		case FieldTypeBytes:
+			if field.Format == "" {
+				field.Format = FieldFormatHex
+			}
+			if field.Format != FieldFormatHex {
+				return fmt.Errorf("%s: unsupported format %q for type %s", field.Name, field.Format, field.Type)
+			}
+		case FieldTypeIP, FieldTypeMAC, FieldTypeString:
+			if field.Format != "" {
+				return fmt.Errorf("%s: type %s does not support formats", field.Name, field.Type)
+			}
+		default:
+			return fmt.Errorf("%s: unsupported type %q", field.Name, field.Type)
+		}
+		if len(bytes) == 0 {
+			along := ""
+			if ovs {
+				along = " along with the OVS elements"
+			}
+			return fmt.Errorf("%s: too many fields, at most %d can be decoded%s, only %d of them of a type other than uint",
+				field.Name, maxFields, along, maxNonUint)
+		}
+		field.destination, bytes = bytes[0], bytes[1:]
+	}
+	return nil
+}
+
+// Names returns the names of the custom fields.
+func (m *Mapping) Names() []string {
+	names := make([]string, 0, len(m.Fields))
+	for _, field := range m.Fields {
+		names = append(names, field.Name)
+	}
+	return names
+}
+
+// NetFlowMapFields returns the goflow2 custom field mapping that decodes the OVS elements
+// (unless disabled) and the ones of the Mapping. m can be nil.
+func (m *Mapping) NetFlowMapFields() []producer.NetFlowMapField {
+	fields := []producer.NetFlowMapField{}
+	if m.DecodesOVS() {
+		fields = append(fields, OVSMapping...)
+	}
+	if m == nil {
+		return fields
+	}
+	for i := range m.Fields {
+		field := &m.Fields[i]
+		fields = append(fields, producer.NetFlowMapField{
+			PenProvided: field.PEN != 0,
+			Pen:         field.PEN,
+			Type:        field.ID,
+			Destination: field.destination,
+		})
+	}
+	return fields
+}
+
+// decode returns the value of the field stored in the FlowMessage and clears it. A uint
+// field decoded from a value longer than 8 bytes is returned as 0 along with an error.
+func (f *MappingField) decode(msg *flowmessage.FlowMessage) (interface{}, error) {
+	raw := reflect.ValueOf(msg).Elem().FieldByName(f.destination)
+	var number uint64
+	var data []byte
+	var err error
+	if raw.Kind() == reflect.Uint64 {
+		number = raw.Uint()
+	} else {
+		data = raw.Bytes()
+		if len(data) <= 8 {
+			buf := make([]byte, 8)
+			copy(buf[8-len(data):], data)
+			number = binary.BigEndian.Uint64(buf)
+		} else if f.Type == FieldTypeUint {
+			err = fmt.Errorf("%s: %d bytes long value does not fit in a uint", f.Name, len(data))
+		}
+	}
+	raw.Set(reflect.Zero(raw.Type()))
+	return f.value(number, data), err
+}
+
+// value returns the typed value of the field.
+func (f *MappingField) value(number uint64, data []byte) interface{} {
+	switch f.Type {
+	case FieldTypeUint:
+		if f.Format == FieldFormatHex {
+			return HexUint64(number)
+		}
+		return DecUint64(number)
+	case FieldTypeIP:
+		return net.IP(data)
+	case FieldTypeMAC:
+		return net.HardwareAddr(data)
+	case FieldTypeString:
+		return strings.TrimRight(string(data), "\x00")
+	default:
+		return HexBytes(data)
+	}
+}
+
+// Enrich implements netflow.Enricher. It decodes the custom fields of the FlowMessage,
+// which are then available in the Custom map of the FlowKey. The decoded custom fields are
+// cleared so that they are not mistaken for OVS elements if those are not decoded.
+func (m *Mapping) Enrich(msg *flowmessage.FlowMessage, extra map[string]interface{}, log *logrus.Logger) map[string]interface{} {
+	values := make(map[string]interface{}, len(m.Fields))
+	for i := range m.Fields {
+		field := &m.Fields[i]
+		value, err := field.decode(msg)
+		if err != nil && atomic.CompareAndSwapInt32(&field.truncated, 0, 1) {
+			log.Warningf("IPFIX mapping: %s, check the type of the field", err.Error())
+		}
+		values[field.Name] = value
+	}
+	extra[customFieldsExtra] = values
+	return extra
+}
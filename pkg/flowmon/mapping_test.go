@@ -0,0 +1,263 @@
+package flowmon
+
+import (
+	"io/ioutil"
+	"net"
+	"reflect"
+	"testing"
+
+	flowmessage "github.com/netsampler/goflow2/pb"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMappingCapacity(t *testing.T) {
+	tests := []struct {
+		ovs     bool
+		fields  int
+		nonUint int
+	}{
+		{ovs: true, fields: 3, nonUint: 2},
+		{ovs: false, fields: 10, nonUint: 5},
+	}
+	for _, tt := range tests {
+		fields, nonUint := MappingCapacity(tt.ovs)
+		if fields != tt.fields || nonUint != tt.nonUint {
+			t.Errorf("MappingCapacity(%v) = %d, %d, want %d, %d", tt.ovs, fields, nonUint, tt.fields, tt.nonUint)
+		}
+	}
+}
+
+func TestMappingValidate(t *testing.T) {
+	noOVS := false
+	uintField := func(name string, id uint16) MappingField {
+		return MappingField{Name: name, ID: id, Type: FieldTypeUint}
+	}
+	ipField := func(name string, id uint16) MappingField {
+		return MappingField{Name: name, ID: id, Type: FieldTypeIP}
+	}
+	tests := []struct {
+		name         string
+		mapping      Mapping
+		destinations []string
+		formats      []string
+		err          string
+	}{
+		{
+			name:         "uint prefers integers",
+			mapping:      Mapping{Fields: []MappingField{uintField("A", 1), uintField("B", 2), ipField("C", 3)}},
+			destinations: []string{"CustomInteger5", "CustomBytes4", "CustomBytes5"},
+			formats:      []string{FieldFormatDec, FieldFormatDec, ""},
+		},
+		{
+			name: "default formats",
+			mapping: Mapping{Fields: []MappingField{
+				{Name: "A", ID: 1, Type: FieldTypeUint, Format: FieldFormatHex},
+				{Name: "B", ID: 2, Type: FieldTypeBytes},
+			}},
+			destinations: []string{"CustomInteger5", "CustomBytes4"},
+			formats:      []string{FieldFormatHex, FieldFormatHex},
+		},
+		{
+			name:    "too many fields",
+			mapping: Mapping{Fields: []MappingField{uintField("A", 1), ipField("B", 2), ipField("C", 3), uintField("D", 4)}},
+			err:     "D: too many fields, at most 3 can be decoded along with the OVS elements, only 2 of them of a type other than uint",
+		},
+		{
+			name:    "too many non uint fields",
+			mapping: Mapping{Fields: []MappingField{ipField("A", 1), ipField("B", 2), ipField("C", 3)}},
+			err:     "C: too many fields, at most 3 can be decoded along with the OVS elements, only 2 of them of a type other than uint",
+		},
+		{
+			name: "without OVS elements",
+			mapping: Mapping{OVS: &noOVS, Fields: []MappingField{
+				uintField("A", 1), uintField("B", 2), uintField("C", 3), uintField("D", 4), uintField("E", 5),
+				uintField("F", 6), ipField("G", 7),
+			}},
+			destinations: []string{"CustomInteger1", "CustomInteger2", "CustomInteger3", "CustomInteger4",
+				"CustomInteger5", "CustomBytes1", "CustomBytes2"},
+		},
+		{
+			name: "OVS element mapped without OVS elements",
+			mapping: Mapping{OVS: &noOVS, Fields: []MappingField{
+				{Name: "TunKey", PEN: VMwarePEN, ID: ovsTunnelKey, Type: FieldTypeUint},
+			}},
+			destinations: []string{"CustomInteger1"},
+		},
+		{
+			name:    "OVS element",
+			mapping: Mapping{Fields: []MappingField{{Name: "TunKey", PEN: VMwarePEN, ID: ovsTunnelKey, Type: FieldTypeUint}}},
+			err:     "TunKey: information element 6876/892 is already mapped",
+		},
+		{
+			name:    "duplicated element",
+			mapping: Mapping{Fields: []MappingField{uintField("A", 1), uintField("B", 1)}},
+			err:     "B: information element 0/1 is already mapped",
+		},
+		{
+			name:    "FlowKey field name",
+			mapping: Mapping{Fields: []MappingField{uintField("SrcPort", 1)}},
+			err:     "field name SrcPort is already used",
+		},
+		{
+			name:    "reserved name",
+			mapping: Mapping{Fields: []MappingField{uintField("TotalBytes", 1)}},
+			err:     "field name TotalBytes is already used",
+		},
+		{
+			name:    "invalid name",
+			mapping: Mapping{Fields: []MappingField{uintField("1abc", 1)}},
+			err:     `invalid field name "1abc"`,
+		},
+		{
+			name:    "unsupported type",
+			mapping: Mapping{Fields: []MappingField{{Name: "A", ID: 1, Type: "float"}}},
+			err:     `A: unsupported type "float"`,
+		},
+		{
+			name:    "unsupported format",
+			mapping: Mapping{Fields: []MappingField{{Name: "A", ID: 1, Type: FieldTypeBytes, Format: FieldFormatDec}}},
+			err:     `A: unsupported format "dec" for type bytes`,
+		},
+		{
+			name:    "format of ip",
+			mapping: Mapping{Fields: []MappingField{{Name: "A", ID: 1, Type: FieldTypeIP, Format: FieldFormatHex}}},
+			err:     "A: type ip does not support formats",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.mapping.validate()
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("validate() = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validate() = %v", err)
+			}
+			for i, field := range tt.mapping.Fields {
+				if field.destination != tt.destinations[i] {
+					t.Errorf("%s: destination = %s, want %s", field.Name, field.destination, tt.destinations[i])
+				}
+				if tt.formats != nil && field.Format != tt.formats[i] {
+					t.Errorf("%s: format = %s, want %s", field.Name, field.Format, tt.formats[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMappingFieldDecode(t *testing.T) {
+	// decode clears the custom field, so every test needs its own message.
+	msg := func() *flowmessage.FlowMessage {
+		return &flowmessage.FlowMessage{
+			CustomInteger5: 0xabcd,
+			CustomBytes4:   []byte{0x01, 0x02},
+			CustomBytes5:   []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09},
+		}
+	}
+	ipv4 := []byte{10, 0, 0, 1}
+	mac := []byte{0x0a, 0x58, 0x0a, 0xf4, 0x00, 0x05}
+	tests := []struct {
+		name  string
+		field MappingField
+		msg   *flowmessage.FlowMessage
+		value interface{}
+		err   bool
+	}{
+		{
+			name:  "uint",
+			field: MappingField{Type: FieldTypeUint, Format: FieldFormatDec, destination: "CustomInteger5"},
+			msg:   msg(),
+			value: DecUint64(0xabcd),
+		},
+		{
+			name:  "hex uint",
+			field: MappingField{Type: FieldTypeUint, Format: FieldFormatHex, destination: "CustomInteger5"},
+			msg:   msg(),
+			value: HexUint64(0xabcd),
+		},
+		{
+			name:  "uint from bytes",
+			field: MappingField{Type: FieldTypeUint, Format: FieldFormatDec, destination: "CustomBytes4"},
+			msg:   msg(),
+			value: DecUint64(0x0102),
+		},
+		{
+			name:  "uint from too many bytes",
+			field: MappingField{Name: "A", Type: FieldTypeUint, Format: FieldFormatDec, destination: "CustomBytes5"},
+			msg:   msg(),
+			value: DecUint64(0),
+			err:   true,
+		},
+		{
+			name:  "bytes",
+			field: MappingField{Type: FieldTypeBytes, Format: FieldFormatHex, destination: "CustomBytes5"},
+			msg:   msg(),
+			value: HexBytes{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09},
+		},
+		{
+			name:  "ip",
+			field: MappingField{Type: FieldTypeIP, destination: "CustomBytes1"},
+			msg:   &flowmessage.FlowMessage{CustomBytes1: ipv4},
+			value: net.IP(ipv4),
+		},
+		{
+			name:  "mac",
+			field: MappingField{Type: FieldTypeMAC, destination: "CustomBytes1"},
+			msg:   &flowmessage.FlowMessage{CustomBytes1: mac},
+			value: net.HardwareAddr(mac),
+		},
+		{
+			name:  "string",
+			field: MappingField{Type: FieldTypeString, destination: "CustomBytes1"},
+			msg:   &flowmessage.FlowMessage{CustomBytes1: []byte("http\x00\x00")},
+			value: "http",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := tt.field.decode(tt.msg)
+			if (err != nil) != tt.err {
+				t.Errorf("decode() error = %v, want error %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(value, tt.value) {
+				t.Errorf("decode() = %#v, want %#v", value, tt.value)
+			}
+			if !reflect.ValueOf(tt.msg).Elem().FieldByName(tt.field.destination).IsZero() {
+				t.Errorf("%s was not cleared", tt.field.destination)
+			}
+		})
+	}
+}
+
+func TestMappingEnrich(t *testing.T) {
+	noOVS := false
+	mapping := &Mapping{OVS: &noOVS, Fields: []MappingField{
+		{Name: "A", ID: 1, Type: FieldTypeUint},
+		{Name: "B", ID: 2, Type: FieldTypeString},
+	}}
+	if err := mapping.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if fields := mapping.NetFlowMapFields(); len(fields) != 2 {
+		t.Errorf("NetFlowMapFields() has %d fields, want 2", len(fields))
+	}
+	// Without the OVS elements, the mapped values must not end up in the tunnel fields.
+	msg := &flowmessage.FlowMessage{CustomInteger1: 7, CustomBytes1: []byte("app")}
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	info := NewFlowInfo(msg, mapping.Enrich(msg, map[string]interface{}{}, log))
+	if info.Key.TunnelType != TunnelTypeNone || info.Key.TunnelSrc != nil {
+		t.Errorf("mapped values decoded as tunnel fields: %v %v", info.Key.TunnelType, info.Key.TunnelSrc)
+	}
+	for name, want := range map[string]string{"A": "7", "B": "app"} {
+		if value, err := info.Key.GetFieldString(name); err != nil || value != want {
+			t.Errorf("GetFieldString(%s) = %q, %v, want %q", name, value, err, want)
+		}
+	}
+	if fields := (*Mapping)(nil).NetFlowMapFields(); !reflect.DeepEqual(fields, OVSMapping) {
+		t.Errorf("NetFlowMapFields() of nil Mapping = %v, want OVSMapping", fields)
+	}
+}
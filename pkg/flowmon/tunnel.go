@@ -0,0 +1,96 @@
+package flowmon
+
+import (
+	"fmt"
+	"net"
+
+	flowmessage "github.com/netsampler/goflow2/pb"
+	"github.com/netsampler/goflow2/producer"
+)
+
+// VMwarePEN is the Private Enterprise Number of the IPFIX information elements OVS
+// exports on top of the IANA ones (see ipfix-enterprise-entities.def in OVS).
+const VMwarePEN = 6876
+
+// OVS enterprise information elements.
+const (
+	ovsTunnelType            = 891
+	ovsTunnelKey             = 892
+	ovsTunnelSourceIPv4      = 893
+	ovsTunnelDestinationIPv4 = 894
+	ovsTunnelSourcePort      = 896
+	ovsTunnelDestinationPort = 897
+	ovsVirtualObsID          = 898
+	ovsTunnelSourceIPv6      = 899
+	ovsTunnelDestinationIPv6 = 900
+)
+
+// OVSMapping maps the OVS enterprise information elements to the custom fields of the
+// goflow2 FlowMessage they are decoded into. OVS exports the tunnel elements on tunnel
+// ports if enable-tunnel-sampling is set in the IPFIX (or Flow_Sample_Collector_Set)
+// configuration, which is the default.
+var OVSMapping = []producer.NetFlowMapField{
+	{PenProvided: true, Pen: VMwarePEN, Type: ovsTunnelType, Destination: "CustomInteger1"},
+	{PenProvided: true, Pen: VMwarePEN, Type: ovsTunnelKey, Destination: "CustomInteger2"},
+	{PenProvided: true, Pen: VMwarePEN, Type: ovsTunnelSourcePort, Destination: "CustomInteger3"},
+	{PenProvided: true, Pen: VMwarePEN, Type: ovsTunnelDestinationPort, Destination: "CustomInteger4"},
+	{PenProvided: true, Pen: VMwarePEN, Type: ovsTunnelSourceIPv4, Destination: "CustomBytes1"},
+	{PenProvided: true, Pen: VMwarePEN, Type: ovsTunnelSourceIPv6, Destination: "CustomBytes1"},
+	{PenProvided: true, Pen: VMwarePEN, Type: ovsTunnelDestinationIPv4, Destination: "CustomBytes2"},
+	{PenProvided: true, Pen: VMwarePEN, Type: ovsTunnelDestinationIPv6, Destination: "CustomBytes2"},
+	{PenProvided: true, Pen: VMwarePEN, Type: ovsVirtualObsID, Destination: "CustomBytes3"},
+}
+
+// TunnelType is an enum for the tunnel types reported by OVS
+type TunnelType uint32
+
+const (
+	TunnelTypeNone   TunnelType = 0x0
+	TunnelTypeVXLAN  TunnelType = 0x1
+	TunnelTypeGRE    TunnelType = 0x2
+	TunnelTypeLISP   TunnelType = 0x3
+	TunnelTypeSTT    TunnelType = 0x4
+	TunnelTypeGeneve TunnelType = 0x7
+)
+
+func (t TunnelType) String() string {
+	switch t {
+	case TunnelTypeNone:
+		return ""
+	case TunnelTypeVXLAN:
+		return "VXLAN"
+	case TunnelTypeGRE:
+		return "GRE"
+	case TunnelTypeLISP:
+		return "LISP"
+	case TunnelTypeSTT:
+		return "STT"
+	case TunnelTypeGeneve:
+		return "Geneve"
+	default:
+		return fmt.Sprintf("0x%x", int(t))
+	}
+}
+
+// TunnelAddresses returns the outer source and destination addresses of a tunneled flow
+// as decoded with OVSMapping. They are nil if the sample was not taken on a tunnel port.
+func TunnelAddresses(msg *flowmessage.FlowMessage) (net.IP, net.IP) {
+	return tunnelIP(msg.CustomBytes1), tunnelIP(msg.CustomBytes2)
+}
+
+func tunnelIP(ipBytes []byte) net.IP {
+	if len(ipBytes) != net.IPv4len && len(ipBytes) != net.IPv6len {
+		return nil
+	}
+	return net.IP(ipBytes)
+}
+
+// fillTunnel fills the tunnel and OVS specific fields decoded with OVSMapping.
+func (fk *FlowKey) fillTunnel(msg *flowmessage.FlowMessage) {
+	fk.TunnelType = TunnelType(msg.CustomInteger1)
+	fk.TunnelKey = DecUint64(msg.CustomInteger2)
+	fk.TunnelSrc, fk.TunnelDst = TunnelAddresses(msg)
+	fk.TunnelSrcPort = DecUint32(msg.CustomInteger3)
+	fk.TunnelDstPort = DecUint32(msg.CustomInteger4)
+	fk.VirtualObsID = string(msg.CustomBytes3)
+}
@@ -0,0 +1,135 @@
+package flowmon
+
+import (
+	"net"
+	"testing"
+
+	"github.com/netsampler/goflow2/decoders/netflow"
+	flowmessage "github.com/netsampler/goflow2/pb"
+	"github.com/netsampler/goflow2/producer"
+)
+
+// ipfixMessage runs an IPFIX data record with the given fields through the goflow2
+// producer configured with the mapping, as the collector does.
+func ipfixMessage(t *testing.T, mapping *Mapping, fields []netflow.DataField) *flowmessage.FlowMessage {
+	packet := netflow.IPFIXPacket{
+		Version:             10,
+		ObservationDomainId: 1,
+		FlowSets: []interface{}{
+			netflow.DataFlowSet{
+				FlowSetHeader: netflow.FlowSetHeader{Id: 256},
+				Records:       []netflow.DataRecord{{Values: fields}},
+			},
+		},
+	}
+	config := producer.NewProducerConfigMapped(&producer.ProducerConfig{
+		IPFIX: producer.IPFIXProducerConfig{Mapping: mapping.NetFlowMapFields()},
+	})
+	msgs, err := producer.ProcessMessageNetFlowConfig(packet, nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("%d messages decoded, want 1", len(msgs))
+	}
+	return msgs[0]
+}
+
+func TestTunnelDecode(t *testing.T) {
+	ovs := func(id uint16, value []byte) netflow.DataField {
+		return netflow.DataField{PenProvided: true, Pen: VMwarePEN, Type: id, Value: value}
+	}
+	noOVS := false
+	tests := []struct {
+		name    string
+		mapping *Mapping
+		fields  []netflow.DataField
+		key     FlowKey
+	}{
+		{
+			name: "geneve ipv4",
+			fields: []netflow.DataField{
+				ovs(ovsTunnelType, []byte{0x07}),
+				ovs(ovsTunnelKey, []byte{0x00, 0x00, 0x05, 0x01}),
+				ovs(ovsTunnelSourceIPv4, []byte{172, 18, 0, 2}),
+				ovs(ovsTunnelDestinationIPv4, []byte{172, 18, 0, 3}),
+				ovs(ovsTunnelSourcePort, []byte{0xc3, 0x50}),
+				ovs(ovsTunnelDestinationPort, []byte{0x17, 0xc1}),
+				ovs(ovsVirtualObsID, []byte("ovn-k8s")),
+			},
+			key: FlowKey{
+				TunnelType:    TunnelTypeGeneve,
+				TunnelKey:     0x501,
+				TunnelSrc:     net.IP{172, 18, 0, 2},
+				TunnelDst:     net.IP{172, 18, 0, 3},
+				TunnelSrcPort: 50000,
+				TunnelDstPort: 6081,
+				VirtualObsID:  "ovn-k8s",
+			},
+		},
+		{
+			name: "vxlan ipv6",
+			fields: []netflow.DataField{
+				ovs(ovsTunnelType, []byte{0x01}),
+				ovs(ovsTunnelKey, []byte{0x00, 0x00, 0x64}),
+				ovs(ovsTunnelSourceIPv6, net.ParseIP("fd00::2")),
+				ovs(ovsTunnelDestinationIPv6, net.ParseIP("fd00::3")),
+			},
+			key: FlowKey{
+				TunnelType: TunnelTypeVXLAN,
+				TunnelKey:  100,
+				TunnelSrc:  net.ParseIP("fd00::2"),
+				TunnelDst:  net.ParseIP("fd00::3"),
+			},
+		},
+		{
+			name: "not tunneled",
+			fields: []netflow.DataField{
+				{Type: netflow.NFV9_FIELD_IN_BYTES, Value: []byte{0x00, 0x40}},
+			},
+		},
+		{
+			name:    "ovs elements disabled",
+			mapping: &Mapping{OVS: &noOVS},
+			fields: []netflow.DataField{
+				ovs(ovsTunnelType, []byte{0x07}),
+				ovs(ovsTunnelSourceIPv4, []byte{172, 18, 0, 2}),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := ipfixMessage(t, tt.mapping, tt.fields)
+			key := NewFlowInfo(msg, nil).Key
+			if key.TunnelType != tt.key.TunnelType || key.TunnelKey != tt.key.TunnelKey ||
+				!key.TunnelSrc.Equal(tt.key.TunnelSrc) || !key.TunnelDst.Equal(tt.key.TunnelDst) ||
+				key.TunnelSrcPort != tt.key.TunnelSrcPort || key.TunnelDstPort != tt.key.TunnelDstPort ||
+				key.VirtualObsID != tt.key.VirtualObsID {
+				t.Errorf("tunnel = %s %d %s:%d -> %s:%d %q, want %s %d %s:%d -> %s:%d %q",
+					key.TunnelType, key.TunnelKey, key.TunnelSrc, key.TunnelSrcPort, key.TunnelDst,
+					key.TunnelDstPort, key.VirtualObsID, tt.key.TunnelType, tt.key.TunnelKey, tt.key.TunnelSrc,
+					tt.key.TunnelSrcPort, tt.key.TunnelDst, tt.key.TunnelDstPort, tt.key.VirtualObsID)
+			}
+		})
+	}
+}
+
+func TestTunnelTypeString(t *testing.T) {
+	tests := []struct {
+		tunnel TunnelType
+		str    string
+	}{
+		{tunnel: TunnelTypeNone, str: ""},
+		{tunnel: TunnelTypeVXLAN, str: "VXLAN"},
+		{tunnel: TunnelTypeGRE, str: "GRE"},
+		{tunnel: TunnelTypeLISP, str: "LISP"},
+		{tunnel: TunnelTypeSTT, str: "STT"},
+		{tunnel: TunnelTypeGeneve, str: "Geneve"},
+		{tunnel: TunnelType(0x9), str: "0x9"},
+	}
+	for _, tt := range tests {
+		if str := tt.tunnel.String(); str != tt.str {
+			t.Errorf("TunnelType(%d).String() = %q, want %q", uint32(tt.tunnel), str, tt.str)
+		}
+	}
+}
@@ -1,12 +1,14 @@
 package netflow
 
 import (
+	"amorenoz/ovs-flowmon/pkg/flowmon"
 	"context"
 	"net/url"
 	"strconv"
 
 	"github.com/netsampler/goflow2/format"
 	flowmessage "github.com/netsampler/goflow2/pb"
+	"github.com/netsampler/goflow2/producer"
 	"github.com/netsampler/goflow2/utils"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/protobuf/proto"
@@ -17,6 +19,7 @@ type NFReader struct {
 	workers    int
 	url        *url.URL
 	log        *logrus.Logger
+	mapping    *flowmon.Mapping
 }
 
 // Consumer is the interface that must be implemented to consume the NetFlow data.
@@ -83,6 +86,16 @@ func NewNFReader(workers int, address string, consumer Consumer, enrichers []Enr
 
 }
 
+// SetMapping makes the reader decode the information elements of the mapping, on top of
+// the OVS ones unless the mapping disables them. Must be called before Listen.
+func (r *NFReader) SetMapping(mapping *flowmon.Mapping) {
+	if mapping == nil {
+		return
+	}
+	r.mapping = mapping
+	r.dispatcher.enrichers = append([]Enricher{mapping}, r.dispatcher.enrichers...)
+}
+
 // Read starts listening to the configured address. Can (and should) be run from
 // within a goroutine.
 func (r *NFReader) Listen() {
@@ -104,6 +117,13 @@ func (r *NFReader) Listen() {
 		Format:    formatter,
 		Transport: &r.dispatcher,
 		Logger:    r.log,
+		// Decode the OVS tunnel and enterprise information elements (unless disabled) and
+		// the mapped ones.
+		Config: &producer.ProducerConfig{
+			IPFIX: producer.IPFIXProducerConfig{
+				Mapping: r.mapping.NetFlowMapFields(),
+			},
+		},
 	}
 	err = sNF.FlowRoutine(r.workers, hostname, int(port), false)
 
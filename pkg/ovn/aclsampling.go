@@ -0,0 +1,697 @@
+package ovn
+
+import (
+	"amorenoz/ovs-flowmon/pkg/dbmodel"
+	"amorenoz/ovs-flowmon/pkg/endpoint"
+	"amorenoz/ovs-flowmon/pkg/ovn/nbdb"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/bombsimon/logrusr/v2"
+	flowmessage "github.com/netsampler/goflow2/pb"
+	"github.com/ovn-org/libovsdb/cache"
+	"github.com/ovn-org/libovsdb/client"
+	"github.com/ovn-org/libovsdb/model"
+	"github.com/ovn-org/libovsdb/ovsdb"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// MaxACLSampleProbability samples every packet (probability is expressed in units of
+	// 1/65535).
+	MaxACLSampleProbability = 65535
+	// DefaultACLSampleProbability is the probability ACLs are sampled with by default.
+	DefaultACLSampleProbability = MaxACLSampleProbability
+	// ACLSamplingCollectorName is the name of the Sample_Collector created by ovs-flowmon.
+	ACLSamplingCollectorName = "ovs-flowmon"
+)
+
+// ACLSelector selects the ACLs to sample. An ACL is selected if it matches any of the
+// values of each non-empty criteria. An empty selector selects all ACLs.
+type ACLSelector struct {
+	// PortGroups are names (or OVN-Kubernetes external_ids:name) of Port Groups.
+	PortGroups []string
+	Names      []string
+	Tiers      []int
+}
+
+// Empty returns whether the selector selects all ACLs.
+func (s *ACLSelector) Empty() bool {
+	return len(s.PortGroups) == 0 && len(s.Names) == 0 && len(s.Tiers) == 0
+}
+
+func (s *ACLSelector) matches(acl *nbdb.ACL, portGroups []string) bool {
+	if len(s.Names) > 0 {
+		found := false
+		for _, name := range s.Names {
+			if acl.Name != nil && *acl.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(s.Tiers) > 0 {
+		found := false
+		for _, tier := range s.Tiers {
+			if acl.Tier == tier {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(s.PortGroups) > 0 {
+		found := false
+		for _, selected := range s.PortGroups {
+			for _, pg := range portGroups {
+				if pg == selected {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// aclSample is the ACL an observation point corresponds to.
+type aclSample struct {
+	acl string
+	// kind is "new" for samples of new connections and "est" for samples of
+	// established ones.
+	kind string
+}
+
+// aclSampleIndex maps the observation domain and point IDs of ACL samples to the ACLs
+// they correspond to. Like the nbIndex, it is kept up to date by a cache event handler.
+//
+// OVN sets the Sample metadata as the observation point ID and the ID of the acl-new or
+// acl-est Sampling_App in the 8 most significant bits of the observation domain ID. The
+// domain is not checked if the NB database has no Sampling_App table.
+type aclSampleIndex struct {
+	mutex sync.RWMutex
+	// checkDomain is whether the observation domain ID is checked.
+	checkDomain bool
+	// samples maps the Sample metadata to the UUIDs of the Samples.
+	samples map[uint32]string
+	// acls maps Sample UUIDs to the ACL they are used by.
+	acls map[string]aclSample
+	// apps maps the Sampling_App IDs to the kind of ACL sample they are used for.
+	apps map[uint32]string
+	// sampleCollectors maps Sample UUIDs to the UUIDs of their Sample_Collectors.
+	sampleCollectors map[string][]string
+	// collectors maps Sample_Collector UUIDs to the collectors.
+	collectors map[string]sampleCollector
+	// owners keeps the Port Groups and Logical Switches each ACL is applied on.
+	owners *nbIndex
+}
+
+func newACLSampleIndex() *aclSampleIndex {
+	i := &aclSampleIndex{owners: newNBIndex()}
+	i.reset()
+	return i
+}
+
+// reset removes everything from the index.
+func (i *aclSampleIndex) reset() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.samples = make(map[uint32]string)
+	i.acls = make(map[string]aclSample)
+	i.apps = make(map[uint32]string)
+	i.sampleCollectors = make(map[string][]string)
+	i.collectors = make(map[string]sampleCollector)
+	i.owners.reset()
+}
+
+// sampleCollector is the Flow_Sample_Collector_Set a Sample_Collector sends samples to
+// and the probability it samples packets with.
+type sampleCollector struct {
+	setID       int
+	probability int
+}
+
+// aclSampleKinds maps the Sampling_App types used for ACLs to the kind of ACL sample.
+var aclSampleKinds = map[string]string{
+	nbdb.SamplingAppTypeACLNew: "new",
+	nbdb.SamplingAppTypeACLEst: "est",
+}
+
+func (i *aclSampleIndex) addRow(table string, m model.Model) {
+	switch table {
+	case "Port_Group", "Logical_Switch":
+		i.owners.addRow(table, m)
+		return
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	switch row := m.(type) {
+	case *nbdb.ACL:
+		if row.SampleNew != nil {
+			i.acls[*row.SampleNew] = aclSample{acl: row.UUID, kind: "new"}
+		}
+		if row.SampleEst != nil {
+			i.acls[*row.SampleEst] = aclSample{acl: row.UUID, kind: "est"}
+		}
+	case *nbdb.Sample:
+		i.samples[uint32(row.Metadata)] = row.UUID
+		i.sampleCollectors[row.UUID] = row.Collectors
+	case *nbdb.SampleCollector:
+		i.collectors[row.UUID] = sampleCollector{setID: row.SetID, probability: row.Probability}
+	case *nbdb.SamplingApp:
+		if kind, ok := aclSampleKinds[row.Type]; ok {
+			i.apps[uint32(row.ID)] = kind
+		}
+	}
+}
+
+func (i *aclSampleIndex) deleteRow(table string, m model.Model) {
+	switch table {
+	case "Port_Group", "Logical_Switch":
+		i.owners.deleteRow(table, m)
+		return
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	switch row := m.(type) {
+	case *nbdb.ACL:
+		for _, sample := range []*string{row.SampleNew, row.SampleEst} {
+			if sample != nil && i.acls[*sample].acl == row.UUID {
+				delete(i.acls, *sample)
+			}
+		}
+	case *nbdb.Sample:
+		if i.samples[uint32(row.Metadata)] == row.UUID {
+			delete(i.samples, uint32(row.Metadata))
+		}
+		delete(i.sampleCollectors, row.UUID)
+	case *nbdb.SampleCollector:
+		delete(i.collectors, row.UUID)
+	case *nbdb.SamplingApp:
+		if _, ok := aclSampleKinds[row.Type]; ok {
+			delete(i.apps, uint32(row.ID))
+		}
+	}
+}
+
+// lookup returns the ACL sample with the given observation domain and point IDs.
+func (i *aclSampleIndex) lookup(domainID, point uint32) (aclSample, bool) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	sample, ok := i.acls[i.samples[point]]
+	if !ok {
+		return sample, false
+	}
+	if i.checkDomain && i.apps[domainID>>24] != sample.kind {
+		return aclSample{}, false
+	}
+	return sample, true
+}
+
+// samplingRate returns the number of packets each sample with the given observation point
+// ID represents, i.e. the inverse of the probability of the Sample's collector that sends
+// samples to the Flow_Sample_Collector_Set setID. It returns 1 if there is no such
+// collector.
+func (i *aclSampleIndex) samplingRate(point uint32, setID int) float64 {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	for _, uuid := range i.sampleCollectors[i.samples[point]] {
+		if c, ok := i.collectors[uuid]; ok && c.setID == setID && c.probability > 0 {
+			return float64(MaxACLSampleProbability) / float64(c.probability)
+		}
+	}
+	return 1
+}
+
+// eventHandler returns the cache event handler that keeps the index up to date.
+func (i *aclSampleIndex) eventHandler() cache.EventHandler {
+	return &cache.EventHandlerFuncs{
+		AddFunc: func(table string, newModel model.Model) {
+			i.addRow(table, newModel)
+		},
+		UpdateFunc: func(table string, oldModel, newModel model.Model) {
+			i.deleteRow(table, oldModel)
+			i.addRow(table, newModel)
+		},
+		DeleteFunc: func(table string, oldModel model.Model) {
+			i.deleteRow(table, oldModel)
+		},
+	}
+}
+
+// aclRestore holds the sampling configuration of an ACL before ovs-flowmon changed it.
+type aclRestore struct {
+	sampleNew *string
+	sampleEst *string
+}
+
+// ACLSampler configures per-ACL sampling through the NB Sample and Sample_Collector tables
+// and implements the netflow.Enricher interface to map samples back to ACLs.
+type ACLSampler struct {
+	nb    *dbmodel.Client
+	log   *logrus.Logger
+	index *aclSampleIndex
+
+	// setID is the Flow_Sample_Collector_Set the samples are sent to.
+	setID int
+	// Configuration added by ovs-flowmon, removed on Close.
+	collector string
+	samples   []string
+	apps      []string
+	acls      map[string]aclRestore
+}
+
+// NewACLSampler returns a new ACLSampler. nbStr can be a comma-separated list of OVSDB
+// connection methods.
+func NewACLSampler(nbStr string, tlsOpts *endpoint.TLSOptions, log *logrus.Logger) (*ACLSampler, error) {
+	logr := logrusr.New(log)
+	opts, err := endpoint.ClientOptions(nbStr, tlsOpts)
+	if err != nil {
+		return nil, err
+	}
+	// Sample, Sample_Collector and the ACL sample columns are only available in recent
+	// OVN versions. Samples are written to the NB database, so connect to the cluster
+	// leader.
+	opts = append(opts, endpoint.ClusterOptions(true)...)
+	nb, err := dbmodel.NewClient("OVN_Northbound", aclSamplingTables, log, append(opts, client.WithLogger(&logr))...)
+	if err != nil {
+		return nil, err
+	}
+	return newACLSampler(nb, log), nil
+}
+
+// aclSamplingTables are the NB tables the ACLSampler reads and writes.
+var aclSamplingTables = map[string]dbmodel.Table{
+	"ACL":              {Model: &nbdb.ACL{}},
+	"Address_Set":      {Model: &nbdb.AddressSet{}, Optional: true},
+	"Logical_Switch":   {Model: &nbdb.LogicalSwitch{}},
+	"Port_Group":       {Model: &nbdb.PortGroup{}},
+	"Sample":           {Model: &nbdb.Sample{}},
+	"Sample_Collector": {Model: &nbdb.SampleCollector{}},
+	"Sampling_App":     {Model: &nbdb.SamplingApp{}, Optional: true},
+}
+
+// newACLSampler returns an ACLSampler that uses the given NB client.
+func newACLSampler(nb *dbmodel.Client, log *logrus.Logger) *ACLSampler {
+	return &ACLSampler{
+		nb:    nb,
+		log:   log,
+		index: newACLSampleIndex(),
+		acls:  make(map[string]aclRestore),
+	}
+}
+
+// Start connects to the NB database and monitors the tables needed for ACL sampling.
+func (s *ACLSampler) Start() error {
+	if s.nb.Connected() {
+		return nil
+	}
+	if err := s.nb.Connect(context.Background()); err != nil {
+		return err
+	}
+	s.index.checkDomain = s.nb.Has("Sampling_App")
+	s.nb.OnReconnect(func() {
+		s.index.reset()
+		if err := s.buildIndex(); err != nil {
+			s.log.Error(err)
+		}
+	})
+	s.nb.AddEventHandler(s.index.eventHandler())
+	if _, err := s.nb.MonitorAll(context.TODO()); err != nil {
+		return fmt.Errorf("Failed to monitor the NB database, does this OVN version support ACL sampling? %s", err.Error())
+	}
+	return s.buildIndex()
+}
+
+// buildIndex adds all the NB rows in the cache to the index.
+func (s *ACLSampler) buildIndex() error {
+	acls := []nbdb.ACL{}
+	samples := []nbdb.Sample{}
+	collectors := []nbdb.SampleCollector{}
+	apps := []nbdb.SamplingApp{}
+	pgs := []nbdb.PortGroup{}
+	lss := []nbdb.LogicalSwitch{}
+	lists := []interface{}{&acls, &samples, &collectors, &pgs, &lss}
+	if s.nb.Has("Sampling_App") {
+		lists = append(lists, &apps)
+	}
+	for _, list := range lists {
+		if err := s.nb.List(list); err != nil {
+			return err
+		}
+	}
+	for i := range acls {
+		s.index.addRow("ACL", &acls[i])
+	}
+	for i := range samples {
+		s.index.addRow("Sample", &samples[i])
+	}
+	for i := range collectors {
+		s.index.addRow("Sample_Collector", &collectors[i])
+	}
+	for i := range apps {
+		s.index.addRow("Sampling_App", &apps[i])
+	}
+	for i := range pgs {
+		s.index.addRow("Port_Group", &pgs[i])
+	}
+	for i := range lss {
+		s.index.addRow("Logical_Switch", &lss[i])
+	}
+	return nil
+}
+
+// aclPortGroups returns, for each ACL UUID, the names of the Port Groups it is applied
+// on, including the OVN-Kubernetes external_ids:name.
+func (s *ACLSampler) aclPortGroups() (map[string][]string, error) {
+	pgs := []nbdb.PortGroup{}
+	if err := s.nb.List(&pgs); err != nil {
+		return nil, err
+	}
+	names := map[string][]string{}
+	for _, pg := range pgs {
+		for _, acl := range pg.ACLs {
+			names[acl] = append(names[acl], pg.Name)
+			if name := pg.ExternalIDs["name"]; name != "" {
+				names[acl] = append(names[acl], name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// CollectorSetIDs returns the OVS Flow_Sample_Collector_Set IDs used by the
+// Sample_Collectors not created by ovs-flowmon.
+func (s *ACLSampler) CollectorSetIDs() ([]int, error) {
+	if !s.nb.Connected() {
+		return nil, fmt.Errorf("Client not connected")
+	}
+	collectors := []nbdb.SampleCollector{}
+	if err := s.nb.List(&collectors); err != nil {
+		return nil, err
+	}
+	ids := []int{}
+	for _, c := range collectors {
+		if c.Name != ACLSamplingCollectorName {
+			ids = append(ids, c.SetID)
+		}
+	}
+	return ids, nil
+}
+
+// Configure creates a Sample_Collector that sends samples to the OVS
+// Flow_Sample_Collector_Set collectorSetID and a Sample for new and established
+// connections of each selected ACL.
+func (s *ACLSampler) Configure(selector *ACLSelector, probability, collectorSetID int) error {
+	if !s.nb.Connected() {
+		return fmt.Errorf("Client not connected")
+	}
+	if err := checkProbability(probability); err != nil {
+		return err
+	}
+	acls := []nbdb.ACL{}
+	if err := s.nb.List(&acls); err != nil {
+		return err
+	}
+	pgNames, err := s.aclPortGroups()
+	if err != nil {
+		return err
+	}
+	selected := []nbdb.ACL{}
+	for _, acl := range acls {
+		if selector.matches(&acl, pgNames[acl.UUID]) {
+			selected = append(selected, acl)
+		}
+	}
+	if len(selected) == 0 {
+		return fmt.Errorf("No ACL matches the selection")
+	}
+
+	// Collector IDs and Sample metadata must be unique.
+	collectors := []nbdb.SampleCollector{}
+	if err := s.nb.List(&collectors); err != nil {
+		return err
+	}
+	usedIDs := map[int]bool{}
+	for _, c := range collectors {
+		usedIDs[c.ID] = true
+	}
+	collectorID := 0
+	for id := 1; id < 256; id++ {
+		if !usedIDs[id] {
+			collectorID = id
+			break
+		}
+	}
+	if collectorID == 0 {
+		return fmt.Errorf("No free Sample_Collector ID")
+	}
+	samples := []nbdb.Sample{}
+	if err := s.nb.List(&samples); err != nil {
+		return err
+	}
+	nextMetadata := 1
+	for _, sample := range samples {
+		if sample.Metadata >= nextMetadata {
+			nextMetadata = sample.Metadata + 1
+		}
+	}
+
+	collectorName := "flowmonCollector"
+	collector := &nbdb.SampleCollector{
+		UUID:        collectorName,
+		ID:          collectorID,
+		Name:        ACLSamplingCollectorName,
+		Probability: probability,
+		SetID:       collectorSetID,
+	}
+	ops, err := s.nb.Create(collector)
+	if err != nil {
+		return err
+	}
+	appOps, err := s.samplingAppOps()
+	if err != nil {
+		return err
+	}
+	ops = append(ops, appOps...)
+	restore := map[string]aclRestore{}
+	for i := range selected {
+		acl := &selected[i]
+		restore[acl.UUID] = aclRestore{sampleNew: acl.SampleNew, sampleEst: acl.SampleEst}
+		sampleNew := fmt.Sprintf("flowmonSampleNew%d", i)
+		sampleEst := fmt.Sprintf("flowmonSampleEst%d", i)
+		createOps, err := s.nb.Create(
+			&nbdb.Sample{UUID: sampleNew, Collectors: []string{collectorName}, Metadata: nextMetadata},
+			&nbdb.Sample{UUID: sampleEst, Collectors: []string{collectorName}, Metadata: nextMetadata + 1})
+		if err != nil {
+			return err
+		}
+		nextMetadata += 2
+		acl.SampleNew = &sampleNew
+		acl.SampleEst = &sampleEst
+		updateOps, err := s.nb.Where(acl).Update(acl, &acl.SampleNew, &acl.SampleEst)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, createOps...)
+		ops = append(ops, updateOps...)
+	}
+
+	response, err := s.nb.Transact(context.TODO(), ops...)
+	logFields := logrus.Fields{
+		"operation": ops,
+		"response":  response,
+		"err":       err,
+	}
+	s.log.WithFields(logFields).Debug("OVN ACL sampling configuration")
+	if err != nil {
+		return err
+	}
+	if opErr, err := ovsdb.CheckOperationResults(response, ops); err != nil {
+		return fmt.Errorf("%s: %+v", err.Error(), opErr)
+	}
+	for i, op := range ops {
+		if op.Op != ovsdb.OperationInsert {
+			continue
+		}
+		switch op.Table {
+		case "Sample_Collector":
+			s.collector = response[i].UUID.GoUUID
+		case "Sampling_App":
+			s.apps = append(s.apps, response[i].UUID.GoUUID)
+		default:
+			s.samples = append(s.samples, response[i].UUID.GoUUID)
+		}
+	}
+	for uuid, r := range restore {
+		if _, ok := s.acls[uuid]; !ok {
+			s.acls[uuid] = r
+		}
+	}
+	s.setID = collectorSetID
+	s.log.Infof("OVN ACL sampling: Enabled on %d ACLs", len(selected))
+	return nil
+}
+
+func checkProbability(probability int) error {
+	if probability <= 0 || probability > MaxACLSampleProbability {
+		return fmt.Errorf("Invalid sampling probability %d, it must be between 1 and %d", probability, MaxACLSampleProbability)
+	}
+	return nil
+}
+
+// SetProbability changes the probability the selected ACLs are sampled with.
+func (s *ACLSampler) SetProbability(probability int) error {
+	if err := checkProbability(probability); err != nil {
+		return err
+	}
+	if s.collector == "" {
+		return fmt.Errorf("ACL sampling is not configured")
+	}
+	collector := &nbdb.SampleCollector{UUID: s.collector, Probability: probability}
+	ops, err := s.nb.Where(collector).Update(collector, &collector.Probability)
+	if err != nil {
+		return err
+	}
+	response, err := s.nb.Transact(context.TODO(), ops...)
+	if err != nil {
+		return err
+	}
+	if opErr, err := ovsdb.CheckOperationResults(response, ops); err != nil {
+		return fmt.Errorf("%s: %+v", err.Error(), opErr)
+	}
+	s.log.Infof("OVN ACL sampling: Probability set to %d", probability)
+	return nil
+}
+
+// samplingAppOps returns the operations that create the acl-new and acl-est Sampling_Apps
+// if they do not exist: OVN needs their IDs to build the observation domain ID of ACL
+// samples.
+func (s *ACLSampler) samplingAppOps() ([]ovsdb.Operation, error) {
+	if !s.nb.Has("Sampling_App") {
+		return nil, nil
+	}
+	apps := []nbdb.SamplingApp{}
+	if err := s.nb.List(&apps); err != nil {
+		return nil, err
+	}
+	usedIDs := map[int]bool{}
+	exists := map[string]bool{}
+	for _, app := range apps {
+		usedIDs[app.ID] = true
+		exists[app.Type] = true
+	}
+	ops := []ovsdb.Operation{}
+	id := 1
+	for i, appType := range []string{nbdb.SamplingAppTypeACLNew, nbdb.SamplingAppTypeACLEst} {
+		if exists[appType] {
+			continue
+		}
+		for id < 256 && usedIDs[id] {
+			id++
+		}
+		if id == 256 {
+			return nil, fmt.Errorf("No free Sampling_App ID")
+		}
+		usedIDs[id] = true
+		createOps, err := s.nb.Create(&nbdb.SamplingApp{UUID: fmt.Sprintf("flowmonApp%d", i), Type: appType, ID: id})
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, createOps...)
+	}
+	return ops, nil
+}
+
+// Close removes the sampling configuration added by Configure and closes the connection.
+func (s *ACLSampler) Close() error {
+	pending := len(s.acls) > 0 || len(s.samples) > 0 || len(s.apps) > 0 || s.collector != ""
+	if pending && !waitConnected(s.nb, closeReconnectTimeout) {
+		s.log.Errorf("Not connected to the OVN NB database: the sampling configuration of %d ACLs was not restored", len(s.acls))
+		s.nb.Close()
+		return nil
+	}
+	ops := []ovsdb.Operation{}
+	for uuid, r := range s.acls {
+		acl := &nbdb.ACL{UUID: uuid}
+		if err := s.nb.Get(acl); err != nil {
+			continue
+		}
+		acl.SampleNew = r.sampleNew
+		acl.SampleEst = r.sampleEst
+		updateOps, err := s.nb.Where(acl).Update(acl, &acl.SampleNew, &acl.SampleEst)
+		if err != nil {
+			s.log.Error(err)
+			continue
+		}
+		ops = append(ops, updateOps...)
+	}
+	for _, uuid := range s.samples {
+		deleteOps, err := s.nb.Where(&nbdb.Sample{UUID: uuid}).Delete()
+		if err != nil {
+			s.log.Error(err)
+			continue
+		}
+		ops = append(ops, deleteOps...)
+	}
+	for _, uuid := range s.apps {
+		deleteOps, err := s.nb.Where(&nbdb.SamplingApp{UUID: uuid}).Delete()
+		if err != nil {
+			s.log.Error(err)
+			continue
+		}
+		ops = append(ops, deleteOps...)
+	}
+	if s.collector != "" {
+		deleteOps, err := s.nb.Where(&nbdb.SampleCollector{UUID: s.collector}).Delete()
+		if err != nil {
+			s.log.Error(err)
+		} else {
+			ops = append(ops, deleteOps...)
+		}
+	}
+	if len(ops) > 0 {
+		response, err := s.nb.Transact(context.TODO(), ops...)
+		if err != nil {
+			s.log.Error(err)
+		} else if opErr, err := ovsdb.CheckOperationResults(response, ops); err != nil {
+			s.log.Errorf("%s: %+v", err.Error(), opErr)
+		}
+	}
+	s.nb.Close()
+	return nil
+}
+
+// Enrich adds the ACLName, ACLAction, ACLSample and NBDescription extra fields, as well as
+// the SamplingRate the flow counters are compensated with.
+func (s *ACLSampler) Enrich(msg *flowmessage.FlowMessage, extra map[string]interface{}, log *logrus.Logger) map[string]interface{} {
+	sample, ok := s.index.lookup(msg.ObservationDomainID, msg.ObservationPointID)
+	if !ok {
+		log.Debugf("No ACL sample found with observationDomainID %d and observationPointID %d",
+			msg.ObservationDomainID, msg.ObservationPointID)
+		return extra
+	}
+	acl := &nbdb.ACL{UUID: sample.acl}
+	if err := s.nb.Get(acl); err != nil {
+		log.Debugf("ACL %s not found: %s", sample.acl, err.Error())
+		return extra
+	}
+	owners := s.index.owners.lookupACLOwners(acl.UUID)
+
+	if acl.Name != nil {
+		extra["ACLName"] = *acl.Name
+	}
+	extra["ACLAction"] = acl.Action
+	extra["ACLSample"] = sample.kind
+	extra["NBDescription"] = describeACL(acl, readableMatch(s.nb, acl.Match), owners)
+	extra["SamplingRate"] = s.index.samplingRate(msg.ObservationPointID, s.setID)
+	return extra
+}
@@ -0,0 +1,291 @@
+package ovn
+
+import (
+	"amorenoz/ovs-flowmon/pkg/dbmodel"
+	"amorenoz/ovs-flowmon/pkg/flowmon"
+	"amorenoz/ovs-flowmon/pkg/ovn/nbdb"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	flowmessage "github.com/netsampler/goflow2/pb"
+	"github.com/ovn-org/libovsdb/client"
+	"github.com/ovn-org/libovsdb/model"
+	"github.com/sirupsen/logrus"
+)
+
+func TestACLSampleIndexLookup(t *testing.T) {
+	sampleNew, sampleEst := "sample-new", "sample-est"
+	i := newACLSampleIndex()
+	for table, row := range map[string]model.Model{
+		"ACL":          &nbdb.ACL{UUID: "acl", SampleNew: &sampleNew, SampleEst: &sampleEst},
+		"Sample":       &nbdb.Sample{UUID: sampleNew, Metadata: 10},
+		"Sampling_App": &nbdb.SamplingApp{UUID: "app-new", Type: nbdb.SamplingAppTypeACLNew, ID: 2},
+	} {
+		i.addRow(table, row)
+	}
+	i.addRow("Sample", &nbdb.Sample{UUID: sampleEst, Metadata: 11})
+	i.addRow("Sampling_App", &nbdb.SamplingApp{UUID: "app-est", Type: nbdb.SamplingAppTypeACLEst, ID: 3})
+	i.addRow("Sampling_App", &nbdb.SamplingApp{UUID: "app-drop", Type: nbdb.SamplingAppTypeDrop, ID: 1})
+
+	tests := []struct {
+		name        string
+		checkDomain bool
+		domainID    uint32
+		point       uint32
+		sample      aclSample
+		ok          bool
+	}{
+		{name: "new", checkDomain: true, domainID: 2<<24 | 5, point: 10, sample: aclSample{acl: "acl", kind: "new"}, ok: true},
+		{name: "est", checkDomain: true, domainID: 3<<24 | 5, point: 11, sample: aclSample{acl: "acl", kind: "est"}, ok: true},
+		{name: "domain of est", checkDomain: true, domainID: 3<<24 | 5, point: 10},
+		{name: "drop domain", checkDomain: true, domainID: 1<<24 | 5, point: 10},
+		{name: "unknown point", checkDomain: true, domainID: 2<<24 | 5, point: 12},
+		{name: "unchecked domain", domainID: 1<<24 | 5, point: 10, sample: aclSample{acl: "acl", kind: "new"}, ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i.checkDomain = tt.checkDomain
+			sample, ok := i.lookup(tt.domainID, tt.point)
+			if ok != tt.ok || sample != tt.sample {
+				t.Errorf("lookup(%08x, %d) = %+v, %v, want %+v, %v", tt.domainID, tt.point, sample, ok, tt.sample, tt.ok)
+			}
+		})
+	}
+
+	i.checkDomain = true
+	i.deleteRow("Sample", &nbdb.Sample{UUID: sampleNew, Metadata: 10})
+	if _, ok := i.lookup(2<<24, 10); ok {
+		t.Error("deleted Sample found")
+	}
+	i.deleteRow("Sampling_App", &nbdb.SamplingApp{UUID: "app-est", Type: nbdb.SamplingAppTypeACLEst, ID: 3})
+	if _, ok := i.lookup(3<<24, 11); ok {
+		t.Error("Sample found with a deleted Sampling_App")
+	}
+}
+
+// aclSampler returns a started ACLSampler connected to the server.
+func (s *testServer) aclSampler(tb testing.TB) *ACLSampler {
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	nb, err := dbmodel.NewClient("OVN_Northbound", aclSamplingTables, log,
+		client.WithEndpoint("unix:"+s.sock), testLogger())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	sampler := newACLSampler(nb, log)
+	if err := sampler.Start(); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(nb.Close)
+	return sampler
+}
+
+func TestACLSamplerEnrich(t *testing.T) {
+	s := newTestServer(t)
+	s.create(t, s.nb, []model.Model{&nbdb.SamplingApp{Type: nbdb.SamplingAppTypeDrop, ID: 1}})
+	sampler := s.aclSampler(t)
+
+	// Samples configured by another tool after the sampler started.
+	name, sampleNew, sampleEst := "deny-all", "sampleNew", "sampleEst"
+	s.create(t, s.nb, []model.Model{
+		&nbdb.SampleCollector{UUID: "collector", ID: 1, Name: "other", Probability: 65535, SetID: 5},
+		&nbdb.Sample{UUID: sampleNew, Collectors: []string{"collector"}, Metadata: 100},
+		&nbdb.Sample{UUID: sampleEst, Collectors: []string{"collector"}, Metadata: 101},
+		&nbdb.SamplingApp{Type: nbdb.SamplingAppTypeACLNew, ID: 2},
+		&nbdb.SamplingApp{Type: nbdb.SamplingAppTypeACLEst, ID: 3},
+		&nbdb.ACL{UUID: "acl", Name: &name, Action: "drop", Direction: "to-lport", Match: "ip4", Priority: 1000,
+			SampleNew: &sampleNew, SampleEst: &sampleEst},
+		&nbdb.PortGroup{Name: "a1234", ACLs: []string{"acl"}, ExternalIDs: map[string]string{"name": "ns1_deny"}},
+	})
+
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	description := `dropped by ACL "deny-all" (to-lport, priority 1000, action drop) match "ip4" on port group ns1_deny`
+	tests := []struct {
+		name     string
+		domainID uint32
+		point    uint32
+		extra    map[string]interface{}
+	}{
+		{
+			name:     "new",
+			domainID: 2<<24 | 3,
+			point:    100,
+			extra: map[string]interface{}{
+				"ACLName": name, "ACLAction": "drop", "ACLSample": "new", "NBDescription": description,
+				"SamplingRate": 1.0,
+			},
+		},
+		{
+			name:     "est",
+			domainID: 3<<24 | 3,
+			point:    101,
+			extra: map[string]interface{}{
+				"ACLName": name, "ACLAction": "drop", "ACLSample": "est", "NBDescription": description,
+				"SamplingRate": 1.0,
+			},
+		},
+		{name: "drop sample", domainID: 1<<24 | 3, point: 100, extra: map[string]interface{}{}},
+		{name: "unknown point", domainID: 2<<24 | 3, point: 102, extra: map[string]interface{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &flowmessage.FlowMessage{ObservationDomainID: tt.domainID, ObservationPointID: tt.point}
+			var extra map[string]interface{}
+			eventually(t, "the ACL samples", func() bool {
+				extra = sampler.Enrich(msg, map[string]interface{}{}, log)
+				return len(tt.extra) == 0 || len(extra) > 0
+			})
+			if !reflect.DeepEqual(extra, tt.extra) {
+				t.Errorf("Enrich() = %v, want %v", extra, tt.extra)
+			}
+		})
+	}
+}
+
+func TestACLSamplerConfigure(t *testing.T) {
+	s := newTestServer(t)
+	acls := s.create(t, s.nb, []model.Model{
+		&nbdb.ACL{Action: "drop", Direction: "to-lport", Match: "ip4", Priority: 1000},
+		&nbdb.ACL{Action: "allow", Direction: "to-lport", Match: "ip4", Priority: 1001},
+	})
+	s.create(t, s.nb, []model.Model{
+		&nbdb.PortGroup{Name: "a1234", ACLs: []string{acls[0]}, ExternalIDs: map[string]string{"name": "ns1_deny"}},
+		&nbdb.SamplingApp{Type: nbdb.SamplingAppTypeDrop, ID: 1},
+	})
+	sampler := s.aclSampler(t)
+	if err := sampler.Configure(&ACLSelector{PortGroups: []string{"other"}}, 65535, 5); err == nil {
+		t.Fatal("Configure() without matching ACLs did not fail")
+	}
+	if err := sampler.Configure(&ACLSelector{PortGroups: []string{"ns1_deny"}}, 65535, 5); err != nil {
+		t.Fatal(err)
+	}
+	// The ACL Sampling_Apps are created with the first free IDs.
+	apps := func() map[string]int {
+		list := []nbdb.SamplingApp{}
+		if err := sampler.nb.List(&list); err != nil {
+			t.Fatal(err)
+		}
+		ids := map[string]int{}
+		for _, app := range list {
+			ids[app.Type] = app.ID
+		}
+		return ids
+	}
+	eventually(t, "the Sampling_Apps", func() bool {
+		return reflect.DeepEqual(apps(), map[string]int{
+			nbdb.SamplingAppTypeDrop: 1, nbdb.SamplingAppTypeACLNew: 2, nbdb.SamplingAppTypeACLEst: 3,
+		})
+	})
+
+	if err := sampler.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sampler = s.aclSampler(t)
+	eventually(t, "the configuration to be removed", func() bool {
+		samples := []nbdb.Sample{}
+		collectors := []nbdb.SampleCollector{}
+		for _, list := range []interface{}{&samples, &collectors} {
+			if err := sampler.nb.List(list); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return len(samples) == 0 && len(collectors) == 0 &&
+			reflect.DeepEqual(apps(), map[string]int{nbdb.SamplingAppTypeDrop: 1})
+	})
+}
+
+func TestACLSampleIndexSamplingRate(t *testing.T) {
+	i := newACLSampleIndex()
+	i.addRow("Sample_Collector", &nbdb.SampleCollector{UUID: "ours", SetID: 5, Probability: 6553})
+	i.addRow("Sample_Collector", &nbdb.SampleCollector{UUID: "other", SetID: 7, Probability: 65535})
+	i.addRow("Sample_Collector", &nbdb.SampleCollector{UUID: "zero", SetID: 9, Probability: 0})
+	i.addRow("Sample", &nbdb.Sample{UUID: "sample", Metadata: 10, Collectors: []string{"other", "ours", "zero"}})
+
+	tests := []struct {
+		name  string
+		point uint32
+		setID int
+		rate  float64
+	}{
+		{name: "our collector", point: 10, setID: 5, rate: 65535.0 / 6553},
+		{name: "other collector", point: 10, setID: 7, rate: 1},
+		{name: "zero probability", point: 10, setID: 9, rate: 1},
+		{name: "unknown set", point: 10, setID: 3, rate: 1},
+		{name: "unknown point", point: 11, setID: 5, rate: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rate := i.samplingRate(tt.point, tt.setID); rate != tt.rate {
+				t.Errorf("samplingRate(%d, %d) = %f, want %f", tt.point, tt.setID, rate, tt.rate)
+			}
+		})
+	}
+
+	i.deleteRow("Sample_Collector", &nbdb.SampleCollector{UUID: "ours", SetID: 5, Probability: 6553})
+	if rate := i.samplingRate(10, 5); rate != 1 {
+		t.Errorf("samplingRate() = %f with a deleted Sample_Collector", rate)
+	}
+}
+
+// TestACLSamplerSamplingRate checks that the counters of the flows sampled by an ACL are
+// compensated with the probability of its Sample_Collector, also after changing it.
+func TestACLSamplerSamplingRate(t *testing.T) {
+	s := newTestServer(t)
+	sampler := s.aclSampler(t)
+	sampleNew := "sampleNew"
+	rows := s.create(t, s.nb, []model.Model{
+		&nbdb.SampleCollector{UUID: "collector", ID: 1, Name: ACLSamplingCollectorName, Probability: 6553, SetID: 5},
+		&nbdb.SampleCollector{UUID: "other", ID: 2, Name: "other", Probability: 65535, SetID: 7},
+		&nbdb.Sample{UUID: sampleNew, Collectors: []string{"collector", "other"}, Metadata: 100},
+		&nbdb.SamplingApp{Type: nbdb.SamplingAppTypeACLNew, ID: 2},
+		&nbdb.ACL{UUID: "acl", Action: "drop", Direction: "to-lport", Match: "ip4", Priority: 1000, SampleNew: &sampleNew},
+	})
+	// As if Configure had created the collector.
+	sampler.collector = rows[0]
+	sampler.setID = 5
+
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	aggregate := func() *flowmon.FlowAggregate {
+		agg := flowmon.NewFlowAggregate([]string{"ACLAction"})
+		for n := 0; n < 3; n++ {
+			msg := &flowmessage.FlowMessage{ObservationDomainID: 2 << 24, ObservationPointID: 100, Packets: 1, Bytes: 100}
+			extra := sampler.Enrich(msg, map[string]interface{}{}, log)
+			if _, err := agg.AppendIfMatches(flowmon.NewFlowInfo(msg, extra)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return agg
+	}
+	tests := []struct {
+		name        string
+		probability int
+		packets     flowmon.DecUint64
+		bytes       flowmon.DecUint64
+	}{
+		{name: "configured", probability: 6553, packets: 30, bytes: 3000},
+		{name: "changed", probability: 32767, packets: 6, bytes: 600},
+		{name: "every packet", probability: 65535, packets: 3, bytes: 300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := sampler.SetProbability(tt.probability); err != nil {
+				t.Fatal(err)
+			}
+			var agg *flowmon.FlowAggregate
+			eventually(t, "the flows to be compensated", func() bool {
+				agg = aggregate()
+				return agg.TotalPackets == tt.packets
+			})
+			if agg.TotalBytes != tt.bytes || agg.SampledPackets != 3 || agg.SampledBytes != 300 {
+				t.Errorf("aggregate = %d/%d bytes, %d/%d packets, want %d/300 bytes, %d/3 packets",
+					agg.TotalBytes, agg.SampledBytes, agg.TotalPackets, agg.SampledPackets, tt.bytes, tt.packets)
+			}
+		})
+	}
+	if err := sampler.SetProbability(0); err == nil {
+		t.Error("SetProbability(0) did not fail")
+	}
+}
@@ -0,0 +1,186 @@
+package ovn
+
+import (
+	"amorenoz/ovs-flowmon/pkg/dbmodel"
+	"amorenoz/ovs-flowmon/pkg/flowmon"
+	"amorenoz/ovs-flowmon/pkg/ovn/sbdb"
+	"net"
+	"sync"
+
+	flowmessage "github.com/netsampler/goflow2/pb"
+	"github.com/ovn-org/libovsdb/cache"
+	"github.com/ovn-org/libovsdb/model"
+	"github.com/sirupsen/logrus"
+)
+
+// TunnelEnricher implements the netflow.Enricher interface and adds the chassis that
+// sent and will receive each flow through a tunnel. Chassis are looked up by their
+// tunnel (Encap) IP addresses.
+type TunnelEnricher struct {
+	sb      *dbmodel.Client
+	log     *logrus.Logger
+	enabled bool
+
+	mutex sync.RWMutex
+	// dirty is set when the Chassis or Encap tables change so the index is rebuilt on the
+	// next lookup.
+	dirty bool
+	// chassis maps tunnel IP addresses to chassis hostnames (or names).
+	chassis map[string]string
+}
+
+func newTunnelEnricher(sb *dbmodel.Client, log *logrus.Logger) *TunnelEnricher {
+	return &TunnelEnricher{
+		sb:      sb,
+		log:     log,
+		dirty:   true,
+		chassis: make(map[string]string),
+	}
+}
+
+// watch registers the cache event handler that invalidates the index. Must be called
+// after the client is connected and before the monitor is set up.
+func (t *TunnelEnricher) watch() {
+	t.enabled = true
+	invalidate := func(table string) {
+		if table != "Chassis" && table != "Encap" {
+			return
+		}
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		t.dirty = true
+	}
+	t.sb.OnReconnect(func() {
+		invalidate("Chassis")
+	})
+	t.sb.AddEventHandler(&cache.EventHandlerFuncs{
+		AddFunc: func(table string, _ model.Model) {
+			invalidate(table)
+		},
+		UpdateFunc: func(table string, _, _ model.Model) {
+			invalidate(table)
+		},
+		DeleteFunc: func(table string, _ model.Model) {
+			invalidate(table)
+		},
+	})
+}
+
+// Enabled returns whether the running OVN version has the tables needed to identify
+// chassis by their tunnel addresses.
+func (t *TunnelEnricher) Enabled() bool {
+	return t.enabled
+}
+
+// buildLocked rebuilds the index from the cache. Must be called with the mutex held.
+func (t *TunnelEnricher) buildLocked() {
+	t.chassis = make(map[string]string)
+	t.dirty = false
+	names := map[string]string{}
+	chassis := []sbdb.Chassis{}
+	if err := t.sb.List(&chassis); err != nil {
+		t.log.Error(err)
+		return
+	}
+	for _, ch := range chassis {
+		names[ch.Name] = ch.Hostname
+		if ch.Hostname == "" {
+			names[ch.Name] = ch.Name
+		}
+	}
+	encaps := []sbdb.Encap{}
+	if err := t.sb.List(&encaps); err != nil {
+		t.log.Error(err)
+		return
+	}
+	for _, encap := range encaps {
+		ip := net.ParseIP(encap.IP)
+		if ip == nil {
+			continue
+		}
+		name, ok := names[encap.ChassisName]
+		if !ok {
+			name = encap.ChassisName
+		}
+		t.chassis[ip.String()] = name
+	}
+	t.log.Debugf("OVN tunnel index built: %d tunnel addresses", len(t.chassis))
+}
+
+// Lookup returns the chassis that owns the given tunnel IP address or an empty string
+// if none does.
+func (t *TunnelEnricher) Lookup(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	t.mutex.RLock()
+	if !t.dirty {
+		defer t.mutex.RUnlock()
+		return t.chassis[ip.String()]
+	}
+	t.mutex.RUnlock()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.dirty {
+		t.buildLocked()
+	}
+	return t.chassis[ip.String()]
+}
+
+// tunnelRemoteIP returns the remote IP address of the OVS tunnel interface stored in the
+// given extra field (see ovs.OVSClient.Enrich).
+func tunnelRemoteIP(extra map[string]interface{}, name string) net.IP {
+	if data, ok := extra[name]; ok {
+		return net.ParseIP(data.(string))
+	}
+	return nil
+}
+
+// tunnelPorts are the well-known destination ports of the tunnel protocols OVN uses.
+var tunnelPorts = map[flowmon.Proto]map[uint32]bool{
+	flowmon.ProtoUDP: {
+		6081: true, // Geneve
+		4789: true, // VXLAN
+	},
+	flowmon.ProtoTCP: {
+		7471: true, // STT
+	},
+}
+
+// underlayAddresses returns the packet's addresses if it is an encapsulated packet
+// sampled on the underlay, in which case they are the tunnel endpoints. Otherwise (e.g:
+// host-network or node-to-node traffic) the addresses do not identify the chassis the
+// packet was tunneled from or to and nil is returned.
+func underlayAddresses(msg *flowmessage.FlowMessage) (net.IP, net.IP) {
+	if !tunnelPorts[flowmon.Proto(msg.Proto)][msg.DstPort] {
+		return nil, nil
+	}
+	return net.IP(msg.SrcAddr), net.IP(msg.DstAddr)
+}
+
+// Enrich adds the SrcChassis and DstChassis extra fields. The tunnel addresses exported
+// by OVS or the remote end of the OVS tunnel interface the packet came from (or was sent
+// to) are used if known. Otherwise, if the packet is encapsulated, its addresses are
+// looked up, which identifies the chassis of tunneled packets sampled on the underlay.
+func (t *TunnelEnricher) Enrich(msg *flowmessage.FlowMessage, extra map[string]interface{}, log *logrus.Logger) map[string]interface{} {
+	if !t.enabled || !t.sb.Connected() {
+		return extra
+	}
+	tunnelSrc, tunnelDst := flowmon.TunnelAddresses(msg)
+	underlaySrc, underlayDst := underlayAddresses(msg)
+	for prefix, candidates := range map[string][]net.IP{
+		"Src": {tunnelSrc, tunnelRemoteIP(extra, "InIfRemoteIP"), underlaySrc},
+		"Dst": {tunnelDst, tunnelRemoteIP(extra, "OutIfRemoteIP"), underlayDst},
+	} {
+		for _, ip := range candidates {
+			if len(ip) == 0 {
+				continue
+			}
+			if chassis := t.Lookup(ip); chassis != "" {
+				extra[prefix+"Chassis"] = chassis
+				break
+			}
+		}
+	}
+	return extra
+}
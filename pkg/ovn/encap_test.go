@@ -0,0 +1,38 @@
+package ovn
+
+import (
+	"amorenoz/ovs-flowmon/pkg/flowmon"
+	"net"
+	"testing"
+
+	flowmessage "github.com/netsampler/goflow2/pb"
+)
+
+func TestUnderlayAddresses(t *testing.T) {
+	src, dst := net.ParseIP("172.18.0.2").To4(), net.ParseIP("172.18.0.3").To4()
+	tests := []struct {
+		name  string
+		proto flowmon.Proto
+		port  uint32
+		ok    bool
+	}{
+		{name: "geneve", proto: flowmon.ProtoUDP, port: 6081, ok: true},
+		{name: "vxlan", proto: flowmon.ProtoUDP, port: 4789, ok: true},
+		{name: "stt", proto: flowmon.ProtoTCP, port: 7471, ok: true},
+		{name: "host network", proto: flowmon.ProtoTCP, port: 6443},
+		{name: "geneve port over tcp", proto: flowmon.ProtoTCP, port: 6081},
+		{name: "icmp", proto: flowmon.ProtoICMP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &flowmessage.FlowMessage{SrcAddr: src, DstAddr: dst, Proto: uint32(tt.proto), DstPort: tt.port}
+			gotSrc, gotDst := underlayAddresses(msg)
+			if tt.ok && (!gotSrc.Equal(src) || !gotDst.Equal(dst)) {
+				t.Errorf("underlayAddresses() = %s, %s, want %s, %s", gotSrc, gotDst, src, dst)
+			}
+			if !tt.ok && (gotSrc != nil || gotDst != nil) {
+				t.Errorf("underlayAddresses() = %s, %s, want nil", gotSrc, gotDst)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package ovn
+
+import (
+	"amorenoz/ovs-flowmon/pkg/ovn/sbdb"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ovn-org/libovsdb/cache"
+	"github.com/ovn-org/libovsdb/model"
+)
+
+const (
+	// indexScanInterval is the minimum interval between full cache scans looking for
+	// the same missing key.
+	indexScanInterval = time.Second
+	// indexMaxScans bounds the number of keys whose last scan is remembered.
+	indexMaxScans = 4096
+)
+
+// sbIndex keeps the SB rows needed to enrich every sample indexed by the values the
+// samples carry: Logical_Flow UUIDs by cookie (the first 32 bits of the UUID) and
+// Datapath_Binding UUIDs by tunnel key. Port_Binding UUIDs are also indexed by the MAC
+// and IP addresses they own. It only stores UUIDs, rows are read from the client's cache.
+type sbIndex struct {
+	mutex     sync.RWMutex
+	lflows    map[uint32][]string
+	datapaths map[int]string
+	portMACs  map[string][]string
+	portIPs   map[string][]string
+	// scans stores when the cache was last scanned for a key the index did not have.
+	scans map[string]time.Time
+}
+
+func newSBIndex() *sbIndex {
+	return &sbIndex{
+		lflows:    make(map[uint32][]string),
+		datapaths: make(map[int]string),
+		portMACs:  make(map[string][]string),
+		portIPs:   make(map[string][]string),
+		scans:     make(map[string]time.Time),
+	}
+}
+
+// reset removes everything from the index.
+func (i *sbIndex) reset() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.lflows = make(map[uint32][]string)
+	i.datapaths = make(map[int]string)
+	i.portMACs = make(map[string][]string)
+	i.portIPs = make(map[string][]string)
+	i.scans = make(map[string]time.Time)
+}
+
+// allowScan returns whether the cache can be scanned for a key the index does not have.
+// Scans for the same key are rate-limited to one per indexScanInterval so samples that
+// hit an unknown cookie or tunnel key do not scan the whole cache each time.
+func (i *sbIndex) allowScan(key string) bool {
+	now := time.Now()
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if last, ok := i.scans[key]; ok && now.Sub(last) < indexScanInterval {
+		return false
+	}
+	if len(i.scans) >= indexMaxScans {
+		for k, last := range i.scans {
+			if now.Sub(last) >= indexScanInterval {
+				delete(i.scans, k)
+			}
+		}
+		if len(i.scans) >= indexMaxScans {
+			return false
+		}
+	}
+	i.scans[key] = now
+	return true
+}
+
+// appendUUID returns uuids with uuid appended (if not already there).
+func appendUUID(uuids []string, uuid string) []string {
+	for _, u := range uuids {
+		if u == uuid {
+			return uuids
+		}
+	}
+	return append(uuids, uuid)
+}
+
+// removeUUID returns uuids without uuid.
+func removeUUID(uuids []string, uuid string) []string {
+	for idx, u := range uuids {
+		if u == uuid {
+			return append(uuids[:idx], uuids[idx+1:]...)
+		}
+	}
+	return uuids
+}
+
+// addUUID adds the uuid to the list stored in the map under key (if not already there).
+func addUUID(m map[string][]string, key, uuid string) {
+	m[key] = appendUUID(m[key], uuid)
+}
+
+// deleteUUID removes the uuid from the list stored in the map under key.
+func deleteUUID(m map[string][]string, key, uuid string) {
+	if uuids := removeUUID(m[key], uuid); len(uuids) == 0 {
+		delete(m, key)
+	} else {
+		m[key] = uuids
+	}
+}
+
+// lflowCookie returns the cookie OVN uses for the Logical Flow with the given UUID.
+func lflowCookie(uuid string) (uint32, bool) {
+	if len(uuid) < 8 {
+		return 0, false
+	}
+	cookie, err := strconv.ParseUint(uuid[:8], 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(cookie), true
+}
+
+func (i *sbIndex) addLFlow(lflow *sbdb.LogicalFlow) {
+	cookie, ok := lflowCookie(lflow.UUID)
+	if !ok {
+		return
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.lflows[cookie] = appendUUID(i.lflows[cookie], lflow.UUID)
+}
+
+func (i *sbIndex) deleteLFlow(lflow *sbdb.LogicalFlow) {
+	cookie, ok := lflowCookie(lflow.UUID)
+	if !ok {
+		return
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if uuids := removeUUID(i.lflows[cookie], lflow.UUID); len(uuids) == 0 {
+		delete(i.lflows, cookie)
+	} else {
+		i.lflows[cookie] = uuids
+	}
+}
+
+func (i *sbIndex) addDatapath(dp *sbdb.DatapathBinding) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.datapaths[dp.TunnelKey] = dp.UUID
+}
+
+func (i *sbIndex) deleteDatapath(dp *sbdb.DatapathBinding) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if i.datapaths[dp.TunnelKey] == dp.UUID {
+		delete(i.datapaths, dp.TunnelKey)
+	}
+}
+
+func (i *sbIndex) addPort(pb *sbdb.PortBinding) {
+	macs, ips := portAddresses(pb)
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	for _, mac := range macs {
+		addUUID(i.portMACs, mac.String(), pb.UUID)
+	}
+	for _, ip := range ips {
+		addUUID(i.portIPs, ip.String(), pb.UUID)
+	}
+}
+
+func (i *sbIndex) deletePort(pb *sbdb.PortBinding) {
+	macs, ips := portAddresses(pb)
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	for _, mac := range macs {
+		deleteUUID(i.portMACs, mac.String(), pb.UUID)
+	}
+	for _, ip := range ips {
+		deleteUUID(i.portIPs, ip.String(), pb.UUID)
+	}
+}
+
+// lookupPortsByMAC returns the UUIDs of the Port Bindings that own the given MAC address.
+func (i *sbIndex) lookupPortsByMAC(mac net.HardwareAddr) []string {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return append([]string{}, i.portMACs[mac.String()]...)
+}
+
+// lookupPortsByIP returns the UUIDs of the Port Bindings that own the given IP address.
+func (i *sbIndex) lookupPortsByIP(ip net.IP) []string {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return append([]string{}, i.portIPs[ip.String()]...)
+}
+
+// lookupLFlows returns the UUIDs of the Logical Flows with the given cookie.
+func (i *sbIndex) lookupLFlows(cookie uint32) []string {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return append([]string{}, i.lflows[cookie]...)
+}
+
+// lookupDatapath returns the UUID of the Datapath Binding with the given tunnel key.
+func (i *sbIndex) lookupDatapath(tunnelKey int) (string, bool) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	uuid, ok := i.datapaths[tunnelKey]
+	return uuid, ok
+}
+
+// eventHandler returns the cache event handler that keeps the index up to date.
+func (i *sbIndex) eventHandler() cache.EventHandler {
+	return &cache.EventHandlerFuncs{
+		AddFunc: func(table string, newModel model.Model) {
+			switch table {
+			case "Logical_Flow":
+				i.addLFlow(newModel.(*sbdb.LogicalFlow))
+			case "Datapath_Binding":
+				i.addDatapath(newModel.(*sbdb.DatapathBinding))
+			case "Port_Binding":
+				i.addPort(newModel.(*sbdb.PortBinding))
+			}
+		},
+		UpdateFunc: func(table string, oldModel, newModel model.Model) {
+			// Logical Flow UUIDs (and therefore cookies) never change.
+			switch table {
+			case "Datapath_Binding":
+				i.deleteDatapath(oldModel.(*sbdb.DatapathBinding))
+				i.addDatapath(newModel.(*sbdb.DatapathBinding))
+			case "Port_Binding":
+				i.deletePort(oldModel.(*sbdb.PortBinding))
+				i.addPort(newModel.(*sbdb.PortBinding))
+			}
+		},
+		DeleteFunc: func(table string, oldModel model.Model) {
+			switch table {
+			case "Logical_Flow":
+				i.deleteLFlow(oldModel.(*sbdb.LogicalFlow))
+			case "Datapath_Binding":
+				i.deleteDatapath(oldModel.(*sbdb.DatapathBinding))
+			case "Port_Binding":
+				i.deletePort(oldModel.(*sbdb.PortBinding))
+			}
+		},
+	}
+}
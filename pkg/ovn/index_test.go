@@ -0,0 +1,86 @@
+package ovn
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLFlowCookie(t *testing.T) {
+	tests := []struct {
+		uuid   string
+		cookie uint32
+		ok     bool
+	}{
+		{uuid: "8a9d5e7b-1f2c-4e6a-9b3d-0c1e2f3a4b5c", cookie: 0x8a9d5e7b, ok: true},
+		{uuid: "00000001-0000-0000-0000-000000000000", cookie: 1, ok: true},
+		{uuid: "ffffffff", cookie: 0xffffffff, ok: true},
+		{uuid: "8a9d5e7", ok: false},
+		{uuid: "", ok: false},
+		{uuid: "zz9d5e7b-1f2c-4e6a-9b3d-0c1e2f3a4b5c", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uuid, func(t *testing.T) {
+			cookie, ok := lflowCookie(tt.uuid)
+			if ok != tt.ok || cookie != tt.cookie {
+				t.Errorf("lflowCookie(%q) = %08x, %v, want %08x, %v", tt.uuid, cookie, ok, tt.cookie, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRemoveUUID(t *testing.T) {
+	tests := []struct {
+		name  string
+		uuids []string
+		uuid  string
+		want  []string
+	}{
+		{name: "first", uuids: []string{"a", "b", "c"}, uuid: "a", want: []string{"b", "c"}},
+		{name: "last", uuids: []string{"a", "b", "c"}, uuid: "c", want: []string{"a", "b"}},
+		{name: "only", uuids: []string{"a"}, uuid: "a", want: []string{}},
+		{name: "missing", uuids: []string{"a", "b"}, uuid: "c", want: []string{"a", "b"}},
+		{name: "empty", uuids: nil, uuid: "a", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := removeUUID(tt.uuids, tt.uuid); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("removeUUID(%v, %s) = %v, want %v", tt.uuids, tt.uuid, got, tt.want)
+			}
+		})
+	}
+	if got := appendUUID([]string{"a"}, "a"); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("appendUUID() of an existing uuid = %v", got)
+	}
+}
+
+func TestAllowScan(t *testing.T) {
+	i := newSBIndex()
+	if !i.allowScan("lflow/00000001") {
+		t.Fatal("first scan not allowed")
+	}
+	if i.allowScan("lflow/00000001") {
+		t.Error("second scan allowed within indexScanInterval")
+	}
+	if !i.allowScan("dp/1") {
+		t.Error("scan of a different key not allowed")
+	}
+	i.scans["lflow/00000001"] = time.Now().Add(-indexScanInterval)
+	if !i.allowScan("lflow/00000001") {
+		t.Error("scan not allowed after indexScanInterval")
+	}
+
+	for n := len(i.scans); n < indexMaxScans; n++ {
+		i.allowScan(fmt.Sprintf("dp/%d", n+100))
+	}
+	if i.allowScan("dp/0") {
+		t.Error("scan allowed with indexMaxScans recent scans")
+	}
+	for key := range i.scans {
+		i.scans[key] = time.Now().Add(-indexScanInterval)
+	}
+	if !i.allowScan("dp/0") || len(i.scans) != 1 {
+		t.Errorf("expired scans not pruned: %d left", len(i.scans))
+	}
+}
@@ -0,0 +1,279 @@
+package ovn
+
+import (
+	"amorenoz/ovs-flowmon/pkg/dbmodel"
+	"amorenoz/ovs-flowmon/pkg/endpoint"
+	"amorenoz/ovs-flowmon/pkg/flowmon"
+	"amorenoz/ovs-flowmon/pkg/ovn/nbdb"
+	"amorenoz/ovs-flowmon/pkg/ovn/sbdb"
+	"context"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/bombsimon/logrusr/v2"
+	flowmessage "github.com/netsampler/goflow2/pb"
+	"github.com/ovn-org/libovsdb/cache"
+	"github.com/ovn-org/libovsdb/client"
+	"github.com/ovn-org/libovsdb/model"
+	"github.com/sirupsen/logrus"
+)
+
+// PodInfo is the OVN-Kubernetes information about a pod.
+type PodInfo struct {
+	Name      string
+	Namespace string
+	// Node is the name of the Logical Switch the pod's port belongs to, which in
+	// OVN-Kubernetes is the name of the node.
+	Node string
+}
+
+// podFromLSP returns the PodInfo of an OVN-Kubernetes pod port. Pod ports have
+// external_ids:pod=true and external_ids:namespace set and are named "namespace_pod".
+func podFromLSP(lsp *nbdb.LogicalSwitchPort) *PodInfo {
+	if lsp.ExternalIDs["pod"] != "true" {
+		return nil
+	}
+	namespace := lsp.ExternalIDs["namespace"]
+	return &PodInfo{
+		Name:      strings.TrimPrefix(lsp.Name, namespace+"_"),
+		Namespace: namespace,
+	}
+}
+
+// PodEnricher implements the netflow.Enricher interface and adds the OVN-Kubernetes pod,
+// namespace and node of the source and destination addresses of every flow.
+type PodEnricher struct {
+	nb  *dbmodel.Client
+	own bool
+	log *logrus.Logger
+
+	mutex sync.RWMutex
+	// pods and nodes are indexed by Logical_Switch_Port UUID.
+	pods  map[string]*PodInfo
+	nodes map[string]string
+	// ips and macs map addresses to the UUIDs of the Logical_Switch_Ports that have them.
+	// Several ports can share an address, e.g. while a pod is being replaced.
+	ips  map[string][]string
+	macs map[string][]string
+}
+
+func newPodEnricher(nb *dbmodel.Client, log *logrus.Logger) *PodEnricher {
+	return &PodEnricher{
+		nb:    nb,
+		log:   log,
+		pods:  make(map[string]*PodInfo),
+		nodes: make(map[string]string),
+		ips:   make(map[string][]string),
+		macs:  make(map[string][]string),
+	}
+}
+
+// NewPodEnricher returns a PodEnricher that uses its own connection to the OVN NB
+// database. nbStr can be a comma-separated list of OVSDB connection methods.
+func NewPodEnricher(nbStr string, tlsOpts *endpoint.TLSOptions, log *logrus.Logger) (*PodEnricher, error) {
+	logr := logrusr.New(log)
+	opts, err := endpoint.ClientOptions(nbStr, tlsOpts)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, endpoint.ClusterOptions(false)...)
+	nb, err := dbmodel.NewClient("OVN_Northbound", map[string]dbmodel.Table{
+		"Logical_Switch":      {Model: &nbdb.LogicalSwitch{}},
+		"Logical_Switch_Port": {Model: &nbdb.LogicalSwitchPort{}},
+	}, log, append(opts, client.WithLogger(&logr))...)
+	if err != nil {
+		return nil, err
+	}
+	p := newPodEnricher(nb, log)
+	p.own = true
+	return p, nil
+}
+
+// Start connects to the NB database and starts monitoring the Logical Switches and their
+// ports. Only needed if the PodEnricher was created with NewPodEnricher.
+func (p *PodEnricher) Start() error {
+	if p.nb.Connected() {
+		return nil
+	}
+	if err := p.nb.Connect(context.Background()); err != nil {
+		return err
+	}
+	p.watch()
+	if _, err := p.nb.MonitorAll(context.TODO()); err != nil {
+		return err
+	}
+	return p.build()
+}
+
+// Close closes the NB connection if the PodEnricher owns it.
+func (p *PodEnricher) Close() {
+	if p.own {
+		p.nb.Close()
+	}
+}
+
+// watch registers the cache event handler that keeps the pod index up to date. Must be
+// called after the client is connected and before the monitor is set up.
+func (p *PodEnricher) watch() {
+	p.nb.OnReconnect(func() {
+		p.reset()
+		if err := p.build(); err != nil {
+			p.log.Error(err)
+		}
+	})
+	p.nb.AddEventHandler(&cache.EventHandlerFuncs{
+		AddFunc: func(table string, newModel model.Model) {
+			switch table {
+			case "Logical_Switch_Port":
+				p.addPort(newModel.(*nbdb.LogicalSwitchPort))
+			case "Logical_Switch":
+				p.addSwitch(newModel.(*nbdb.LogicalSwitch))
+			}
+		},
+		UpdateFunc: func(table string, oldModel, newModel model.Model) {
+			switch table {
+			case "Logical_Switch_Port":
+				p.deletePort(oldModel.(*nbdb.LogicalSwitchPort))
+				p.addPort(newModel.(*nbdb.LogicalSwitchPort))
+			case "Logical_Switch":
+				p.deleteSwitch(oldModel.(*nbdb.LogicalSwitch))
+				p.addSwitch(newModel.(*nbdb.LogicalSwitch))
+			}
+		},
+		DeleteFunc: func(table string, oldModel model.Model) {
+			switch table {
+			case "Logical_Switch_Port":
+				p.deletePort(oldModel.(*nbdb.LogicalSwitchPort))
+			case "Logical_Switch":
+				p.deleteSwitch(oldModel.(*nbdb.LogicalSwitch))
+			}
+		},
+	})
+}
+
+// reset removes everything from the index.
+func (p *PodEnricher) reset() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.pods = make(map[string]*PodInfo)
+	p.nodes = make(map[string]string)
+	p.ips = make(map[string][]string)
+	p.macs = make(map[string][]string)
+}
+
+// build adds all the Logical Switches and ports in the cache to the index in case some
+// cache event was dropped.
+func (p *PodEnricher) build() error {
+	lsps := []nbdb.LogicalSwitchPort{}
+	if err := p.nb.List(&lsps); err != nil {
+		return err
+	}
+	for i := range lsps {
+		p.addPort(&lsps[i])
+	}
+	lss := []nbdb.LogicalSwitch{}
+	if err := p.nb.List(&lss); err != nil {
+		return err
+	}
+	for i := range lss {
+		p.addSwitch(&lss[i])
+	}
+	p.log.Debugf("OVN-Kubernetes pod index built: %d pods", len(p.pods))
+	return nil
+}
+
+// lspAddresses parses the addresses column of a Logical Switch Port. Each entry has the
+// format "MAC [IP...]".
+func lspAddresses(lsp *nbdb.LogicalSwitchPort) ([]net.HardwareAddr, []net.IP) {
+	return portAddresses(&sbdb.PortBinding{MAC: lsp.Addresses})
+}
+
+func (p *PodEnricher) addPort(lsp *nbdb.LogicalSwitchPort) {
+	pod := podFromLSP(lsp)
+	if pod == nil {
+		return
+	}
+	macs, ips := lspAddresses(lsp)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.pods[lsp.UUID] = pod
+	for _, mac := range macs {
+		addUUID(p.macs, mac.String(), lsp.UUID)
+	}
+	for _, ip := range ips {
+		addUUID(p.ips, ip.String(), lsp.UUID)
+	}
+}
+
+func (p *PodEnricher) deletePort(lsp *nbdb.LogicalSwitchPort) {
+	macs, ips := lspAddresses(lsp)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.pods, lsp.UUID)
+	for _, mac := range macs {
+		deleteUUID(p.macs, mac.String(), lsp.UUID)
+	}
+	for _, ip := range ips {
+		deleteUUID(p.ips, ip.String(), lsp.UUID)
+	}
+}
+
+func (p *PodEnricher) addSwitch(ls *nbdb.LogicalSwitch) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, port := range ls.Ports {
+		p.nodes[port] = ls.Name
+	}
+}
+
+func (p *PodEnricher) deleteSwitch(ls *nbdb.LogicalSwitch) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, port := range ls.Ports {
+		if p.nodes[port] == ls.Name {
+			delete(p.nodes, port)
+		}
+	}
+}
+
+// Lookup returns the pod that owns the given IP address or, if not found, the given MAC
+// address. Returns nil if no pod is found.
+func (p *PodEnricher) Lookup(ip net.IP, mac net.HardwareAddr) *PodInfo {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	var uuids []string
+	if ip != nil {
+		uuids = p.ips[ip.String()]
+	}
+	if len(uuids) == 0 && mac != nil {
+		uuids = p.macs[mac.String()]
+	}
+	if len(uuids) == 0 {
+		return nil
+	}
+	pod, ok := p.pods[uuids[0]]
+	if !ok || pod == nil {
+		return nil
+	}
+	info := *pod
+	info.Node = p.nodes[uuids[0]]
+	return &info
+}
+
+// Enrich adds the SrcPod, SrcNamespace, SrcNode, DstPod, DstNamespace and DstNode extra
+// fields.
+func (p *PodEnricher) Enrich(msg *flowmessage.FlowMessage, extra map[string]interface{}, log *logrus.Logger) map[string]interface{} {
+	for prefix, pod := range map[string]*PodInfo{
+		"Src": p.Lookup(net.IP(msg.SrcAddr), flowmon.MacFromUint64(msg.SrcMac)),
+		"Dst": p.Lookup(net.IP(msg.DstAddr), flowmon.MacFromUint64(msg.DstMac)),
+	} {
+		if pod == nil {
+			continue
+		}
+		extra[prefix+"Pod"] = pod.Name
+		extra[prefix+"Namespace"] = pod.Namespace
+		extra[prefix+"Node"] = pod.Node
+	}
+	return extra
+}
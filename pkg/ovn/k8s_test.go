@@ -0,0 +1,129 @@
+package ovn
+
+import (
+	"amorenoz/ovs-flowmon/pkg/ovn/nbdb"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestPodEnricherLookup(t *testing.T) {
+	pod := func(uuid, namespace, name, addresses string) *nbdb.LogicalSwitchPort {
+		return &nbdb.LogicalSwitchPort{
+			UUID:        uuid,
+			Name:        namespace + "_" + name,
+			Addresses:   []string{addresses},
+			ExternalIDs: map[string]string{"pod": "true", "namespace": namespace},
+		}
+	}
+	web := pod("lsp-web", "ns1", "web", "0a:58:0a:f4:00:05 10.244.0.5")
+	webNew := pod("lsp-web-new", "ns1", "web-new", "0a:58:0a:f4:00:06 10.244.0.5")
+	db := pod("lsp-db", "ns2", "db", "0a:58:0a:f4:01:07 10.244.1.7")
+	router := &nbdb.LogicalSwitchPort{
+		UUID:      "lsp-rtr",
+		Name:      "stor-node1",
+		Addresses: []string{"0a:58:0a:f4:00:01 10.244.0.1"},
+	}
+	node1 := &nbdb.LogicalSwitch{Name: "node1", Ports: []string{"lsp-web", "lsp-web-new", "lsp-rtr"}}
+	node2 := &nbdb.LogicalSwitch{Name: "node2", Ports: []string{"lsp-db"}}
+	mac := func(s string) net.HardwareAddr {
+		m, _ := net.ParseMAC(s)
+		return m
+	}
+
+	tests := []struct {
+		name    string
+		ports   []*nbdb.LogicalSwitchPort
+		deleted []*nbdb.LogicalSwitchPort
+		ip      string
+		mac     net.HardwareAddr
+		want    *PodInfo
+	}{
+		{
+			name:  "ip",
+			ports: []*nbdb.LogicalSwitchPort{web, db},
+			ip:    "10.244.1.7",
+			want:  &PodInfo{Name: "db", Namespace: "ns2", Node: "node2"},
+		},
+		{
+			name:  "mac fallback",
+			ports: []*nbdb.LogicalSwitchPort{web, db},
+			ip:    "10.244.9.9",
+			mac:   mac("0a:58:0a:f4:00:05"),
+			want:  &PodInfo{Name: "web", Namespace: "ns1", Node: "node1"},
+		},
+		{
+			name:  "not a pod",
+			ports: []*nbdb.LogicalSwitchPort{web, router},
+			ip:    "10.244.0.1",
+		},
+		{
+			name:  "unknown",
+			ports: []*nbdb.LogicalSwitchPort{web},
+			ip:    "10.244.9.9",
+			mac:   mac("0a:58:0a:f4:09:09"),
+		},
+		{
+			name:    "deleted",
+			ports:   []*nbdb.LogicalSwitchPort{web, db},
+			deleted: []*nbdb.LogicalSwitchPort{db},
+			ip:      "10.244.1.7",
+		},
+		{
+			name:    "shared address survives delete",
+			ports:   []*nbdb.LogicalSwitchPort{web, webNew},
+			deleted: []*nbdb.LogicalSwitchPort{web},
+			ip:      "10.244.0.5",
+			want:    &PodInfo{Name: "web-new", Namespace: "ns1", Node: "node1"},
+		},
+		{
+			name:    "shared address first owner",
+			ports:   []*nbdb.LogicalSwitchPort{web, webNew},
+			deleted: []*nbdb.LogicalSwitchPort{webNew},
+			ip:      "10.244.0.5",
+			want:    &PodInfo{Name: "web", Namespace: "ns1", Node: "node1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPodEnricher(nil, logrus.New())
+			p.addSwitch(node1)
+			p.addSwitch(node2)
+			for _, lsp := range tt.ports {
+				p.addPort(lsp)
+			}
+			for _, lsp := range tt.deleted {
+				p.deletePort(lsp)
+			}
+			if got := p.Lookup(net.ParseIP(tt.ip), tt.mac); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lookup(%s, %s) = %+v, want %+v", tt.ip, tt.mac, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPodEnricherDelete(t *testing.T) {
+	lsp := &nbdb.LogicalSwitchPort{
+		UUID:        "lsp-web",
+		Name:        "ns1_web",
+		Addresses:   []string{"0a:58:0a:f4:00:05 10.244.0.5"},
+		ExternalIDs: map[string]string{"pod": "true", "namespace": "ns1"},
+	}
+	p := newPodEnricher(nil, logrus.New())
+	p.addPort(lsp)
+	p.addPort(lsp)
+	if got := p.ips["10.244.0.5"]; !reflect.DeepEqual(got, []string{"lsp-web"}) {
+		t.Errorf("ips after adding twice = %v", got)
+	}
+	p.deletePort(lsp)
+	if len(p.pods) != 0 || len(p.ips) != 0 || len(p.macs) != 0 {
+		t.Errorf("index not empty after delete: pods %v ips %v macs %v", p.pods, p.ips, p.macs)
+	}
+	// Addresses owned by a port that is not indexed must not panic on lookup.
+	p.ips["10.244.0.9"] = []string{"lsp-gone"}
+	if got := p.Lookup(net.ParseIP("10.244.0.9"), nil); got != nil {
+		t.Errorf("Lookup() of a missing port = %+v, want nil", got)
+	}
+}
@@ -0,0 +1,140 @@
+package ovn
+
+import (
+	"amorenoz/ovs-flowmon/pkg/flowmon"
+	"amorenoz/ovs-flowmon/pkg/ovn/nbdb"
+	"amorenoz/ovs-flowmon/pkg/ovn/sbdb"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	flowmessage "github.com/netsampler/goflow2/pb"
+)
+
+// LogicalPortInfo is the information about a logical port shown for each sample.
+type LogicalPortInfo struct {
+	Name        string
+	Type        string
+	Chassis     string
+	ExternalIDs map[string]string
+}
+
+// ExternalIDsString returns the external_ids as a sorted, comma-separated list of
+// key=value pairs.
+func (l *LogicalPortInfo) ExternalIDsString() string {
+	pairs := []string{}
+	for k, v := range l.ExternalIDs {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// getPorts returns the Port Bindings with the given UUIDs. If datapath is not empty,
+// only ports in that datapath are returned.
+func (o *OVNClient) getPorts(uuids []string, datapath string) []sbdb.PortBinding {
+	pbs := []sbdb.PortBinding{}
+	for _, uuid := range uuids {
+		pb := sbdb.PortBinding{UUID: uuid}
+		if err := o.sb.Get(&pb); err != nil {
+			continue
+		}
+		if datapath != "" && pb.Datapath != datapath {
+			continue
+		}
+		pbs = append(pbs, pb)
+	}
+	// chassisredirect ports share the address of the router port they redirect, prefer
+	// the latter.
+	sort.SliceStable(pbs, func(i, j int) bool {
+		return pbs[i].Type != "chassisredirect" && pbs[j].Type == "chassisredirect"
+	})
+	return pbs
+}
+
+// findPort returns the Port Binding identified by the given iface-id or, if not set or
+// not found, the one that owns the given MAC or IP address. Ports on the sampled datapath
+// are preferred.
+func (o *OVNClient) findPort(ifaceID string, mac net.HardwareAddr, ip net.IP, datapath string) *sbdb.PortBinding {
+	if ifaceID != "" {
+		pb := sbdb.PortBinding{LogicalPort: ifaceID}
+		if err := o.sb.Get(&pb); err == nil {
+			return &pb
+		}
+	}
+	lookups := []func() []string{}
+	if mac != nil {
+		lookups = append(lookups, func() []string { return o.index.lookupPortsByMAC(mac) })
+	}
+	if ip != nil {
+		lookups = append(lookups, func() []string { return o.index.lookupPortsByIP(ip) })
+	}
+	datapaths := []string{datapath}
+	if datapath != "" {
+		datapaths = append(datapaths, "")
+	}
+	for _, dp := range datapaths {
+		for _, lookup := range lookups {
+			if pbs := o.getPorts(lookup(), dp); len(pbs) > 0 {
+				return &pbs[0]
+			}
+		}
+	}
+	return nil
+}
+
+// getLogicalPortInfo builds the LogicalPortInfo of the Port Binding merging the
+// external_ids of the corresponding NB Logical_Switch_Port or Logical_Router_Port.
+func (o *OVNClient) getLogicalPortInfo(pb *sbdb.PortBinding) *LogicalPortInfo {
+	info := &LogicalPortInfo{
+		Name:        pb.LogicalPort,
+		Type:        pb.Type,
+		ExternalIDs: make(map[string]string),
+	}
+	if info.Type == "" {
+		info.Type = "vif"
+	}
+	for k, v := range pb.ExternalIDs {
+		info.ExternalIDs[k] = v
+	}
+	if pb.Chassis != nil {
+		chassis := sbdb.Chassis{UUID: *pb.Chassis}
+		if err := o.sb.Get(&chassis); err == nil {
+			info.Chassis = chassis.Name
+			if chassis.Hostname != "" {
+				info.Chassis = chassis.Hostname
+			}
+		}
+	}
+
+	lsp := nbdb.LogicalSwitchPort{Name: pb.LogicalPort}
+	lrp := nbdb.LogicalRouterPort{Name: pb.LogicalPort}
+	if err := o.nb.Get(&lsp); err == nil {
+		for k, v := range lsp.ExternalIDs {
+			info.ExternalIDs[k] = v
+		}
+	} else if err := o.nb.Get(&lrp); err == nil {
+		for k, v := range lrp.ExternalIDs {
+			info.ExternalIDs[k] = v
+		}
+	}
+	return info
+}
+
+// getSampleLogicalPorts returns the logical ports the sample was sent from and to (if
+// found). The OpenFlow ports are resolved through the iface-id added by the OVS enricher
+// (if any), otherwise the MAC and IP addresses are looked up.
+func (o *OVNClient) getSampleLogicalPorts(msg *flowmessage.FlowMessage, extra map[string]interface{}, datapath string) (*LogicalPortInfo, *LogicalPortInfo) {
+	var src, dst *LogicalPortInfo
+	inIfaceID, _ := extra["InIfaceID"].(string)
+	outIfaceID, _ := extra["OutIfaceID"].(string)
+
+	if pb := o.findPort(inIfaceID, flowmon.MacFromUint64(msg.SrcMac), net.IP(msg.SrcAddr), datapath); pb != nil {
+		src = o.getLogicalPortInfo(pb)
+	}
+	if pb := o.findPort(outIfaceID, flowmon.MacFromUint64(msg.DstMac), net.IP(msg.DstAddr), datapath); pb != nil {
+		dst = o.getLogicalPortInfo(pb)
+	}
+	return src, dst
+}
@@ -0,0 +1,170 @@
+package ovn
+
+import (
+	"amorenoz/ovs-flowmon/pkg/ovn/nbdb"
+	"amorenoz/ovs-flowmon/pkg/ovn/sbdb"
+	"net"
+	"reflect"
+	"testing"
+
+	flowmessage "github.com/netsampler/goflow2/pb"
+	"github.com/ovn-org/libovsdb/model"
+)
+
+// lportCluster creates two switches with pods and a router with a gateway port and
+// returns a started client and the UUIDs of the datapaths by name.
+func lportCluster(t *testing.T) (*OVNClient, map[string]string) {
+	s := newTestServer(t)
+	// The datapaths are created first: the test server does not resolve named UUIDs in
+	// required reference columns.
+	dps := s.create(t, s.sb, []model.Model{
+		&sbdb.DatapathBinding{TunnelKey: 1, ExternalIDs: map[string]string{"logical-switch": "ls1"}},
+		&sbdb.DatapathBinding{TunnelKey: 2, ExternalIDs: map[string]string{"logical-switch": "ls2"}},
+		&sbdb.DatapathBinding{TunnelKey: 3, ExternalIDs: map[string]string{"logical-router": "lr1"}},
+	})
+	ls1, ls2, lr1, ch1, ch2 := dps[0], dps[1], dps[2], "ch1", "ch2"
+	s.create(t, s.sb, []model.Model{
+		&sbdb.Chassis{UUID: ch1, Name: "chassis-1", Hostname: "node1"},
+		&sbdb.Chassis{UUID: ch2, Name: "chassis-2"},
+		&sbdb.PortBinding{LogicalPort: "ns1_web", Datapath: ls1, TunnelKey: 1, Chassis: &ch1,
+			MAC: []string{"0a:58:0a:f4:00:05 10.244.0.5"}, ExternalIDs: map[string]string{"name": "web"}},
+		&sbdb.PortBinding{LogicalPort: "ls1_dup", Datapath: ls1, TunnelKey: 2,
+			MAC: []string{"0a:58:0a:f4:00:06 10.244.1.7"}},
+		&sbdb.PortBinding{LogicalPort: "ns2_db", Datapath: ls2, TunnelKey: 1,
+			MAC: []string{"0a:58:0a:f4:01:07 10.244.1.7"}},
+		&sbdb.PortBinding{LogicalPort: "lrp1", Type: "patch", Datapath: lr1, TunnelKey: 1,
+			MAC: []string{"0a:58:0a:f4:00:01 10.244.0.1/24"}},
+		&sbdb.PortBinding{LogicalPort: "cr-lrp1", Type: "chassisredirect", Datapath: lr1, TunnelKey: 2, Chassis: &ch2,
+			MAC: []string{"0a:58:0a:f4:00:01 10.244.0.1/24"}},
+	})
+	s.create(t, s.nb, []model.Model{
+		&nbdb.LogicalSwitchPort{Name: "ns1_web", ExternalIDs: map[string]string{"namespace": "ns1", "pod": "true"}},
+		&nbdb.LogicalRouterPort{Name: "lrp1", MAC: "0a:58:0a:f4:00:01", Networks: []string{"10.244.0.1/24"},
+			ExternalIDs: map[string]string{"router": "lr1"}},
+	})
+	return s.client(t), map[string]string{"ls1": ls1, "ls2": ls2, "lr1": lr1}
+}
+
+func TestFindPort(t *testing.T) {
+	o, dps := lportCluster(t)
+	mac := func(s string) net.HardwareAddr {
+		m, _ := net.ParseMAC(s)
+		return m
+	}
+	tests := []struct {
+		name     string
+		ifaceID  string
+		mac      net.HardwareAddr
+		ip       string
+		datapath string
+		port     string
+	}{
+		{name: "iface-id", ifaceID: "ns1_web", port: "ns1_web"},
+		{name: "unknown iface-id", ifaceID: "ns1_gone", mac: mac("0a:58:0a:f4:00:05"), port: "ns1_web"},
+		{name: "mac", mac: mac("0a:58:0a:f4:00:05"), port: "ns1_web"},
+		{name: "ip", ip: "10.244.0.5", port: "ns1_web"},
+		{name: "mac before ip", mac: mac("0a:58:0a:f4:00:06"), ip: "10.244.0.5", port: "ls1_dup"},
+		{name: "chassisredirect last", mac: mac("0a:58:0a:f4:00:01"), port: "lrp1"},
+		{name: "router port ip", ip: "10.244.0.1", datapath: "lr1", port: "lrp1"},
+		{name: "sampled datapath", ip: "10.244.1.7", datapath: "ls1", port: "ls1_dup"},
+		{name: "other sampled datapath", ip: "10.244.1.7", datapath: "ls2", port: "ns2_db"},
+		{name: "not in sampled datapath", ip: "10.244.0.5", datapath: "ls2", port: "ns1_web"},
+		{name: "unknown", mac: mac("0a:58:0a:f4:09:09"), ip: "10.244.9.9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := ""
+			if pb := o.findPort(tt.ifaceID, tt.mac, net.ParseIP(tt.ip), dps[tt.datapath]); pb != nil {
+				port = pb.LogicalPort
+			}
+			if port != tt.port {
+				t.Errorf("findPort() = %q, want %q", port, tt.port)
+			}
+		})
+	}
+}
+
+func TestGetLogicalPortInfo(t *testing.T) {
+	o, _ := lportCluster(t)
+	tests := []struct {
+		port string
+		info *LogicalPortInfo
+	}{
+		{
+			port: "ns1_web",
+			info: &LogicalPortInfo{Name: "ns1_web", Type: "vif", Chassis: "node1",
+				ExternalIDs: map[string]string{"name": "web", "namespace": "ns1", "pod": "true"}},
+		},
+		{
+			port: "lrp1",
+			info: &LogicalPortInfo{Name: "lrp1", Type: "patch", ExternalIDs: map[string]string{"router": "lr1"}},
+		},
+		{
+			port: "cr-lrp1",
+			info: &LogicalPortInfo{Name: "cr-lrp1", Type: "chassisredirect", Chassis: "chassis-2",
+				ExternalIDs: map[string]string{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.port, func(t *testing.T) {
+			pb := sbdb.PortBinding{LogicalPort: tt.port}
+			if err := o.sb.Get(&pb); err != nil {
+				t.Fatal(err)
+			}
+			if info := o.getLogicalPortInfo(&pb); !reflect.DeepEqual(info, tt.info) {
+				t.Errorf("getLogicalPortInfo() = %+v, want %+v", info, tt.info)
+			}
+		})
+	}
+}
+
+func TestGetSampleLogicalPorts(t *testing.T) {
+	o, dps := lportCluster(t)
+	tests := []struct {
+		name     string
+		msg      *flowmessage.FlowMessage
+		extra    map[string]interface{}
+		datapath string
+		src, dst string
+	}{
+		{
+			name:     "addresses",
+			msg:      &flowmessage.FlowMessage{SrcAddr: net.ParseIP("10.244.0.5").To4(), DstAddr: net.ParseIP("10.244.1.7").To4()},
+			datapath: "ls2",
+			src:      "ns1_web",
+			dst:      "ns2_db",
+		},
+		{
+			name:  "macs",
+			msg:   &flowmessage.FlowMessage{SrcMac: 0x0a580af40005, DstMac: 0x0a580af40001},
+			extra: map[string]interface{}{},
+			src:   "ns1_web",
+			dst:   "lrp1",
+		},
+		{
+			name:  "iface-ids",
+			msg:   &flowmessage.FlowMessage{SrcAddr: net.ParseIP("10.244.9.9").To4()},
+			extra: map[string]interface{}{"InIfaceID": "ns2_db", "OutIfaceID": "ns1_web"},
+			src:   "ns2_db",
+			dst:   "ns1_web",
+		},
+		{
+			name: "unknown",
+			msg:  &flowmessage.FlowMessage{SrcAddr: net.ParseIP("10.244.9.9").To4(), DstAddr: net.ParseIP("10.244.9.8").To4()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, dst := o.getSampleLogicalPorts(tt.msg, tt.extra, dps[tt.datapath])
+			name := func(info *LogicalPortInfo) string {
+				if info == nil {
+					return ""
+				}
+				return info.Name
+			}
+			if name(src) != tt.src || name(dst) != tt.dst {
+				t.Errorf("getSampleLogicalPorts() = %q -> %q, want %q -> %q", name(src), name(dst), tt.src, tt.dst)
+			}
+		})
+	}
+}
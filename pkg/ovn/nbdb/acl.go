@@ -0,0 +1,34 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package nbdb
+
+type (
+	ACLAction    = string
+	ACLDirection = string
+)
+
+var (
+	ACLActionAllow          ACLAction    = "allow"
+	ACLActionAllowRelated   ACLAction    = "allow-related"
+	ACLActionAllowStateless ACLAction    = "allow-stateless"
+	ACLActionDrop           ACLAction    = "drop"
+	ACLActionReject         ACLAction    = "reject"
+	ACLActionPass           ACLAction    = "pass"
+	ACLDirectionFromLport   ACLDirection = "from-lport"
+	ACLDirectionToLport     ACLDirection = "to-lport"
+)
+
+// ACL defines an object in ACL table
+type ACL struct {
+	UUID        string            `ovsdb:"_uuid"`
+	Action      ACLAction         `ovsdb:"action"`
+	Direction   ACLDirection      `ovsdb:"direction"`
+	ExternalIDs map[string]string `ovsdb:"external_ids"`
+	Match       string            `ovsdb:"match"`
+	Name        *string           `ovsdb:"name"`
+	Priority    int               `ovsdb:"priority"`
+	SampleEst   *string           `ovsdb:"sample_est"`
+	SampleNew   *string           `ovsdb:"sample_new"`
+	Tier        int               `ovsdb:"tier"`
+}
@@ -0,0 +1,7 @@
+// Package nbdb contains the libovsdb models of the OVN_Northbound tables used by
+// ovs-flowmon. ovn-nb.ovsschema is generated from the upstream schema of the release
+// pinned in hack/update-schemas.sh and keeps only the tables and columns listed in
+// ovn-nb.tables: do not edit it, list the columns there and run make update-schemas.
+package nbdb
+
+//go:generate go run github.com/ovn-org/libovsdb/cmd/modelgen -p nbdb -o . ovn-nb.ovsschema
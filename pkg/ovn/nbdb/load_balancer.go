@@ -0,0 +1,23 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package nbdb
+
+type (
+	LoadBalancerProtocol = string
+)
+
+var (
+	LoadBalancerProtocolTCP  LoadBalancerProtocol = "tcp"
+	LoadBalancerProtocolUDP  LoadBalancerProtocol = "udp"
+	LoadBalancerProtocolSCTP LoadBalancerProtocol = "sctp"
+)
+
+// LoadBalancer defines an object in Load_Balancer table
+type LoadBalancer struct {
+	UUID        string                `ovsdb:"_uuid"`
+	ExternalIDs map[string]string     `ovsdb:"external_ids"`
+	Name        string                `ovsdb:"name"`
+	Protocol    *LoadBalancerProtocol `ovsdb:"protocol"`
+	Vips        map[string]string     `ovsdb:"vips"`
+}
@@ -0,0 +1,23 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package nbdb
+
+type (
+	LogicalRouterPolicyAction = string
+)
+
+var (
+	LogicalRouterPolicyActionAllow   LogicalRouterPolicyAction = "allow"
+	LogicalRouterPolicyActionDrop    LogicalRouterPolicyAction = "drop"
+	LogicalRouterPolicyActionReroute LogicalRouterPolicyAction = "reroute"
+)
+
+// LogicalRouterPolicy defines an object in Logical_Router_Policy table
+type LogicalRouterPolicy struct {
+	UUID        string                    `ovsdb:"_uuid"`
+	Action      LogicalRouterPolicyAction `ovsdb:"action"`
+	ExternalIDs map[string]string         `ovsdb:"external_ids"`
+	Match       string                    `ovsdb:"match"`
+	Priority    int                       `ovsdb:"priority"`
+}
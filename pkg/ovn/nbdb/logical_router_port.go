@@ -0,0 +1,13 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package nbdb
+
+// LogicalRouterPort defines an object in Logical_Router_Port table
+type LogicalRouterPort struct {
+	UUID        string            `ovsdb:"_uuid"`
+	ExternalIDs map[string]string `ovsdb:"external_ids"`
+	MAC         string            `ovsdb:"mac"`
+	Name        string            `ovsdb:"name"`
+	Networks    []string          `ovsdb:"networks"`
+}
@@ -0,0 +1,13 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package nbdb
+
+// LogicalSwitch defines an object in Logical_Switch table
+type LogicalSwitch struct {
+	UUID        string            `ovsdb:"_uuid"`
+	ACLs        []string          `ovsdb:"acls"`
+	ExternalIDs map[string]string `ovsdb:"external_ids"`
+	Name        string            `ovsdb:"name"`
+	Ports       []string          `ovsdb:"ports"`
+}
@@ -0,0 +1,13 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package nbdb
+
+// LogicalSwitchPort defines an object in Logical_Switch_Port table
+type LogicalSwitchPort struct {
+	UUID        string            `ovsdb:"_uuid"`
+	Addresses   []string          `ovsdb:"addresses"`
+	ExternalIDs map[string]string `ovsdb:"external_ids"`
+	Name        string            `ovsdb:"name"`
+	Type        string            `ovsdb:"type"`
+}
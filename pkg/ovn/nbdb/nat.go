@@ -0,0 +1,23 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package nbdb
+
+type (
+	NATType = string
+)
+
+var (
+	NATTypeDNAT        NATType = "dnat"
+	NATTypeSNAT        NATType = "snat"
+	NATTypeDNATAndSNAT NATType = "dnat_and_snat"
+)
+
+// NAT defines an object in NAT table
+type NAT struct {
+	UUID        string            `ovsdb:"_uuid"`
+	ExternalIDs map[string]string `ovsdb:"external_ids"`
+	ExternalIP  string            `ovsdb:"external_ip"`
+	LogicalIP   string            `ovsdb:"logical_ip"`
+	Type        NATType           `ovsdb:"type"`
+}
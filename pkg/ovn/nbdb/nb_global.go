@@ -0,0 +1,10 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package nbdb
+
+// NBGlobal defines an object in NB_Global table
+type NBGlobal struct {
+	UUID    string            `ovsdb:"_uuid"`
+	Options map[string]string `ovsdb:"options"`
+}
@@ -0,0 +1,11 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package nbdb
+
+// Sample defines an object in Sample table
+type Sample struct {
+	UUID       string   `ovsdb:"_uuid"`
+	Collectors []string `ovsdb:"collectors"`
+	Metadata   int      `ovsdb:"metadata"`
+}
@@ -0,0 +1,14 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package nbdb
+
+// SampleCollector defines an object in Sample_Collector table
+type SampleCollector struct {
+	UUID        string            `ovsdb:"_uuid"`
+	ExternalIDs map[string]string `ovsdb:"external_ids"`
+	ID          int               `ovsdb:"id"`
+	Name        string            `ovsdb:"name"`
+	Probability int               `ovsdb:"probability"`
+	SetID       int               `ovsdb:"set_id"`
+}
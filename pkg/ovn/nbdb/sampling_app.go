@@ -0,0 +1,22 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package nbdb
+
+type (
+	SamplingAppType = string
+)
+
+var (
+	SamplingAppTypeDrop   SamplingAppType = "drop"
+	SamplingAppTypeACLNew SamplingAppType = "acl-new"
+	SamplingAppTypeACLEst SamplingAppType = "acl-est"
+)
+
+// SamplingApp defines an object in Sampling_App table
+type SamplingApp struct {
+	UUID        string            `ovsdb:"_uuid"`
+	ExternalIDs map[string]string `ovsdb:"external_ids"`
+	ID          int               `ovsdb:"id"`
+	Type        SamplingAppType   `ovsdb:"type"`
+}
@@ -0,0 +1,343 @@
+package ovn
+
+import (
+	"amorenoz/ovs-flowmon/pkg/dbmodel"
+	"amorenoz/ovs-flowmon/pkg/ovn/nbdb"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ovn-org/libovsdb/cache"
+	"github.com/ovn-org/libovsdb/model"
+)
+
+var addressSetRe = regexp.MustCompile(`\$[A-Za-z0-9_.]+`)
+
+// nbRef references a row of the NB database.
+type nbRef struct {
+	table string
+	uuid  string
+}
+
+// nbIndex indexes the NB rows logical flows can point to through their stage-hint
+// (the first 32 bits of the row's UUID). It also keeps the Port Groups and Logical
+// Switches each ACL is applied on.
+type nbIndex struct {
+	mutex sync.RWMutex
+	hints map[uint32][]nbRef
+	// aclOwners maps ACL UUIDs to the UUIDs of the Port Groups or Logical Switches they
+	// are applied on and a description of them.
+	aclOwners map[string]map[string]string
+}
+
+func newNBIndex() *nbIndex {
+	return &nbIndex{
+		hints:     make(map[uint32][]nbRef),
+		aclOwners: make(map[string]map[string]string),
+	}
+}
+
+// reset removes everything from the index.
+func (i *nbIndex) reset() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.hints = make(map[uint32][]nbRef)
+	i.aclOwners = make(map[string]map[string]string)
+}
+
+// hintTables are the NB tables stage-hints are resolved to.
+var hintTables = map[string]bool{
+	"ACL":                   true,
+	"Load_Balancer":         true,
+	"NAT":                   true,
+	"Logical_Router_Policy": true,
+}
+
+// modelUUID returns the UUID of the models indexed by the nbIndex.
+func modelUUID(m model.Model) string {
+	switch row := m.(type) {
+	case *nbdb.ACL:
+		return row.UUID
+	case *nbdb.LoadBalancer:
+		return row.UUID
+	case *nbdb.NAT:
+		return row.UUID
+	case *nbdb.LogicalRouterPolicy:
+		return row.UUID
+	}
+	return ""
+}
+
+func (i *nbIndex) addHint(table, uuid string) {
+	hint, ok := lflowCookie(uuid)
+	if !ok {
+		return
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	for _, ref := range i.hints[hint] {
+		if ref.uuid == uuid {
+			return
+		}
+	}
+	i.hints[hint] = append(i.hints[hint], nbRef{table: table, uuid: uuid})
+}
+
+func (i *nbIndex) deleteHint(uuid string) {
+	hint, ok := lflowCookie(uuid)
+	if !ok {
+		return
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	refs := i.hints[hint]
+	for idx, ref := range refs {
+		if ref.uuid == uuid {
+			refs = append(refs[:idx], refs[idx+1:]...)
+			break
+		}
+	}
+	if len(refs) == 0 {
+		delete(i.hints, hint)
+	} else {
+		i.hints[hint] = refs
+	}
+}
+
+func (i *nbIndex) setACLOwner(owner string, description string, acls []string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	for _, acl := range acls {
+		if _, ok := i.aclOwners[acl]; !ok {
+			i.aclOwners[acl] = make(map[string]string)
+		}
+		i.aclOwners[acl][owner] = description
+	}
+}
+
+func (i *nbIndex) deleteACLOwner(owner string, acls []string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	for _, acl := range acls {
+		delete(i.aclOwners[acl], owner)
+		if len(i.aclOwners[acl]) == 0 {
+			delete(i.aclOwners, acl)
+		}
+	}
+}
+
+// portGroupDescription returns a human-readable description of the Port Group. OVN-
+// Kubernetes stores the readable name in external_ids:name.
+func portGroupDescription(pg *nbdb.PortGroup) string {
+	if name := pg.ExternalIDs["name"]; name != "" {
+		return "port group " + name
+	}
+	return "port group " + pg.Name
+}
+
+func (i *nbIndex) addRow(table string, m model.Model) {
+	switch table {
+	case "Port_Group":
+		pg := m.(*nbdb.PortGroup)
+		i.setACLOwner(pg.UUID, portGroupDescription(pg), pg.ACLs)
+	case "Logical_Switch":
+		ls := m.(*nbdb.LogicalSwitch)
+		i.setACLOwner(ls.UUID, "switch "+ls.Name, ls.ACLs)
+	default:
+		if hintTables[table] {
+			i.addHint(table, modelUUID(m))
+		}
+	}
+}
+
+func (i *nbIndex) deleteRow(table string, m model.Model) {
+	switch table {
+	case "Port_Group":
+		pg := m.(*nbdb.PortGroup)
+		i.deleteACLOwner(pg.UUID, pg.ACLs)
+	case "Logical_Switch":
+		ls := m.(*nbdb.LogicalSwitch)
+		i.deleteACLOwner(ls.UUID, ls.ACLs)
+	default:
+		if hintTables[table] {
+			i.deleteHint(modelUUID(m))
+		}
+	}
+}
+
+// lookupHint returns the NB rows the stage-hint might point to.
+func (i *nbIndex) lookupHint(hint uint32) []nbRef {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return append([]nbRef{}, i.hints[hint]...)
+}
+
+// lookupACLOwners returns the sorted descriptions of the Port Groups and Logical
+// Switches the ACL is applied on.
+func (i *nbIndex) lookupACLOwners(acl string) []string {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	owners := []string{}
+	for _, description := range i.aclOwners[acl] {
+		owners = append(owners, description)
+	}
+	sort.Strings(owners)
+	return owners
+}
+
+// eventHandler returns the cache event handler that keeps the index up to date.
+func (i *nbIndex) eventHandler() cache.EventHandler {
+	return &cache.EventHandlerFuncs{
+		AddFunc: func(table string, newModel model.Model) {
+			i.addRow(table, newModel)
+		},
+		UpdateFunc: func(table string, oldModel, newModel model.Model) {
+			i.deleteRow(table, oldModel)
+			i.addRow(table, newModel)
+		},
+		DeleteFunc: func(table string, oldModel model.Model) {
+			i.deleteRow(table, oldModel)
+		},
+	}
+}
+
+// buildNBIndex adds all the NB rows in the cache to the index.
+func (o *OVNClient) buildNBIndex() error {
+	acls := []nbdb.ACL{}
+	lbs := []nbdb.LoadBalancer{}
+	nats := []nbdb.NAT{}
+	policies := []nbdb.LogicalRouterPolicy{}
+	pgs := []nbdb.PortGroup{}
+	lss := []nbdb.LogicalSwitch{}
+	for table, list := range map[string]interface{}{
+		"ACL":                   &acls,
+		"Load_Balancer":         &lbs,
+		"NAT":                   &nats,
+		"Logical_Router_Policy": &policies,
+		"Port_Group":            &pgs,
+		"Logical_Switch":        &lss,
+	} {
+		// Tables not supported by the running OVN version.
+		if !o.nb.Has(table) {
+			continue
+		}
+		if err := o.nb.List(list); err != nil {
+			return err
+		}
+	}
+	for i := range acls {
+		o.nbIndex.addRow("ACL", &acls[i])
+	}
+	for i := range lbs {
+		o.nbIndex.addRow("Load_Balancer", &lbs[i])
+	}
+	for i := range nats {
+		o.nbIndex.addRow("NAT", &nats[i])
+	}
+	for i := range policies {
+		o.nbIndex.addRow("Logical_Router_Policy", &policies[i])
+	}
+	for i := range pgs {
+		o.nbIndex.addRow("Port_Group", &pgs[i])
+	}
+	for i := range lss {
+		o.nbIndex.addRow("Logical_Switch", &lss[i])
+	}
+	return nil
+}
+
+// readableMatch replaces the Address Set references in a match by their human-readable
+// names (external_ids:name), if any.
+func readableMatch(nb *dbmodel.Client, match string) string {
+	return addressSetRe.ReplaceAllStringFunc(match, func(ref string) string {
+		as := nbdb.AddressSet{Name: strings.TrimPrefix(ref, "$")}
+		if err := nb.Get(&as); err != nil {
+			return ref
+		}
+		if name := as.ExternalIDs["name"]; name != "" {
+			return "$" + name
+		}
+		return ref
+	})
+}
+
+// describeACL returns a human-readable description of the ACL. owners are the
+// descriptions of the Port Groups and Logical Switches it is applied on.
+func describeACL(acl *nbdb.ACL, match string, owners []string) string {
+	verb := "matched"
+	if acl.Action == "drop" || acl.Action == "reject" {
+		verb = "dropped"
+	}
+	name := ""
+	if acl.Name != nil && *acl.Name != "" {
+		name = fmt.Sprintf(" %q", *acl.Name)
+	}
+	desc := fmt.Sprintf("%s by ACL%s (%s, priority %d, action %s) match %q", verb, name, acl.Direction,
+		acl.Priority, acl.Action, match)
+	if len(owners) > 0 {
+		desc += " on " + strings.Join(owners, ", ")
+	}
+	return desc
+}
+
+// describeNBRow returns a human-readable description of the NB row.
+func (o *OVNClient) describeNBRow(ref nbRef) (string, error) {
+	switch ref.table {
+	case "ACL":
+		acl := nbdb.ACL{UUID: ref.uuid}
+		if err := o.nb.Get(&acl); err != nil {
+			return "", err
+		}
+		return describeACL(&acl, readableMatch(o.nb, acl.Match), o.nbIndex.lookupACLOwners(acl.UUID)), nil
+	case "Load_Balancer":
+		lb := nbdb.LoadBalancer{UUID: ref.uuid}
+		if err := o.nb.Get(&lb); err != nil {
+			return "", err
+		}
+		vips := []string{}
+		for vip, backends := range lb.Vips {
+			vips = append(vips, fmt.Sprintf("%s -> %s", vip, backends))
+		}
+		sort.Strings(vips)
+		protocol := "tcp"
+		if lb.Protocol != nil {
+			protocol = *lb.Protocol
+		}
+		return fmt.Sprintf("load balancer %s (%s) vips: %s", lb.Name, protocol, strings.Join(vips, "; ")), nil
+	case "NAT":
+		nat := nbdb.NAT{UUID: ref.uuid}
+		if err := o.nb.Get(&nat); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s NAT external_ip %s logical_ip %s", nat.Type, nat.ExternalIP, nat.LogicalIP), nil
+	case "Logical_Router_Policy":
+		policy := nbdb.LogicalRouterPolicy{UUID: ref.uuid}
+		if err := o.nb.Get(&policy); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("router policy (priority %d, action %s) match %q", policy.Priority, policy.Action,
+			readableMatch(o.nb, policy.Match)), nil
+	}
+	return "", fmt.Errorf("Unsupported NB table %s", ref.table)
+}
+
+// describeStageHint returns a human-readable description of the NB row(s) the
+// stage-hint of a logical flow points to.
+func (o *OVNClient) describeStageHint(hint string) string {
+	value, ok := lflowCookie(hint)
+	if !ok {
+		return ""
+	}
+	descriptions := []string{}
+	for _, ref := range o.nbIndex.lookupHint(value) {
+		desc, err := o.describeNBRow(ref)
+		if err != nil {
+			o.log.Debugf("Failed to describe %s %s: %s", ref.table, ref.uuid, err.Error())
+			continue
+		}
+		descriptions = append(descriptions, desc)
+	}
+	return strings.Join(descriptions, " | ")
+}
@@ -0,0 +1,145 @@
+package ovn
+
+import (
+	"amorenoz/ovs-flowmon/pkg/ovn/nbdb"
+	"testing"
+
+	"github.com/ovn-org/libovsdb/model"
+)
+
+func TestDescribeACL(t *testing.T) {
+	name, empty := "deny-all", ""
+	tests := []struct {
+		name   string
+		acl    *nbdb.ACL
+		owners []string
+		desc   string
+	}{
+		{
+			name:   "drop",
+			acl:    &nbdb.ACL{Name: &name, Action: "drop", Direction: "to-lport", Priority: 1000},
+			owners: []string{"port group ns1_deny"},
+			desc:   `dropped by ACL "deny-all" (to-lport, priority 1000, action drop) match "ip4" on port group ns1_deny`,
+		},
+		{
+			name: "reject",
+			acl:  &nbdb.ACL{Action: "reject", Direction: "from-lport", Priority: 1001},
+			desc: `dropped by ACL (from-lport, priority 1001, action reject) match "ip4"`,
+		},
+		{
+			name:   "allow",
+			acl:    &nbdb.ACL{Name: &empty, Action: "allow-related", Direction: "to-lport", Priority: 1001},
+			owners: []string{"port group ns1_allow", "switch node1"},
+			desc:   `matched by ACL (to-lport, priority 1001, action allow-related) match "ip4" on port group ns1_allow, switch node1`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if desc := describeACL(tt.acl, "ip4", tt.owners); desc != tt.desc {
+				t.Errorf("describeACL() = %s, want %s", desc, tt.desc)
+			}
+		})
+	}
+}
+
+func TestReadableMatch(t *testing.T) {
+	s := newTestServer(t)
+	s.create(t, s.nb, []model.Model{
+		&nbdb.AddressSet{Name: "a1234", ExternalIDs: map[string]string{"name": "ns1_v4"}},
+		&nbdb.AddressSet{Name: "a5678"},
+	})
+	o := s.client(t)
+	tests := []struct {
+		match string
+		want  string
+	}{
+		{match: "ip4.src == $a1234", want: "ip4.src == $ns1_v4"},
+		{match: "ip4.src == $a1234 && ip4.dst != $a1234", want: "ip4.src == $ns1_v4 && ip4.dst != $ns1_v4"},
+		{match: "ip4.dst == $a5678", want: "ip4.dst == $a5678"},
+		{match: "ip4.dst == $unknown", want: "ip4.dst == $unknown"},
+		{match: "outport == @pg1 && ip4", want: "outport == @pg1 && ip4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.match, func(t *testing.T) {
+			if match := readableMatch(o.nb, tt.match); match != tt.want {
+				t.Errorf("readableMatch() = %s, want %s", match, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribeNBRow(t *testing.T) {
+	s := newTestServer(t)
+	name, acl, udp := "deny-all", "acl", "udp"
+	uuids := s.create(t, s.nb, []model.Model{
+		&nbdb.ACL{UUID: acl, Name: &name, Action: "drop", Direction: "to-lport", Priority: 1000,
+			Match: "ip4.src == $a1234"},
+		&nbdb.LoadBalancer{Name: "svc1", Protocol: &udp,
+			Vips: map[string]string{"10.96.0.10:53": "10.244.0.5:53,10.244.1.7:53", "10.96.0.11:53": "10.244.0.6:53"}},
+		&nbdb.LoadBalancer{Name: "svc2", Vips: map[string]string{"10.96.0.1:443": "172.18.0.2:6443"}},
+		&nbdb.NAT{Type: "snat", ExternalIP: "172.18.0.3", LogicalIP: "10.244.0.0/16"},
+		&nbdb.LogicalRouterPolicy{Priority: 1004, Action: "reroute", Match: "ip4.src == $a1234"},
+		&nbdb.AddressSet{Name: "a1234", ExternalIDs: map[string]string{"name": "ns1_v4"}},
+		&nbdb.PortGroup{Name: "a5678", ACLs: []string{acl}, ExternalIDs: map[string]string{"name": "ns1_deny"}},
+		&nbdb.LogicalSwitch{Name: "node1", ACLs: []string{acl}},
+	})
+	o := s.client(t)
+	tests := []struct {
+		name string
+		ref  nbRef
+		desc string
+		err  bool
+	}{
+		{
+			name: "acl",
+			ref:  nbRef{table: "ACL", uuid: uuids[0]},
+			desc: `dropped by ACL "deny-all" (to-lport, priority 1000, action drop) match "ip4.src == $ns1_v4" on port group ns1_deny, switch node1`,
+		},
+		{
+			name: "load balancer",
+			ref:  nbRef{table: "Load_Balancer", uuid: uuids[1]},
+			desc: "load balancer svc1 (udp) vips: 10.96.0.10:53 -> 10.244.0.5:53,10.244.1.7:53; 10.96.0.11:53 -> 10.244.0.6:53",
+		},
+		{
+			name: "load balancer default protocol",
+			ref:  nbRef{table: "Load_Balancer", uuid: uuids[2]},
+			desc: "load balancer svc2 (tcp) vips: 10.96.0.1:443 -> 172.18.0.2:6443",
+		},
+		{
+			name: "nat",
+			ref:  nbRef{table: "NAT", uuid: uuids[3]},
+			desc: "snat NAT external_ip 172.18.0.3 logical_ip 10.244.0.0/16",
+		},
+		{
+			name: "router policy",
+			ref:  nbRef{table: "Logical_Router_Policy", uuid: uuids[4]},
+			desc: `router policy (priority 1004, action reroute) match "ip4.src == $ns1_v4"`,
+		},
+		{
+			name: "missing row",
+			ref:  nbRef{table: "NAT", uuid: uuids[0]},
+			err:  true,
+		},
+		{
+			name: "unsupported table",
+			ref:  nbRef{table: "Address_Set", uuid: uuids[5]},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desc, err := o.describeNBRow(tt.ref)
+			if (err != nil) != tt.err || desc != tt.desc {
+				t.Errorf("describeNBRow() = %q, %v, want %q (error %v)", desc, err, tt.desc, tt.err)
+			}
+		})
+	}
+
+	// The stage-hint of a logical flow is the full UUID of the NB row.
+	if desc := o.describeStageHint(uuids[3]); desc != tests[3].desc {
+		t.Errorf("describeStageHint() = %q, want %q", desc, tests[3].desc)
+	}
+	if desc := o.describeStageHint("not-a-uuid"); desc != "" {
+		t.Errorf("describeStageHint() of an invalid hint = %q", desc)
+	}
+}
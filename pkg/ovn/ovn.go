@@ -1,12 +1,21 @@
 package ovn
 
 import (
+	"amorenoz/ovs-flowmon/pkg/dbmodel"
+	"amorenoz/ovs-flowmon/pkg/endpoint"
+	"amorenoz/ovs-flowmon/pkg/ovn/nbdb"
+	"amorenoz/ovs-flowmon/pkg/ovn/sbdb"
 	"context"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bombsimon/logrusr/v2"
 	flowmessage "github.com/netsampler/goflow2/pb"
+	"github.com/ovn-org/libovsdb/cache"
 	"github.com/ovn-org/libovsdb/client"
 	"github.com/ovn-org/libovsdb/model"
 	"github.com/ovn-org/libovsdb/ovsdb"
@@ -14,50 +23,13 @@ import (
 )
 
 const (
-	OVNDebugDomain = 1
+	// DefaultDebugCollectorSetID is the default OVS Flow_Sample_Collector_Set ID OVN drop
+	// samples are sent to.
+	DefaultDebugCollectorSetID = 1
+	// DefaultDebugDomainID is the default observation domain ID of OVN drop samples.
+	DefaultDebugDomainID = 1
 )
 
-// NBGlobal defines an object in NB_Global table
-type NBGlobal struct {
-	UUID    string            `ovsdb:"_uuid"`
-	Options map[string]string `ovsdb:"options"`
-}
-
-type (
-	// LogicalFlowPipeline is the type used for the Pipeline enum.
-	LogicalFlowPipeline = string
-)
-
-var (
-	// LogicalFlowPipelineIngress represents the "ingress" pipeline.
-	LogicalFlowPipelineIngress LogicalFlowPipeline = "ingress"
-	// LogicalFlowPipelineEgress represents the "egress" pipeline.
-	LogicalFlowPipelineEgress LogicalFlowPipeline = "egress"
-)
-
-// LogicalFlow defines an object in Logical_Flow table.
-type LogicalFlow struct {
-	UUID    string `ovsdb:"_uuid"`
-	Actions string `ovsdb:"actions"`
-	//	ControllerMeter *string             `ovsdb:"controller_meter"`
-	ExternalIDs     map[string]string   `ovsdb:"external_ids"`
-	LogicalDatapath *string             `ovsdb:"logical_datapath"`
-	LogicalDpGroup  *string             `ovsdb:"logical_dp_group"`
-	Match           string              `ovsdb:"match"`
-	Pipeline        LogicalFlowPipeline `ovsdb:"pipeline"`
-	Priority        int                 `ovsdb:"priority"`
-	TableID         int                 `ovsdb:"table_id"`
-	Tags            map[string]string   `ovsdb:"tags"`
-}
-
-// DatapathBinding defines an object in Datapath_Binding table
-type DatapathBinding struct {
-	UUID        string            `ovsdb:"_uuid"`
-	ExternalIDs map[string]string `ovsdb:"external_ids"`
-	//LoadBalancers []string          `ovsdb:"load_balancers"`
-	TunnelKey int `ovsdb:"tunnel_key"`
-}
-
 type (
 	// DatapathType is an enum used to indicate the type of datapath
 	// that originated thes sample.
@@ -77,83 +49,295 @@ var (
 // SampleInfo represents the OVN information associated with a sample.
 type SampleInfo struct {
 	// Flow information.
-	LogicalFlow   *LogicalFlow
+	LogicalFlow *sbdb.LogicalFlow
+	// Candidates holds the Logical Flows the sample might correspond to if it could
+	// not be attributed to a single one. Ambiguity describes why.
+	Candidates    []sbdb.LogicalFlow
+	Ambiguity     string
 	OpenFlowTable int
+	// Name and description of the OpenFlow table of physical samples.
+	OpenFlowTableName string
+	OpenFlowTableDesc string
 	// Datapath Information.
 	DatapathType DatapathType
 	DatapathName string
+	DatapathUUID string
+}
+
+// nbTables are the NB tables the OVNClient reads. Tables and columns that are not needed
+// for drop sampling are optional.
+var nbTables = map[string]dbmodel.Table{
+	"NB_Global":           {Model: &nbdb.NBGlobal{}},
+	"Logical_Switch_Port": {Model: &nbdb.LogicalSwitchPort{}},
+	"Logical_Router_Port": {Model: &nbdb.LogicalRouterPort{}},
+	"Logical_Switch":      {Model: &nbdb.LogicalSwitch{}},
+	"ACL": {Model: &nbdb.ACL{}, Optional: true,
+		OptionalColumns: []string{"sample_est", "sample_new", "tier"}},
+	"Port_Group":            {Model: &nbdb.PortGroup{}, Optional: true},
+	"Address_Set":           {Model: &nbdb.AddressSet{}, Optional: true},
+	"Load_Balancer":         {Model: &nbdb.LoadBalancer{}, Optional: true},
+	"NAT":                   {Model: &nbdb.NAT{}, Optional: true},
+	"Logical_Router_Policy": {Model: &nbdb.LogicalRouterPolicy{}, Optional: true},
+	"Sampling_App":          {Model: &nbdb.SamplingApp{}, Optional: true},
+}
+
+// sbTables are the SB tables the OVNClient reads.
+var sbTables = map[string]dbmodel.Table{
+	"Logical_Flow": {Model: &sbdb.LogicalFlow{},
+		OptionalColumns: []string{"logical_dp_group"}},
+	"Datapath_Binding": {Model: &sbdb.DatapathBinding{}},
+	"Port_Binding":     {Model: &sbdb.PortBinding{}},
+	"Logical_DP_Group": {Model: &sbdb.LogicalDPGroup{}, Optional: true},
+	"Chassis":          {Model: &sbdb.Chassis{}, Optional: true},
+	"Encap":            {Model: &sbdb.Encap{}, Optional: true},
 }
 
 // OVNClient is the main object that configures and retrieves information from OVN.
 type OVNClient struct {
-	nb  client.Client
-	sb  client.Client
+	nb  *dbmodel.Client
+	sb  *dbmodel.Client
 	log *logrus.Logger
+
+	// Index of SB rows by the keys carried in the samples.
+	index *sbIndex
+	// OpenFlow table layout of the running OVN version.
+	tables *ofTableLayout
+	// Logical flow stages of the running OVN version (nil if not known).
+	stages *stageLayout
+	// Index of NB rows by stage-hint.
+	nbIndex *nbIndex
+	// OVN-Kubernetes pod index built from the NB database.
+	pods *PodEnricher
+	// Chassis index by tunnel address built from the SB database.
+	tunnels *TunnelEnricher
+	// IDs drop sampling is configured with.
+	collectorSetID int
+	domainID       int
+	// debugOptions are the NB_Global options set by SetDebugMode and savedOptions their
+	// values before that (nil if they were not set). Protected by debugMutex.
+	debugMutex    sync.Mutex
+	debugOptions  map[string]string
+	savedOptions  map[string]*string
+	leaveEnabled  bool
+	onDebugChange func(message string)
+
+	// Needed to run ovn-trace against the same SB database.
+	sbStr    string
+	tlsOpts  *endpoint.TLSOptions
+	traceCmd string
 }
 
-func NewOVNClient(nbStr string, sbStr string, log *logrus.Logger) (*OVNClient, error) {
+// NewOVNClient returns a new OVNClient. nbStr and sbStr can be comma-separated lists
+// of OVSDB connection methods (e.g: the members of a RAFT cluster). tlsOpts are only
+// needed if any of them uses ssl. The NB database is written to, so the client connects
+// to the cluster leader. The SB database is only read and any member is used. Both
+// connections fail over to another member if they are lost.
+func NewOVNClient(nbStr string, sbStr string, tlsOpts *endpoint.TLSOptions, log *logrus.Logger) (*OVNClient, error) {
 	logr := logrusr.New(log)
 	var err error
 
-	// Connect NB.
-	dbmodel, err := model.NewDBModel("OVN_Northbound",
-		map[string]model.Model{
-			"NB_Global": &NBGlobal{},
-		})
+	nbOpts, err := endpoint.ClientOptions(nbStr, tlsOpts)
 	if err != nil {
 		return nil, err
 	}
-	nb, err := client.NewOVSDBClient(dbmodel, client.WithEndpoint(nbStr), client.WithLogger(&logr))
+	sbOpts, err := endpoint.ClientOptions(sbStr, tlsOpts)
 	if err != nil {
 		return nil, err
 	}
 
-	// Connect SB.
-	dbmodel, err = model.NewDBModel("OVN_Southbound",
-		map[string]model.Model{
-			"Logical_Flow":     &LogicalFlow{},
-			"Datapath_Binding": &DatapathBinding{},
-		})
-	sb, err := client.NewOVSDBClient(dbmodel, client.WithEndpoint(sbStr), client.WithLogger(&logr))
+	nbOpts = append(nbOpts, endpoint.ClusterOptions(true)...)
+	nb, err := dbmodel.NewClient("OVN_Northbound", nbTables, log, append(nbOpts, client.WithLogger(&logr))...)
 	if err != nil {
 		return nil, err
 	}
+	sbOpts = append(sbOpts, endpoint.ClusterOptions(false)...)
+	sb, err := dbmodel.NewClient("OVN_Southbound", sbTables, log, append(sbOpts, client.WithLogger(&logr))...)
+	if err != nil {
+		return nil, err
+	}
+	o := newOVNClient(nb, sb, log)
+	o.sbStr = sbStr
+	o.tlsOpts = tlsOpts
+	return o, nil
+}
+
+func newOVNClient(nb, sb *dbmodel.Client, log *logrus.Logger) *OVNClient {
 	return &OVNClient{
-		nb:  nb,
-		sb:  sb,
-		log: log,
-	}, nil
+		nb:             nb,
+		sb:             sb,
+		log:            log,
+		index:          newSBIndex(),
+		nbIndex:        newNBIndex(),
+		tables:         &ofTableLayouts[0],
+		stages:         &stageLayouts[0],
+		pods:           newPodEnricher(nb, log),
+		tunnels:        newTunnelEnricher(sb, log),
+		collectorSetID: DefaultDebugCollectorSetID,
+		domainID:       DefaultDebugDomainID,
+		traceCmd:       DefaultTraceCommand,
+	}
 }
+
+// Close restores the NB_Global options changed by SetDebugMode (unless SetLeaveEnabled
+// was called) and closes the connections. If the NB connection is down, it waits up to
+// closeReconnectTimeout for the client to reconnect before giving up on restoring them.
 func (o *OVNClient) Close() error {
-	nbs := []NBGlobal{}
-	if !o.nb.Connected() {
-		return nil
+	o.debugMutex.Lock()
+	pending := o.debugOptions != nil && !o.leaveEnabled
+	o.debugMutex.Unlock()
+	if pending && !waitConnected(o.nb, closeReconnectTimeout) {
+		o.log.Errorf("Not connected to the OVN NB database: NB_Global options %s were not restored",
+			o.debugOptionsString())
+	} else if err := o.restoreDebugMode(); err != nil {
+		o.log.Error(err)
+	}
+	o.nb.Close()
+	o.sb.Close()
+	return nil
+}
+
+// closeReconnectTimeout is how long Close waits for a lost connection to come back
+// before giving up on restoring the configuration.
+const closeReconnectTimeout = 10 * time.Second
+
+// waitConnected waits up to timeout for the client to be connected.
+func waitConnected(c *dbmodel.Client, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for !c.Connected() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return true
+}
+
+// debugOptionsString returns the options set by SetDebugMode as a sorted list of
+// key=value pairs.
+func (o *OVNClient) debugOptionsString() string {
+	o.debugMutex.Lock()
+	defer o.debugMutex.Unlock()
+	pairs := []string{}
+	for option, value := range o.debugOptions {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", option, value))
 	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
 
+// SetLeaveEnabled makes Close leave drop sampling enabled instead of restoring the
+// original NB_Global options.
+func (o *OVNClient) SetLeaveEnabled(leave bool) {
+	o.leaveEnabled = leave
+}
+
+// OnDebugModeChange sets the function that is called if someone else changes the
+// NB_Global options set by SetDebugMode while drop sampling is enabled.
+func (o *OVNClient) OnDebugModeChange(fn func(message string)) {
+	o.debugMutex.Lock()
+	defer o.debugMutex.Unlock()
+	o.onDebugChange = fn
+}
+
+// nbGlobal returns the NB_Global row. An error is returned if the NB database does not
+// have one (e.g: northd has not initialized it yet).
+func (o *OVNClient) nbGlobal() (*nbdb.NBGlobal, error) {
+	nbs := []nbdb.NBGlobal{}
 	if err := o.nb.List(&nbs); err != nil {
-		return err
+		return nil, err
 	}
-	nb := nbs[0]
-	delete(nb.Options, "debug_drop_collector_set")
-	delete(nb.Options, "debug_drop_domain_id")
-	clearOps, err := o.nb.Where(&nb).Update(&nb, &nb.Options)
+	if len(nbs) == 0 {
+		return nil, fmt.Errorf("No NB_Global row found in the OVN NB database")
+	}
+	return &nbs[0], nil
+}
+
+// restoreDebugMode sets the NB_Global options changed by SetDebugMode back to the values
+// they had before. Options that someone else has changed since are left alone.
+func (o *OVNClient) restoreDebugMode() error {
+	o.debugMutex.Lock()
+	defer o.debugMutex.Unlock()
+	if o.debugOptions == nil {
+		return nil
+	}
+	if o.leaveEnabled {
+		o.log.Infof("Leaving OVN drop sampling enabled: %v", o.debugOptions)
+		return nil
+	}
+	nb, err := o.nbGlobal()
 	if err != nil {
-		o.log.Error(err)
-	} else {
-		response, err := o.nb.Transact(context.TODO(), clearOps...)
-		if err != nil {
-			o.log.Error(err)
+		return err
+	}
+	for option, value := range o.debugOptions {
+		if nb.Options[option] != value {
+			o.log.Warningf("NB_Global options:%s was changed while running, not restoring it", option)
+			continue
 		}
-		if opErr, err := ovsdb.CheckOperationResults(response, clearOps); err != nil {
-			o.log.Errorf("%s: %+v", err.Error(), opErr)
+		if saved := o.savedOptions[option]; saved != nil {
+			nb.Options[option] = *saved
+		} else {
+			delete(nb.Options, option)
 		}
 	}
-
-	o.nb.Close()
-	o.sb.Close()
+	ops, err := o.nb.Where(nb).Update(nb, &nb.Options)
+	if err != nil {
+		return err
+	}
+	response, err := o.nb.Transact(context.TODO(), ops...)
+	if err != nil {
+		return err
+	}
+	if opErr, err := ovsdb.CheckOperationResults(response, ops); err != nil {
+		return fmt.Errorf("%s: %+v", err.Error(), opErr)
+	}
+	o.debugOptions = nil
+	o.log.Info("OVN Drop sampling: Restored")
 	return nil
 }
 
+// debugModeHandler returns the cache event handler that reports changes made by someone
+// else to the NB_Global options set by SetDebugMode.
+func (o *OVNClient) debugModeHandler() cache.EventHandler {
+	return &cache.EventHandlerFuncs{
+		UpdateFunc: func(table string, oldModel, newModel model.Model) {
+			if table != "NB_Global" {
+				return
+			}
+			oldOptions := oldModel.(*nbdb.NBGlobal).Options
+			newOptions := newModel.(*nbdb.NBGlobal).Options
+			messages := []string{}
+			o.debugMutex.Lock()
+			for option, value := range o.debugOptions {
+				if newOptions[option] == value || newOptions[option] == oldOptions[option] {
+					continue
+				}
+				messages = append(messages, fmt.Sprintf("NB_Global options:%s was changed from %s to %q by someone else. OVN drop samples might not be received or decoded correctly",
+					option, value, newOptions[option]))
+			}
+			onDebugChange := o.onDebugChange
+			o.debugMutex.Unlock()
+			for _, message := range messages {
+				o.log.Warning(message)
+				if onDebugChange != nil {
+					onDebugChange(message)
+				}
+			}
+		},
+	}
+}
+
+// PodEnricher returns the enricher that adds OVN-Kubernetes pod information to the flows.
+// It shares the NB connection of the OVNClient.
+func (o *OVNClient) PodEnricher() *PodEnricher {
+	return o.pods
+}
+
+// TunnelEnricher returns the enricher that adds the chassis that sent and will receive
+// each flow through a tunnel. It shares the SB connection of the OVNClient.
+func (o *OVNClient) TunnelEnricher() *TunnelEnricher {
+	return o.tunnels
+}
+
 func (o *OVNClient) Started() bool {
 	return o.nb.Connected() && o.sb.Connected()
 }
@@ -169,60 +353,224 @@ func (o *OVNClient) Start() error {
 			return err
 		}
 	}
+	o.log.Infof("Connected to OVN NB leader %s and SB %s", o.nb.CurrentEndpoint(), o.sb.CurrentEndpoint())
+	o.tables = selectTableLayout(o.sb.Schema().Version)
+	o.stages = selectStageLayout(o.sb.Schema().Version)
+	o.log.Infof("OVN Southbound schema version %s: using OpenFlow tables of OVN %s",
+		o.sb.Schema().Version, o.tables.Releases)
+	o.pods.watch()
+	o.nb.OnReconnect(func() {
+		o.nbIndex.reset()
+		if err := o.buildNBIndex(); err != nil {
+			o.log.Error(err)
+		}
+	})
+	o.nb.AddEventHandler(o.nbIndex.eventHandler())
+	o.nb.AddEventHandler(o.debugModeHandler())
 	_, err = o.nb.MonitorAll(context.TODO())
 	if err != nil {
 		return err
 	}
-	_, err = o.sb.Monitor(context.TODO(), o.sb.NewMonitor(
-		client.WithTable(&LogicalFlow{}), client.WithTable(&DatapathBinding{})))
+	if err := o.pods.build(); err != nil {
+		return err
+	}
+	if err := o.buildNBIndex(); err != nil {
+		return err
+	}
+	o.sb.OnReconnect(func() {
+		o.index.reset()
+		if err := o.buildIndex(); err != nil {
+			o.log.Error(err)
+		}
+	})
+	o.sb.AddEventHandler(o.index.eventHandler())
+	tables := []client.MonitorOption{
+		o.sb.WithTable(&sbdb.LogicalFlow{}), o.sb.WithTable(&sbdb.DatapathBinding{}),
+		o.sb.WithTable(&sbdb.PortBinding{}),
+	}
+	if o.sb.Has("Logical_DP_Group") {
+		tables = append(tables, o.sb.WithTable(&sbdb.LogicalDPGroup{}))
+	}
+	if o.sb.Has("Chassis") {
+		tables = append(tables, o.sb.WithTable(&sbdb.Chassis{}))
+		if o.sb.Has("Encap") {
+			tables = append(tables, o.sb.WithTable(&sbdb.Encap{}))
+			o.tunnels.watch()
+		}
+	}
+	_, err = o.sb.Monitor(context.TODO(), o.sb.NewMonitor(tables...))
 	if err != nil {
 		return err
 	}
+	// Cache events might be dropped if too many rows are added at once (e.g: when
+	// populating the initial cache of a big cluster) so fill the index from the cache.
+	return o.buildIndex()
+}
+
+// buildIndex adds all the Logical Flows, Datapath Bindings and Port Bindings in the cache
+// to the index.
+func (o *OVNClient) buildIndex() error {
+	lflows := []sbdb.LogicalFlow{}
+	if err := o.sb.List(&lflows); err != nil {
+		return err
+	}
+	for i := range lflows {
+		o.index.addLFlow(&lflows[i])
+	}
+	dps := []sbdb.DatapathBinding{}
+	if err := o.sb.List(&dps); err != nil {
+		return err
+	}
+	for i := range dps {
+		o.index.addDatapath(&dps[i])
+	}
+	pbs := []sbdb.PortBinding{}
+	if err := o.sb.List(&pbs); err != nil {
+		return err
+	}
+	for i := range pbs {
+		o.index.addPort(&pbs[i])
+	}
+	o.log.Debugf("OVN SB index built: %d logical flows, %d datapaths, %d ports", len(lflows), len(dps), len(pbs))
 	return nil
 }
 
-func (o *OVNClient) SetDebugMode() error {
+// CollectorSetIDs returns the OVS Flow_Sample_Collector_Set ID OVN drop samples are
+// currently sent to, if drop sampling was already enabled by someone else.
+func (o *OVNClient) CollectorSetIDs() ([]int, error) {
 	if !o.nb.Connected() {
-		return fmt.Errorf("Client not connected")
+		return nil, fmt.Errorf("Client not connected")
+	}
+	nb, err := o.nbGlobal()
+	if err != nil {
+		return nil, err
+	}
+	value, ok := nb.Options["debug_drop_collector_set"]
+	if !ok {
+		return []int{}, nil
 	}
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid debug_drop_collector_set %q: %s", value, err.Error())
+	}
+	return []int{id}, nil
+}
 
-	nbs := []NBGlobal{}
+// DomainIDs returns the observation domain IDs OVN drop samples could clash with: the one
+// drop samples are currently sent with, if drop sampling was already enabled by someone
+// else, and the IDs of the Sampling_Apps, which OVN uses as the domain of the samples
+// configured through the Sample tables.
+func (o *OVNClient) DomainIDs() ([]int, error) {
 	if !o.nb.Connected() {
-		return nil
+		return nil, fmt.Errorf("Client not connected")
+	}
+	nb, err := o.nbGlobal()
+	if err != nil {
+		return nil, err
+	}
+	ids := []int{}
+	if value, ok := nb.Options["debug_drop_domain_id"]; ok {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid debug_drop_domain_id %q: %s", value, err.Error())
+		}
+		ids = append(ids, id)
 	}
+	if o.nb.Has("Sampling_App") {
+		apps := []nbdb.SamplingApp{}
+		if err := o.nb.List(&apps); err != nil {
+			return nil, err
+		}
+		for _, app := range apps {
+			ids = append(ids, app.ID)
+		}
+	}
+	return ids, nil
+}
 
-	if err := o.nb.List(&nbs); err != nil {
+// SetDebugMode enables OVN drop sampling: drop samples are sent to the OVS
+// Flow_Sample_Collector_Set collectorSetID with observation domain domainID.
+func (o *OVNClient) SetDebugMode(collectorSetID, domainID int) error {
+	if domainID < 0 || domainID > 255 {
+		return fmt.Errorf("Invalid domain ID %d: must fit in 8 bits", domainID)
+	}
+	if err := o.setDebugOptions(map[string]string{
+		"debug_drop_collector_set": strconv.Itoa(collectorSetID),
+		"debug_drop_domain_id":     strconv.Itoa(domainID),
+	}); err != nil {
 		return err
 	}
-	nb := nbs[0]
+	o.log.Info("OVN Drop sampling: Enabled")
+	o.collectorSetID = collectorSetID
+	o.domainID = domainID
+	return nil
+}
 
-	mutateOps, err := o.nb.Where(&nb).Mutate(&nb,
-		model.Mutation{
-			Field:   &nb.Options,
-			Mutator: ovsdb.MutateOperationInsert,
-			Value:   map[string]string{"debug_drop_collector_set": "1"},
-		},
-		model.Mutation{
-			Field:   &nb.Options,
-			Mutator: ovsdb.MutateOperationInsert,
-			Value:   map[string]string{"debug_drop_domain_id": "1"},
-		})
+// setDebugOptions sets the given NB_Global options, saving the values they had before so
+// that Close can restore them.
+func (o *OVNClient) setDebugOptions(wanted map[string]string) error {
+	if !o.nb.Connected() {
+		return fmt.Errorf("Client not connected")
+	}
+
+	nb, err := o.nbGlobal()
 	if err != nil {
 		return err
 	}
-	response, err := o.nb.Transact(context.TODO(), mutateOps...)
-	logFields := logrus.Fields{
-		"operation": mutateOps,
-		"response":  response,
-		"err":       err,
+	if nb.Options == nil {
+		nb.Options = map[string]string{}
 	}
-	if err != nil {
-		o.log.WithFields(logFields).Error(err)
+
+	// Set them before the transaction so that the watchdog doesn't report our own change.
+	o.debugMutex.Lock()
+	previous := o.debugOptions
+	o.debugOptions = map[string]string{}
+	for option, value := range previous {
+		o.debugOptions[option] = value
 	}
-	if opErr, err := ovsdb.CheckOperationResults(response, mutateOps); err != nil {
-		o.log.WithFields(logFields).Errorf("%s: %+v", err.Error(), opErr)
+	if o.savedOptions == nil {
+		o.savedOptions = map[string]*string{}
+	}
+	for option, value := range wanted {
+		current, ok := nb.Options[option]
+		if _, ours := previous[option]; !ours {
+			if ok && current != value {
+				o.log.Warningf("NB_Global options:%s=%s was already set, probably by another tool. Overriding it with %s",
+					option, current, value)
+			}
+			if ok {
+				o.savedOptions[option] = &current
+			} else {
+				o.savedOptions[option] = nil
+			}
+		}
+		o.debugOptions[option] = value
+		nb.Options[option] = value
+	}
+	o.debugMutex.Unlock()
+
+	ops, err := o.nb.Where(nb).Update(nb, &nb.Options)
+	if err == nil {
+		var response []ovsdb.OperationResult
+		response, err = o.nb.Transact(context.TODO(), ops...)
+		o.log.WithFields(logrus.Fields{
+			"operation": ops,
+			"response":  response,
+			"err":       err,
+		}).Debug("OVN NB debug options")
+		if err == nil {
+			var opErr []ovsdb.OperationError
+			if opErr, err = ovsdb.CheckOperationResults(response, ops); err != nil {
+				err = fmt.Errorf("%s: %+v", err.Error(), opErr)
+			}
+		}
+	}
+	if err != nil {
+		o.debugMutex.Lock()
+		o.debugOptions = previous
+		o.debugMutex.Unlock()
+		return err
 	}
-	o.log.WithFields(logFields).Info("OVN Drop sampling: Enabled")
 	return nil
 }
 
@@ -232,7 +580,7 @@ ObservationDomainID has the following format
 | 31 ---- 24 | 23 ----------- 0|
   DomainID       Datapath Key
 
-If DomainID is the OVN Drop Debugging ID = 1 then, the ObservationPoitID is:
+If DomainID is the OVN Drop Debugging ID given to SetDebugMode then, the ObservationPoitID is:
 
 - The cookie (first 32 bits of the Logical Flow's UUID) if Datapath Key corresponds
 to an existing datapath.
@@ -245,7 +593,7 @@ func (o *OVNClient) getSampleInfo(sample *flowmessage.FlowMessage) (*SampleInfo,
 	domain := (obsDomainID & 0xFF000000) >> 24
 	tunnelKey := obsDomainID & 0x00FFFFFF
 
-	if domain != OVNDebugDomain {
+	if domain != uint32(o.domainID) {
 		return nil, fmt.Errorf("DomainID %d not supported for OVN Data extraction", domain)
 	}
 
@@ -256,20 +604,25 @@ func (o *OVNClient) getSampleInfo(sample *flowmessage.FlowMessage) (*SampleInfo,
 }
 
 func (o *OVNClient) getOVNDebugSampleInfo(tunnelKey, obsPointID uint32) (*SampleInfo, error) {
-	var lflow *LogicalFlow
+	var lflow *sbdb.LogicalFlow
+	var candidates []sbdb.LogicalFlow
+	var ambiguity string
 	var table int
-	var dpName string
+	var tableName, tableDesc string
+	var dpName, dpUUID string
 	var dpType DatapathType
 
 	if tunnelKey == 0 {
 		dpType = DatapathTypePhysical
 		table = int(obsPointID)
+		tableName, tableDesc = o.tables.Describe(table)
 	} else {
 		table = -1
 		dp, err := o.getDatapath(tunnelKey)
 		if err != nil {
 			return nil, err
 		}
+		dpUUID = dp.UUID
 		if ls, ok := dp.ExternalIDs["logical-switch"]; ok && ls != "" {
 			dpType = DatapathTypeSwitch
 			dpName = dp.ExternalIDs["name"]
@@ -279,47 +632,132 @@ func (o *OVNClient) getOVNDebugSampleInfo(tunnelKey, obsPointID uint32) (*Sample
 		} else {
 			return nil, fmt.Errorf("Datapath Binding from unsuported type: %#v", *dp)
 		}
-		lflow, err = o.getLFlow(obsPointID)
+		lflows, err := o.getLFlows(obsPointID)
 		if err != nil {
 			return nil, err
 		}
+		lflow, candidates, ambiguity = o.resolveLFlow(lflows, dp)
 	}
 
 	return &SampleInfo{
-		LogicalFlow:   lflow,
-		OpenFlowTable: table,
-		DatapathType:  dpType,
-		DatapathName:  dpName,
+		LogicalFlow:       lflow,
+		Candidates:        candidates,
+		Ambiguity:         ambiguity,
+		OpenFlowTable:     table,
+		OpenFlowTableName: tableName,
+		OpenFlowTableDesc: tableDesc,
+		DatapathType:      dpType,
+		DatapathName:      dpName,
+		DatapathUUID:      dpUUID,
 	}, nil
 
 }
 
-/* Look if there is a Logical Flow whose UUID starts with the hexadecimal
+/* Look for the Logical Flows whose UUID starts with the hexadecimal
 representation of the ObservationPointID.*/
-func (o *OVNClient) getLFlow(observationPointID uint32) (*LogicalFlow, error) {
-	lf := []LogicalFlow{}
+func (o *OVNClient) getLFlows(observationPointID uint32) ([]sbdb.LogicalFlow, error) {
+	lf := []sbdb.LogicalFlow{}
+	for _, uuid := range o.index.lookupLFlows(observationPointID) {
+		lflow := sbdb.LogicalFlow{UUID: uuid}
+		if err := o.sb.Get(&lflow); err == nil {
+			lf = append(lf, lflow)
+		}
+	}
 	obsString := fmt.Sprintf("%08x", int(observationPointID))
-	err := o.sb.WhereCache(
-		func(ls *LogicalFlow) bool {
-			return strings.HasPrefix(ls.UUID, obsString)
-		}).List(&lf)
-	if err != nil {
-		return nil, err
+	if len(lf) == 0 && o.index.allowScan("lflow/"+obsString) {
+		// The index might be missing the Logical Flow if a cache event was dropped.
+		err := o.sb.WhereCache(
+			func(ls *sbdb.LogicalFlow) bool {
+				return strings.HasPrefix(ls.UUID, obsString)
+			}).List(&lf)
+		if err != nil {
+			return nil, err
+		}
+		for i := range lf {
+			o.index.addLFlow(&lf[i])
+		}
 	}
 	if len(lf) == 0 {
 		return nil, fmt.Errorf("No LogicalFlow found with observationPointID %s", obsString)
 	}
-	if len(lf) > 1 {
-		o.log.Warningf("Duplicated LogicalFlow found with observationPointID %s", obsString)
+	return lf, nil
+}
+
+// lflowInDatapath returns whether the Logical Flow applies to the given datapath, either
+// directly or through its Logical Datapath Group.
+func (o *OVNClient) lflowInDatapath(lflow *sbdb.LogicalFlow, dp *sbdb.DatapathBinding) bool {
+	if lflow.LogicalDatapath != nil {
+		return *lflow.LogicalDatapath == dp.UUID
 	}
-	return &lf[0], nil
+	if lflow.LogicalDpGroup != nil {
+		group := sbdb.LogicalDPGroup{UUID: *lflow.LogicalDpGroup}
+		if err := o.sb.Get(&group); err != nil {
+			o.log.Debugf("Logical_DP_Group %s not found: %s", *lflow.LogicalDpGroup, err.Error())
+			return false
+		}
+		for _, member := range group.Datapaths {
+			if member == dp.UUID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveLFlow disambiguates the Logical Flows that share a cookie using the datapath
+// the sample was generated on. If a single Logical Flow remains, it is returned.
+// Otherwise, the remaining candidates are returned along with a description of the
+// ambiguity.
+func (o *OVNClient) resolveLFlow(lflows []sbdb.LogicalFlow, dp *sbdb.DatapathBinding) (*sbdb.LogicalFlow, []sbdb.LogicalFlow, string) {
+	matching := []sbdb.LogicalFlow{}
+	for i := range lflows {
+		if o.lflowInDatapath(&lflows[i], dp) {
+			matching = append(matching, lflows[i])
+		}
+	}
+	switch {
+	case len(matching) == 1:
+		return &matching[0], nil, ""
+	case len(matching) > 1:
+		return nil, matching, fmt.Sprintf("%d lflows in datapath", len(matching))
+	case len(lflows) == 1:
+		return &lflows[0], nil, "lflow not in datapath"
+	default:
+		return nil, lflows, fmt.Sprintf("%d lflows, none in datapath", len(lflows))
+	}
+}
+
+// commonField returns the value of the given field if it is the same in all the Logical
+// Flows or an empty string otherwise.
+func commonField(lflows []sbdb.LogicalFlow, field func(lflow *sbdb.LogicalFlow) string) string {
+	if len(lflows) == 0 {
+		return ""
+	}
+	value := field(&lflows[0])
+	for i := range lflows[1:] {
+		if field(&lflows[i+1]) != value {
+			return ""
+		}
+	}
+	return value
 }
 
 // Get the DatapathBinding object associated with the given tunnel_key
-func (o *OVNClient) getDatapath(tunnelKey uint32) (*DatapathBinding, error) {
-	dps := []DatapathBinding{}
+func (o *OVNClient) getDatapath(tunnelKey uint32) (*sbdb.DatapathBinding, error) {
+	if uuid, ok := o.index.lookupDatapath(int(tunnelKey)); ok {
+		dp := sbdb.DatapathBinding{UUID: uuid}
+		if err := o.sb.Get(&dp); err == nil && dp.TunnelKey == int(tunnelKey) {
+			return &dp, nil
+		}
+	}
+
+	// The index might be missing the Datapath Binding if a cache event was dropped.
+	if !o.index.allowScan(fmt.Sprintf("dp/%d", tunnelKey)) {
+		return nil, fmt.Errorf("No DatapathBinding found with TunnelKey %d", tunnelKey)
+	}
+	dps := []sbdb.DatapathBinding{}
 	err := o.sb.WhereCache(
-		func(dp *DatapathBinding) bool {
+		func(dp *sbdb.DatapathBinding) bool {
 			return dp.TunnelKey == int(tunnelKey)
 		}).List(&dps)
 
@@ -332,9 +770,19 @@ func (o *OVNClient) getDatapath(tunnelKey uint32) (*DatapathBinding, error) {
 	if len(dps) > 1 {
 		o.log.Warningf("Duplicated Logicadplow found with TunnelKey %d", tunnelKey)
 	}
+	o.index.addDatapath(&dps[0])
 	return &dps[0], nil
 }
 
+// stageName returns the stage of the logical flow: its external_ids:stage-name or, if not
+// set, the name of its table in the stages of the running OVN version.
+func (o *OVNClient) stageName(dpType DatapathType, lflow *sbdb.LogicalFlow) string {
+	if name := lflow.ExternalIDs["stage-name"]; name != "" {
+		return name
+	}
+	return o.stages.StageName(dpType, lflow.Pipeline, lflow.TableID)
+}
+
 func (o *OVNClient) Enrich(msg *flowmessage.FlowMessage, extra map[string]interface{}, log *logrus.Logger) map[string]interface{} {
 	sampleInfo, err := o.getSampleInfo(msg)
 	if err != nil {
@@ -346,10 +794,41 @@ func (o *OVNClient) Enrich(msg *flowmessage.FlowMessage, extra map[string]interf
 		extra["LFMatch"] = sampleInfo.LogicalFlow.Match
 		extra["LFActions"] = sampleInfo.LogicalFlow.Actions
 		extra["LFPipeline"] = string(sampleInfo.LogicalFlow.Pipeline)
-		extra["LFStage"] = string(sampleInfo.LogicalFlow.ExternalIDs["stage-name"])
+		extra["LFStage"] = o.stageName(sampleInfo.DatapathType, sampleInfo.LogicalFlow)
+		extra["NBDescription"] = o.describeStageHint(sampleInfo.LogicalFlow.ExternalIDs["stage-hint"])
+	} else if len(sampleInfo.Candidates) > 0 {
+		// Do not pick one of the candidates, only report what they have in common.
+		uuids := []string{}
+		for _, lflow := range sampleInfo.Candidates {
+			uuids = append(uuids, lflow.UUID)
+		}
+		extra["LFUUID"] = strings.Join(uuids, ",")
+		extra["LFMatch"] = commonField(sampleInfo.Candidates, func(lflow *sbdb.LogicalFlow) string { return lflow.Match })
+		extra["LFActions"] = commonField(sampleInfo.Candidates, func(lflow *sbdb.LogicalFlow) string { return lflow.Actions })
+		extra["LFPipeline"] = commonField(sampleInfo.Candidates, func(lflow *sbdb.LogicalFlow) string { return string(lflow.Pipeline) })
+		extra["LFStage"] = commonField(sampleInfo.Candidates, func(lflow *sbdb.LogicalFlow) string { return o.stageName(sampleInfo.DatapathType, lflow) })
+		if hint := commonField(sampleInfo.Candidates, func(lflow *sbdb.LogicalFlow) string { return lflow.ExternalIDs["stage-hint"] }); hint != "" {
+			extra["NBDescription"] = o.describeStageHint(hint)
+		}
 	}
+	extra["LFAmbiguity"] = sampleInfo.Ambiguity
 	extra["DPType"] = string(sampleInfo.DatapathType)
 	extra["DPName"] = string(sampleInfo.DatapathName)
 	extra["OFTable"] = sampleInfo.OpenFlowTable
+	if sampleInfo.DatapathType == DatapathTypePhysical {
+		extra["OFTableName"] = sampleInfo.OpenFlowTableName
+		extra["OFTableDesc"] = sampleInfo.OpenFlowTableDesc
+	}
+
+	src, dst := o.getSampleLogicalPorts(msg, extra, sampleInfo.DatapathUUID)
+	for prefix, lport := range map[string]*LogicalPortInfo{"Src": src, "Dst": dst} {
+		if lport == nil {
+			continue
+		}
+		extra[prefix+"LPort"] = lport.Name
+		extra[prefix+"LPortType"] = lport.Type
+		extra[prefix+"LPortChassis"] = lport.Chassis
+		extra[prefix+"LPortExtIDs"] = lport.ExternalIDsString()
+	}
 	return extra
 }
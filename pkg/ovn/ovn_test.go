@@ -0,0 +1,485 @@
+package ovn
+
+import (
+	"amorenoz/ovs-flowmon/pkg/dbmodel"
+	"amorenoz/ovs-flowmon/pkg/ovn/nbdb"
+	"amorenoz/ovs-flowmon/pkg/ovn/sbdb"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bombsimon/logrusr/v2"
+	flowmessage "github.com/netsampler/goflow2/pb"
+	"github.com/ovn-org/libovsdb/client"
+	"github.com/ovn-org/libovsdb/model"
+	"github.com/ovn-org/libovsdb/ovsdb"
+	"github.com/ovn-org/libovsdb/server"
+	"github.com/sirupsen/logrus"
+)
+
+// testServer serves the OVN NB and SB databases from memory on a unix socket.
+type testServer struct {
+	sock string
+	nb   *model.DBModel
+	sb   *model.DBModel
+}
+
+func newTestServer(tb testing.TB) *testServer {
+	nbModel, err := nbdb.FullDatabaseModel()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	sbModel, err := sbdb.FullDatabaseModel()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	nbSchema, sbSchema := nbdb.Schema(), sbdb.Schema()
+	db := server.NewInMemoryDatabase(map[string]*model.DBModel{
+		"OVN_Northbound": nbModel,
+		"OVN_Southbound": sbModel,
+	})
+	srv, err := server.NewOvsdbServer(db,
+		server.DatabaseModel{Model: nbModel, Schema: &nbSchema},
+		server.DatabaseModel{Model: sbModel, Schema: &sbSchema})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	s := &testServer{sock: filepath.Join(tb.TempDir(), "ovn.sock"), nb: nbModel, sb: sbModel}
+	go func() {
+		if err := srv.Serve("unix", s.sock); err != nil {
+			tb.Error(err)
+		}
+	}()
+	tb.Cleanup(srv.Close)
+	for i := 0; i < 100 && !srv.Ready(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return s
+}
+
+// testLogger returns the client option that discards the libovsdb logs.
+func testLogger() client.Option {
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	logr := logrusr.New(log)
+	return client.WithLogger(&logr)
+}
+
+// create inserts the rows in the database in batches and returns their UUIDs.
+func (s *testServer) create(tb testing.TB, dbModel *model.DBModel, rows []model.Model) []string {
+	writer, err := client.NewOVSDBClient(dbModel, client.WithEndpoint("unix:"+s.sock), testLogger())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := writer.Connect(context.Background()); err != nil {
+		tb.Fatal(err)
+	}
+	defer writer.Close()
+	uuids := []string{}
+	for len(rows) > 0 {
+		batch := rows
+		if len(batch) > 1000 {
+			batch = rows[:1000]
+		}
+		rows = rows[len(batch):]
+		ops, err := writer.Create(batch...)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		response, err := writer.Transact(context.Background(), ops...)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if opErr, err := ovsdb.CheckOperationResults(response, ops); err != nil {
+			tb.Fatalf("%s: %+v", err.Error(), opErr)
+		}
+		for _, result := range response[:len(ops)] {
+			uuids = append(uuids, result.UUID.GoUUID)
+		}
+	}
+	return uuids
+}
+
+// client returns a started OVNClient connected to the server.
+func (s *testServer) client(tb testing.TB) *OVNClient {
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	endpoint := client.WithEndpoint("unix:" + s.sock)
+	nb, err := dbmodel.NewClient("OVN_Northbound", nbTables, log, endpoint, testLogger())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	sb, err := dbmodel.NewClient("OVN_Southbound", sbTables, log, endpoint, testLogger())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	o := newOVNClient(nb, sb, log)
+	if err := o.Start(); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		o.nb.Close()
+		o.sb.Close()
+	})
+	return o
+}
+
+// testCluster is the content of a populated SB database.
+type testCluster struct {
+	lflows    []string
+	datapaths []string
+	portIPs   []net.IP
+}
+
+// populate adds the given number of datapaths to the SB database with lflows Logical
+// Flows and ports Port Bindings each.
+func (s *testServer) populate(tb testing.TB, datapaths, lflows, ports int) *testCluster {
+	c := &testCluster{}
+	rows := []model.Model{}
+	for dp := 1; dp <= datapaths; dp++ {
+		rows = append(rows, &sbdb.DatapathBinding{
+			TunnelKey:   dp,
+			ExternalIDs: map[string]string{"logical-switch": fmt.Sprintf("ls%d", dp), "name": fmt.Sprintf("ls%d", dp)},
+		})
+	}
+	c.datapaths = s.create(tb, s.sb, rows)
+
+	rows = []model.Model{}
+	for dp, uuid := range c.datapaths {
+		uuid := uuid
+		for i := 0; i < lflows; i++ {
+			rows = append(rows, &sbdb.LogicalFlow{
+				LogicalDatapath: &uuid,
+				Pipeline:        sbdb.LogicalFlowPipelineIngress,
+				TableID:         i % 30,
+				Priority:        i,
+				Match:           fmt.Sprintf("ip4.dst == 10.%d.%d.%d", dp, i/256, i%256),
+				Actions:         "drop;",
+			})
+		}
+	}
+	c.lflows = s.create(tb, s.sb, rows)
+
+	rows = []model.Model{}
+	for dp, uuid := range c.datapaths {
+		for i := 0; i < ports; i++ {
+			ip := net.IPv4(10, byte(dp), byte(i/256), byte(i%256))
+			c.portIPs = append(c.portIPs, ip)
+			rows = append(rows, &sbdb.PortBinding{
+				Datapath:    uuid,
+				LogicalPort: fmt.Sprintf("port-%d-%d", dp, i),
+				TunnelKey:   i + 1,
+				MAC:         []string{fmt.Sprintf("0a:58:0a:%02x:%02x:%02x %s", dp, i/256, i%256, ip)},
+			})
+		}
+	}
+	s.create(tb, s.sb, rows)
+	return c
+}
+
+// sample returns the drop sample OVN would send for the nth Logical Flow of the cluster.
+func (c *testCluster) sample(o *OVNClient, n int) *flowmessage.FlowMessage {
+	n %= len(c.lflows)
+	cookie, _ := lflowCookie(c.lflows[n])
+	tunnelKey := uint32(n/(len(c.lflows)/len(c.datapaths)) + 1)
+	return &flowmessage.FlowMessage{
+		ObservationDomainID: uint32(o.domainID)<<24 | tunnelKey,
+		ObservationPointID:  cookie,
+		SrcAddr:             c.portIPs[n%len(c.portIPs)],
+		DstAddr:             c.portIPs[(n+1)%len(c.portIPs)],
+	}
+}
+
+func TestGetLFlowsMiss(t *testing.T) {
+	s := newTestServer(t)
+	c := s.populate(t, 2, 10, 1)
+	o := s.client(t)
+
+	for _, uuid := range c.lflows {
+		cookie, _ := lflowCookie(uuid)
+		if lflows, err := o.getLFlows(cookie); err != nil || len(lflows) != 1 || lflows[0].UUID != uuid {
+			t.Fatalf("getLFlows(%08x) = %v, %v", cookie, lflows, err)
+		}
+	}
+	// Remove a Logical Flow from the index as if its cache event was dropped.
+	lflow := &sbdb.LogicalFlow{UUID: c.lflows[0]}
+	o.index.deleteLFlow(lflow)
+	cookie, _ := lflowCookie(lflow.UUID)
+	if lflows, err := o.getLFlows(cookie); err != nil || len(lflows) != 1 {
+		t.Fatalf("getLFlows(%08x) did not scan the cache: %v, %v", cookie, lflows, err)
+	}
+	if uuids := o.index.lookupLFlows(cookie); len(uuids) != 1 {
+		t.Errorf("the Logical Flow found by the scan was not indexed: %v", uuids)
+	}
+
+	// Unknown keys are only scanned for once per indexScanInterval.
+	unknown := cookie + 1
+	if _, err := o.getLFlows(unknown); err == nil {
+		t.Fatalf("getLFlows(%08x) found an unknown Logical Flow", unknown)
+	}
+	if o.index.allowScan(fmt.Sprintf("lflow/%08x", unknown)) {
+		t.Errorf("a second scan for %08x is allowed", unknown)
+	}
+	if _, err := o.getDatapath(100); err == nil {
+		t.Fatal("getDatapath(100) found an unknown datapath")
+	}
+	if o.index.allowScan("dp/100") {
+		t.Error("a second scan for datapath 100 is allowed")
+	}
+}
+
+func TestEnrich(t *testing.T) {
+	s := newTestServer(t)
+	c := s.populate(t, 2, 10, 2)
+	o := s.client(t)
+
+	extra := o.Enrich(c.sample(o, 3), map[string]interface{}{}, o.log)
+	if extra["LFUUID"] != c.lflows[3] {
+		t.Errorf("LFUUID = %v, want %s", extra["LFUUID"], c.lflows[3])
+	}
+	if extra["DPName"] != "ls1" || extra["DPType"] != string(DatapathTypeSwitch) || extra["LFAmbiguity"] != "" {
+		t.Errorf("datapath = %v %v (%v), want ls1 %s", extra["DPName"], extra["DPType"], extra["LFAmbiguity"], DatapathTypeSwitch)
+	}
+	if extra["SrcLPort"] != "port-1-1" || extra["DstLPort"] != "port-0-0" {
+		t.Errorf("ports = %v -> %v, want port-1-1 -> port-0-0", extra["SrcLPort"], extra["DstLPort"])
+	}
+	// The Logical Flows have no external_ids:stage-name, the stage comes from their table.
+	if extra["LFStage"] != "ls_in_put_fdb" {
+		t.Errorf("LFStage = %v, want ls_in_put_fdb", extra["LFStage"])
+	}
+}
+
+func TestResolveLFlow(t *testing.T) {
+	s := newTestServer(t)
+	dp1, dp2, group := "dp1", "dp2", "group"
+	uuids := s.create(t, s.sb, []model.Model{
+		&sbdb.DatapathBinding{UUID: dp1, TunnelKey: 1},
+		&sbdb.DatapathBinding{UUID: dp2, TunnelKey: 2},
+		&sbdb.DatapathBinding{TunnelKey: 3},
+		&sbdb.LogicalDPGroup{UUID: group, Datapaths: []string{dp1, dp2}},
+		&sbdb.LogicalFlow{LogicalDatapath: &dp1, Pipeline: sbdb.LogicalFlowPipelineIngress, Match: "dp1"},
+		&sbdb.LogicalFlow{LogicalDpGroup: &group, Pipeline: sbdb.LogicalFlowPipelineIngress, Match: "group"},
+		&sbdb.LogicalFlow{LogicalDatapath: &dp2, Pipeline: sbdb.LogicalFlowPipelineIngress, Match: "dp2"},
+	})
+	o := s.client(t)
+	dps := map[string]*sbdb.DatapathBinding{}
+	for name, uuid := range map[string]string{"dp1": uuids[0], "dp2": uuids[1], "dp3": uuids[2]} {
+		dps[name] = &sbdb.DatapathBinding{UUID: uuid}
+		if err := o.sb.Get(dps[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lflows := map[string]sbdb.LogicalFlow{}
+	for _, uuid := range uuids[4:] {
+		lflow := sbdb.LogicalFlow{UUID: uuid}
+		if err := o.sb.Get(&lflow); err != nil {
+			t.Fatal(err)
+		}
+		lflows[lflow.Match] = lflow
+	}
+	list := func(matches ...string) []sbdb.LogicalFlow {
+		l := []sbdb.LogicalFlow{}
+		for _, match := range matches {
+			l = append(l, lflows[match])
+		}
+		return l
+	}
+
+	tests := []struct {
+		name       string
+		lflows     []sbdb.LogicalFlow
+		dp         string
+		lflow      string
+		candidates []string
+		ambiguity  string
+	}{
+		{name: "datapath", lflows: list("dp1", "dp2"), dp: "dp1", lflow: "dp1"},
+		{name: "datapath group", lflows: list("group", "dp1"), dp: "dp2", lflow: "group"},
+		{name: "datapath and group", lflows: list("dp1", "group", "dp2"), dp: "dp1",
+			candidates: []string{"dp1", "group"}, ambiguity: "2 lflows in datapath"},
+		{name: "single not in datapath", lflows: list("dp2"), dp: "dp3", lflow: "dp2", ambiguity: "lflow not in datapath"},
+		{name: "none in datapath", lflows: list("dp1", "group"), dp: "dp3",
+			candidates: []string{"dp1", "group"}, ambiguity: "2 lflows, none in datapath"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lflow, candidates, ambiguity := o.resolveLFlow(tt.lflows, dps[tt.dp])
+			match := ""
+			if lflow != nil {
+				match = lflow.Match
+			}
+			var matches []string
+			for _, candidate := range candidates {
+				matches = append(matches, candidate.Match)
+			}
+			if match != tt.lflow || !reflect.DeepEqual(matches, tt.candidates) || ambiguity != tt.ambiguity {
+				t.Errorf("resolveLFlow() = %q, %v, %q, want %q, %v, %q", match, matches, ambiguity,
+					tt.lflow, tt.candidates, tt.ambiguity)
+			}
+		})
+	}
+}
+
+// eventually waits until cond is true.
+func eventually(t *testing.T, what string, cond func() bool) {
+	for i := 0; i < 500; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestDebugModeRestore(t *testing.T) {
+	s := newTestServer(t)
+	o := s.client(t)
+	if err := o.SetDebugMode(42, 7); err == nil || !strings.Contains(err.Error(), "No NB_Global") {
+		t.Fatalf("SetDebugMode without NB_Global returned %v", err)
+	}
+	if _, err := o.CollectorSetIDs(); err == nil {
+		t.Fatal("CollectorSetIDs without NB_Global did not fail")
+	}
+	if err := o.restoreDebugMode(); err != nil {
+		t.Fatalf("restoreDebugMode without changes returned %v", err)
+	}
+
+	s.create(t, s.nb, []model.Model{&nbdb.NBGlobal{
+		Options: map[string]string{"debug_drop_domain_id": "5", "other": "x"},
+	}})
+	eventually(t, "NB_Global", func() bool {
+		_, err := o.nbGlobal()
+		return err == nil
+	})
+	if err := o.SetDebugMode(42, 7); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"debug_drop_collector_set": "42", "debug_drop_domain_id": "7", "other": "x"}
+	eventually(t, "the debug options", func() bool {
+		nb, err := o.nbGlobal()
+		return err == nil && reflect.DeepEqual(nb.Options, want)
+	})
+	if ids, err := o.CollectorSetIDs(); err != nil || !reflect.DeepEqual(ids, []int{42}) {
+		t.Errorf("CollectorSetIDs() = %v, %v, want [42]", ids, err)
+	}
+
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{"debug_drop_domain_id": "5", "other": "x"}
+	reader := s.client(t)
+	eventually(t, "the restored options", func() bool {
+		nb, err := reader.nbGlobal()
+		return err == nil && reflect.DeepEqual(nb.Options, want)
+	})
+}
+
+func TestDomainIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		options map[string]string
+		apps    []int
+		ids     []int
+		ok      bool
+	}{
+		{name: "none", options: map[string]string{}, ids: []int{}, ok: true},
+		{name: "drop sampling enabled", options: map[string]string{"debug_drop_domain_id": "5"}, ids: []int{5}, ok: true},
+		{name: "sampling apps", options: map[string]string{"debug_drop_domain_id": "5"}, apps: []int{2, 3}, ids: []int{2, 3, 5}, ok: true},
+		{name: "invalid option", options: map[string]string{"debug_drop_domain_id": "x"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			o := s.client(t)
+			rows := []model.Model{&nbdb.NBGlobal{Options: tt.options}}
+			for _, id := range tt.apps {
+				rows = append(rows, &nbdb.SamplingApp{Type: nbdb.SamplingAppTypeDrop, ID: id})
+			}
+			s.create(t, s.nb, rows)
+			eventually(t, "the NB rows", func() bool {
+				apps := []nbdb.SamplingApp{}
+				_, err := o.nbGlobal()
+				return err == nil && o.nb.List(&apps) == nil && len(apps) == len(tt.apps)
+			})
+			ids, err := o.DomainIDs()
+			if (err == nil) != tt.ok {
+				t.Fatalf("DomainIDs() error = %v, want ok %v", err, tt.ok)
+			}
+			sort.Ints(ids)
+			if tt.ok && !reflect.DeepEqual(ids, tt.ids) {
+				t.Errorf("DomainIDs() = %v, want %v", ids, tt.ids)
+			}
+		})
+	}
+}
+
+// benchTB keeps the benchmark fixture alive across benchmark runs: populating a large
+// database takes much longer than the benchmarks themselves.
+type benchTB struct {
+	testing.TB
+}
+
+func (benchTB) Cleanup(func()) {}
+
+func (b benchTB) TempDir() string {
+	dir, err := ioutil.TempDir("", "ovn-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	return dir
+}
+
+var bench struct {
+	once    sync.Once
+	client  *OVNClient
+	cluster *testCluster
+}
+
+// benchFixture returns a client of a database with 100 datapaths with 500 Logical
+// Flows and 100 Port Bindings each.
+func benchFixture(b *testing.B) (*OVNClient, *testCluster) {
+	bench.once.Do(func() {
+		s := newTestServer(benchTB{b})
+		bench.cluster = s.populate(b, 100, 500, 100)
+		bench.client = s.client(benchTB{b})
+	})
+	if bench.client == nil {
+		b.Fatal("benchmark fixture not available")
+	}
+	return bench.client, bench.cluster
+}
+
+func BenchmarkLookup(b *testing.B) {
+	o, c := benchFixture(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		cookie, _ := lflowCookie(c.lflows[n%len(c.lflows)])
+		if _, err := o.getLFlows(cookie); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := o.getDatapath(uint32(n%len(c.datapaths) + 1)); err != nil {
+			b.Fatal(err)
+		}
+		o.index.lookupPortsByIP(c.portIPs[n%len(c.portIPs)])
+	}
+}
+
+func BenchmarkEnrich(b *testing.B) {
+	o, c := benchFixture(b)
+	samples := make([]*flowmessage.FlowMessage, 1000)
+	for n := range samples {
+		samples[n] = c.sample(o, n*37)
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		o.Enrich(samples[n%len(samples)], map[string]interface{}{}, o.log)
+	}
+}
@@ -0,0 +1,11 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package sbdb
+
+// Chassis defines an object in Chassis table
+type Chassis struct {
+	UUID     string `ovsdb:"_uuid"`
+	Hostname string `ovsdb:"hostname"`
+	Name     string `ovsdb:"name"`
+}
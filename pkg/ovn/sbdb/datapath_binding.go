@@ -0,0 +1,11 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package sbdb
+
+// DatapathBinding defines an object in Datapath_Binding table
+type DatapathBinding struct {
+	UUID        string            `ovsdb:"_uuid"`
+	ExternalIDs map[string]string `ovsdb:"external_ids"`
+	TunnelKey   int               `ovsdb:"tunnel_key"`
+}
@@ -0,0 +1,22 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package sbdb
+
+type (
+	EncapType = string
+)
+
+var (
+	EncapTypeGeneve EncapType = "geneve"
+	EncapTypeSTT    EncapType = "stt"
+	EncapTypeVxlan  EncapType = "vxlan"
+)
+
+// Encap defines an object in Encap table
+type Encap struct {
+	UUID        string    `ovsdb:"_uuid"`
+	ChassisName string    `ovsdb:"chassis_name"`
+	IP          string    `ovsdb:"ip"`
+	Type        EncapType `ovsdb:"type"`
+}
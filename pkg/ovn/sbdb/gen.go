@@ -0,0 +1,7 @@
+// Package sbdb contains the libovsdb models of the OVN_Southbound tables used by
+// ovs-flowmon. ovn-sb.ovsschema is generated from the upstream schema of the release
+// pinned in hack/update-schemas.sh and keeps only the tables and columns listed in
+// ovn-sb.tables: do not edit it, list the columns there and run make update-schemas.
+package sbdb
+
+//go:generate go run github.com/ovn-org/libovsdb/cmd/modelgen -p sbdb -o . ovn-sb.ovsschema
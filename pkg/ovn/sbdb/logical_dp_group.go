@@ -0,0 +1,10 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package sbdb
+
+// LogicalDPGroup defines an object in Logical_DP_Group table
+type LogicalDPGroup struct {
+	UUID      string   `ovsdb:"_uuid"`
+	Datapaths []string `ovsdb:"datapaths"`
+}
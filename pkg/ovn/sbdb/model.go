@@ -0,0 +1,284 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package sbdb
+
+import (
+	"encoding/json"
+
+	"github.com/ovn-org/libovsdb/model"
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+// FullDatabaseModel returns the DatabaseModel object to be used in libovsdb
+func FullDatabaseModel() (*model.DBModel, error) {
+	return model.NewDBModel("OVN_Southbound", map[string]model.Model{
+		"Chassis":          &Chassis{},
+		"Datapath_Binding": &DatapathBinding{},
+		"Encap":            &Encap{},
+		"Logical_DP_Group": &LogicalDPGroup{},
+		"Logical_Flow":     &LogicalFlow{},
+		"Port_Binding":     &PortBinding{},
+	})
+}
+
+var schema = `{
+  "name": "OVN_Southbound",
+  "version": "20.37.0",
+  "tables": {
+    "Chassis": {
+      "columns": {
+        "hostname": {
+          "type": "string"
+        },
+        "name": {
+          "type": "string"
+        }
+      },
+      "indexes": [
+        [
+          "name"
+        ]
+      ]
+    },
+    "Datapath_Binding": {
+      "columns": {
+        "external_ids": {
+          "type": {
+            "key": {
+              "type": "string"
+            },
+            "value": {
+              "type": "string"
+            },
+            "min": 0,
+            "max": "unlimited"
+          }
+        },
+        "tunnel_key": {
+          "type": {
+            "key": {
+              "type": "integer",
+              "minInteger": 1,
+              "maxInteger": 16777215
+            }
+          }
+        }
+      },
+      "indexes": [
+        [
+          "tunnel_key"
+        ]
+      ]
+    },
+    "Encap": {
+      "columns": {
+        "chassis_name": {
+          "type": "string"
+        },
+        "ip": {
+          "type": "string"
+        },
+        "type": {
+          "type": {
+            "key": {
+              "type": "string",
+              "enum": [
+                "set",
+                [
+                  "geneve",
+                  "stt",
+                  "vxlan"
+                ]
+              ]
+            }
+          }
+        }
+      },
+      "indexes": [
+        [
+          "type",
+          "ip"
+        ]
+      ]
+    },
+    "Logical_DP_Group": {
+      "columns": {
+        "datapaths": {
+          "type": {
+            "key": {
+              "type": "uuid",
+              "refTable": "Datapath_Binding",
+              "refType": "weak"
+            },
+            "min": 0,
+            "max": "unlimited"
+          }
+        }
+      }
+    },
+    "Logical_Flow": {
+      "columns": {
+        "actions": {
+          "type": "string"
+        },
+        "external_ids": {
+          "type": {
+            "key": {
+              "type": "string"
+            },
+            "value": {
+              "type": "string"
+            },
+            "min": 0,
+            "max": "unlimited"
+          }
+        },
+        "logical_datapath": {
+          "type": {
+            "key": {
+              "type": "uuid",
+              "refTable": "Datapath_Binding"
+            },
+            "min": 0,
+            "max": 1
+          }
+        },
+        "logical_dp_group": {
+          "type": {
+            "key": {
+              "type": "uuid",
+              "refTable": "Logical_DP_Group"
+            },
+            "min": 0,
+            "max": 1
+          }
+        },
+        "match": {
+          "type": "string"
+        },
+        "pipeline": {
+          "type": {
+            "key": {
+              "type": "string",
+              "enum": [
+                "set",
+                [
+                  "ingress",
+                  "egress"
+                ]
+              ]
+            }
+          }
+        },
+        "priority": {
+          "type": {
+            "key": {
+              "type": "integer",
+              "minInteger": 0,
+              "maxInteger": 65535
+            }
+          }
+        },
+        "table_id": {
+          "type": {
+            "key": {
+              "type": "integer",
+              "minInteger": 0,
+              "maxInteger": 32
+            }
+          }
+        },
+        "tags": {
+          "type": {
+            "key": {
+              "type": "string"
+            },
+            "value": {
+              "type": "string"
+            },
+            "min": 0,
+            "max": "unlimited"
+          }
+        }
+      }
+    },
+    "Port_Binding": {
+      "columns": {
+        "chassis": {
+          "type": {
+            "key": {
+              "type": "uuid",
+              "refTable": "Chassis",
+              "refType": "weak"
+            },
+            "min": 0,
+            "max": 1
+          }
+        },
+        "datapath": {
+          "type": {
+            "key": {
+              "type": "uuid",
+              "refTable": "Datapath_Binding"
+            }
+          }
+        },
+        "external_ids": {
+          "type": {
+            "key": {
+              "type": "string"
+            },
+            "value": {
+              "type": "string"
+            },
+            "min": 0,
+            "max": "unlimited"
+          }
+        },
+        "logical_port": {
+          "type": "string"
+        },
+        "mac": {
+          "type": {
+            "key": {
+              "type": "string"
+            },
+            "min": 0,
+            "max": "unlimited"
+          }
+        },
+        "tunnel_key": {
+          "type": {
+            "key": {
+              "type": "integer",
+              "minInteger": 1,
+              "maxInteger": 32767
+            }
+          }
+        },
+        "type": {
+          "type": "string"
+        }
+      },
+      "indexes": [
+        [
+          "datapath",
+          "tunnel_key"
+        ],
+        [
+          "logical_port"
+        ]
+      ]
+    }
+  }
+}`
+
+func Schema() ovsdb.DatabaseSchema {
+	var s ovsdb.DatabaseSchema
+	err := json.Unmarshal([]byte(schema), &s)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
@@ -0,0 +1,16 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package sbdb
+
+// PortBinding defines an object in Port_Binding table
+type PortBinding struct {
+	UUID        string            `ovsdb:"_uuid"`
+	Chassis     *string           `ovsdb:"chassis"`
+	Datapath    string            `ovsdb:"datapath"`
+	ExternalIDs map[string]string `ovsdb:"external_ids"`
+	LogicalPort string            `ovsdb:"logical_port"`
+	MAC         []string          `ovsdb:"mac"`
+	TunnelKey   int               `ovsdb:"tunnel_key"`
+	Type        string            `ovsdb:"type"`
+}
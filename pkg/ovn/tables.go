@@ -0,0 +1,267 @@
+package ovn
+
+import (
+	"amorenoz/ovs-flowmon/pkg/ovn/sbdb"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ofTable describes an OpenFlow table ovn-controller installs flows in.
+type ofTable struct {
+	Name        string
+	Description string
+}
+
+// ofTableLayout is the list of OpenFlow tables used by a range of OVN versions.
+type ofTableLayout struct {
+	// OVN releases the layout applies to.
+	Releases string
+	// Minimum OVN_Southbound schema version the layout applies to.
+	MinSchema string
+	// First tables of the logical ingress and egress pipelines. Logical table N is
+	// OpenFlow table IngressBase + N (or EgressBase + N).
+	IngressBase int
+	EgressBase  int
+	Tables      map[int]ofTable
+}
+
+var (
+	commonTables = map[int]ofTable{
+		0:  {"PHY_TO_LOG", "Physical to logical translation: identifies the logical datapath and port of packets received from VIFs, tunnels and localnet ports"},
+		64: {"SAVE_INPORT", "Clears the logical inport so that packets can be sent back through it (e.g: hairpin)"},
+		65: {"LOG_TO_PHY", "Logical to physical translation: delivers the packet to the physical port bound to the logical outport"},
+		66: {"MAC_BINDING", "Looks up IP to MAC bindings (get_arp/get_nd)"},
+		67: {"MAC_LOOKUP", "Checks IP to MAC bindings (lookup_arp/lookup_nd)"},
+		68: {"CHK_LB_HAIRPIN", "Checks whether load balanced traffic is hairpinned"},
+		69: {"CHK_LB_HAIRPIN_REPLY", "Checks whether load balanced traffic is the reply of a hairpinned connection"},
+		70: {"CT_SNAT_HAIRPIN", "SNATs hairpinned load balanced traffic"},
+		71: {"GET_FDB", "Looks up the port of a MAC address in the FDB (get_fdb)"},
+		72: {"LOOKUP_FDB", "Checks whether a MAC address is learnt on a port in the FDB (lookup_fdb)"},
+	}
+	portSecTables = map[int]ofTable{
+		73: {"CHK_IN_PORT_SEC", "Ingress port security checks"},
+		74: {"CHK_IN_PORT_SEC_ND", "Ingress port security checks of ND packets"},
+		75: {"CHK_OUT_PORT_SEC", "Egress port security checks"},
+		76: {"ECMP_NH_MAC", "Stores the MAC address of ECMP next hops"},
+		77: {"ECMP_NH", "Stores the ECMP next hops of symmetric reply traffic"},
+	}
+	largePktTables = map[int]ofTable{
+		37: {"OUTPUT_LARGE_PKT_DETECT", "Detects packets larger than the outport's MTU"},
+		38: {"OUTPUT_LARGE_PKT_PROCESS", "Generates ICMP need-frag replies for packets larger than the outport's MTU"},
+		39: {"REMOTE_OUTPUT", "Sends packets whose logical outport is bound to a remote chassis through a tunnel"},
+		40: {"LOCAL_OUTPUT", "Resubmits packets whose logical outport is bound to the local chassis to the egress pipeline"},
+		41: {"CHECK_LOOPBACK", "Drops packets whose logical inport and outport are the same"},
+		78: {"CHK_LB_AFFINITY", "Checks load balancer session affinity"},
+		79: {"MAC_CACHE_USE", "Tracks the use of MAC bindings and FDB entries"},
+	}
+	legacyOutputTables = map[int]ofTable{
+		37: {"REMOTE_OUTPUT", "Sends packets whose logical outport is bound to a remote chassis through a tunnel"},
+		38: {"LOCAL_OUTPUT", "Resubmits packets whose logical outport is bound to the local chassis to the egress pipeline"},
+		39: {"CHECK_LOOPBACK", "Drops packets whose logical inport and outport are the same"},
+	}
+
+	// ofTableLayouts is sorted from newest to oldest.
+	ofTableLayouts = []ofTableLayout{
+		{
+			Releases:    ">= 22.12",
+			MinSchema:   "20.27.0",
+			IngressBase: 8,
+			EgressBase:  42,
+			Tables:      mergeTables(commonTables, portSecTables, largePktTables),
+		},
+		{
+			Releases:    "22.09",
+			MinSchema:   "20.25.0",
+			IngressBase: 8,
+			EgressBase:  40,
+			Tables:      mergeTables(commonTables, portSecTables, legacyOutputTables),
+		},
+		{
+			Releases:    "<= 22.06",
+			MinSchema:   "0.0.0",
+			IngressBase: 8,
+			EgressBase:  40,
+			Tables:      mergeTables(commonTables, legacyOutputTables),
+		},
+	}
+)
+
+func mergeTables(tables ...map[int]ofTable) map[int]ofTable {
+	merged := map[int]ofTable{}
+	for _, t := range tables {
+		for id, table := range t {
+			merged[id] = table
+		}
+	}
+	return merged
+}
+
+// compareVersions compares two "x.y.z" versions. Returns a negative number if a < b, zero
+// if a == b and a positive number if a > b.
+func compareVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var av, bv int
+		if i < len(as) {
+			av, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			bv, _ = strconv.Atoi(bs[i])
+		}
+		if av != bv {
+			return av - bv
+		}
+	}
+	return 0
+}
+
+// selectTableLayout returns the OpenFlow table layout used by the OVN version that has the
+// given OVN_Southbound schema version.
+func selectTableLayout(schemaVersion string) *ofTableLayout {
+	for i := range ofTableLayouts {
+		if compareVersions(schemaVersion, ofTableLayouts[i].MinSchema) >= 0 {
+			return &ofTableLayouts[i]
+		}
+	}
+	return &ofTableLayouts[len(ofTableLayouts)-1]
+}
+
+// Describe returns the name and explanation of the given OpenFlow table.
+func (l *ofTableLayout) Describe(table int) (string, string) {
+	if t, ok := l.Tables[table]; ok {
+		return fmt.Sprintf("table %d (%s)", table, t.Name), t.Description
+	}
+	// Logical pipelines span from their base to the next known table.
+	if table >= l.EgressBase && table < 64 {
+		n := table - l.EgressBase
+		return fmt.Sprintf("table %d (LOG_EGRESS_PIPELINE+%d)", table, n),
+			fmt.Sprintf("Logical egress pipeline table %d", n)
+	}
+	if table >= l.IngressBase && table < l.EgressBase {
+		n := table - l.IngressBase
+		return fmt.Sprintf("table %d (LOG_INGRESS_PIPELINE+%d)", table, n),
+			fmt.Sprintf("Logical ingress pipeline table %d", n)
+	}
+	return fmt.Sprintf("table %d", table), ""
+}
+
+// stageLayout is the list of logical flow stages of a range of OVN versions.
+type stageLayout struct {
+	// OVN releases the layout applies to.
+	Releases string
+	// Minimum OVN_Southbound schema version the layout applies to.
+	MinSchema string
+	// Stage names indexed by datapath type and pipeline and then by table_id.
+	Stages map[stagePipeline][]string
+}
+
+// stagePipeline identifies a logical pipeline of a type of datapath.
+type stagePipeline struct {
+	dpType   DatapathType
+	pipeline string
+}
+
+var (
+	lsIngress = stagePipeline{DatapathTypeSwitch, sbdb.LogicalFlowPipelineIngress}
+	lsEgress  = stagePipeline{DatapathTypeSwitch, sbdb.LogicalFlowPipelineEgress}
+	lrIngress = stagePipeline{DatapathTypeRouter, sbdb.LogicalFlowPipelineIngress}
+	lrEgress  = stagePipeline{DatapathTypeRouter, sbdb.LogicalFlowPipelineEgress}
+
+	// stageLayouts is sorted from newest to oldest. Older versions are not listed, their
+	// logical flows are only described by their external_ids:stage-name.
+	stageLayouts = []stageLayout{
+		{
+			Releases:  ">= 24.09",
+			MinSchema: "20.37.0",
+			Stages: map[stagePipeline][]string{
+				lsIngress: {
+					"ls_in_check_port_sec", "ls_in_apply_port_sec", "ls_in_lookup_fdb", "ls_in_put_fdb",
+					"ls_in_pre_acl", "ls_in_pre_lb", "ls_in_pre_stateful", "ls_in_acl_hint",
+					"ls_in_acl_eval", "ls_in_acl_sample", "ls_in_acl_action", "ls_in_qos",
+					"ls_in_lb_aff_check", "ls_in_lb", "ls_in_lb_aff_learn", "ls_in_pre_hairpin",
+					"ls_in_nat_hairpin", "ls_in_hairpin", "ls_in_acl_after_lb_eval",
+					"ls_in_acl_after_lb_sample", "ls_in_acl_after_lb_action", "ls_in_stateful",
+					"ls_in_arp_rsp", "ls_in_dhcp_options", "ls_in_dhcp_response", "ls_in_dns_lookup",
+					"ls_in_dns_response", "ls_in_external_port", "ls_in_l2_lkup", "ls_in_l2_unknown",
+				},
+				lsEgress: {
+					"ls_out_lookup_fdb", "ls_out_pre_acl", "ls_out_pre_lb", "ls_out_pre_stateful",
+					"ls_out_acl_hint", "ls_out_acl_eval", "ls_out_acl_sample", "ls_out_acl_action",
+					"ls_out_qos", "ls_out_stateful", "ls_out_check_port_sec", "ls_out_apply_port_sec",
+				},
+				lrIngress: {
+					"lr_in_admission", "lr_in_lookup_neighbor", "lr_in_learn_neighbor", "lr_in_ip_input",
+					"lr_in_dhcp_relay_req", "lr_in_unsnat", "lr_in_defrag", "lr_in_lb_aff_check",
+					"lr_in_dnat", "lr_in_lb_aff_learn", "lr_in_ecmp_stateful", "lr_in_nd_ra_options",
+					"lr_in_nd_ra_response", "lr_in_ip_routing_pre", "lr_in_ip_routing",
+					"lr_in_ip_routing_ecmp", "lr_in_policy", "lr_in_policy_ecmp",
+					"lr_in_dhcp_relay_resp_chk", "lr_in_dhcp_relay_resp", "lr_in_arp_resolve",
+					"lr_in_chk_pkt_len", "lr_in_larger_pkts", "lr_in_gw_redirect", "lr_in_arp_request",
+				},
+				lrEgress: {
+					"lr_out_chk_dnat_local", "lr_out_undnat", "lr_out_post_undnat", "lr_out_snat",
+					"lr_out_post_snat", "lr_out_egr_loop", "lr_out_delivery",
+				},
+			},
+		},
+		{
+			Releases:  "23.09 - 24.03",
+			MinSchema: "20.29.0",
+			Stages: map[stagePipeline][]string{
+				lsIngress: {
+					"ls_in_check_port_sec", "ls_in_apply_port_sec", "ls_in_lookup_fdb", "ls_in_put_fdb",
+					"ls_in_pre_acl", "ls_in_pre_lb", "ls_in_pre_stateful", "ls_in_acl_hint",
+					"ls_in_acl_eval", "ls_in_acl_action", "ls_in_qos_mark", "ls_in_qos_meter",
+					"ls_in_lb_aff_check", "ls_in_lb", "ls_in_lb_aff_learn", "ls_in_pre_hairpin",
+					"ls_in_nat_hairpin", "ls_in_hairpin", "ls_in_acl_after_lb_eval",
+					"ls_in_acl_after_lb_action", "ls_in_stateful", "ls_in_arp_rsp", "ls_in_dhcp_options",
+					"ls_in_dhcp_response", "ls_in_dns_lookup", "ls_in_dns_response",
+					"ls_in_external_port", "ls_in_l2_lkup", "ls_in_l2_unknown",
+				},
+				lsEgress: {
+					"ls_out_pre_acl", "ls_out_pre_lb", "ls_out_pre_stateful", "ls_out_acl_hint",
+					"ls_out_acl_eval", "ls_out_acl_action", "ls_out_qos_mark", "ls_out_qos_meter",
+					"ls_out_stateful", "ls_out_check_port_sec", "ls_out_apply_port_sec",
+				},
+				lrIngress: {
+					"lr_in_admission", "lr_in_lookup_neighbor", "lr_in_learn_neighbor", "lr_in_ip_input",
+					"lr_in_unsnat", "lr_in_defrag", "lr_in_lb_aff_check", "lr_in_dnat",
+					"lr_in_lb_aff_learn", "lr_in_ecmp_stateful", "lr_in_nd_ra_options",
+					"lr_in_nd_ra_response", "lr_in_ip_routing_pre", "lr_in_ip_routing",
+					"lr_in_ip_routing_ecmp", "lr_in_policy", "lr_in_policy_ecmp", "lr_in_arp_resolve",
+					"lr_in_chk_pkt_len", "lr_in_larger_pkts", "lr_in_gw_redirect", "lr_in_arp_request",
+				},
+				lrEgress: {
+					"lr_out_chk_dnat_local", "lr_out_undnat", "lr_out_post_undnat", "lr_out_snat",
+					"lr_out_post_snat", "lr_out_egr_loop", "lr_out_delivery",
+				},
+			},
+		},
+	}
+)
+
+// selectStageLayout returns the logical flow stages used by the OVN version that has the
+// given OVN_Southbound schema version or nil if the version is not known.
+func selectStageLayout(schemaVersion string) *stageLayout {
+	for i := range stageLayouts {
+		if compareVersions(schemaVersion, stageLayouts[i].MinSchema) >= 0 {
+			return &stageLayouts[i]
+		}
+	}
+	return nil
+}
+
+// StageName returns the name of the logical flow stage of the given datapath type,
+// pipeline and table_id, e.g: "ls_in_acl_eval". Returns an empty string if not known.
+func (l *stageLayout) StageName(dpType DatapathType, pipeline string, tableID int) string {
+	if l == nil {
+		return ""
+	}
+	stages := l.Stages[stagePipeline{dpType, pipeline}]
+	if tableID < 0 || tableID >= len(stages) {
+		return ""
+	}
+	return stages[tableID]
+}
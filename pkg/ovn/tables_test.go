@@ -0,0 +1,109 @@
+package ovn
+
+import (
+	"amorenoz/ovs-flowmon/pkg/ovn/sbdb"
+	"fmt"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		sign int
+	}{
+		{a: "20.27.0", b: "20.27.0", sign: 0},
+		{a: "20.27.1", b: "20.27.0", sign: 1},
+		{a: "20.9.0", b: "20.27.0", sign: -1},
+		{a: "21.0.0", b: "20.27.0", sign: 1},
+		{a: "20.27", b: "20.27.0", sign: 0},
+		{a: "20.27", b: "20.27.1", sign: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			cmp := compareVersions(tt.a, tt.b)
+			if (cmp > 0) != (tt.sign > 0) || (cmp < 0) != (tt.sign < 0) {
+				t.Errorf("compareVersions(%s, %s) = %d, want sign %d", tt.a, tt.b, cmp, tt.sign)
+			}
+		})
+	}
+}
+
+func TestSelectTableLayout(t *testing.T) {
+	tests := []struct {
+		schema     string
+		releases   string
+		egressBase int
+	}{
+		{schema: "20.33.0", releases: ">= 22.12", egressBase: 42},
+		{schema: "20.27.0", releases: ">= 22.12", egressBase: 42},
+		{schema: "20.26.0", releases: "22.09", egressBase: 40},
+		{schema: "20.25.0", releases: "22.09", egressBase: 40},
+		{schema: "20.21.0", releases: "<= 22.06", egressBase: 40},
+		{schema: "", releases: "<= 22.06", egressBase: 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schema, func(t *testing.T) {
+			layout := selectTableLayout(tt.schema)
+			if layout.Releases != tt.releases || layout.EgressBase != tt.egressBase {
+				t.Errorf("selectTableLayout(%q) = %s (egress %d), want %s (egress %d)",
+					tt.schema, layout.Releases, layout.EgressBase, tt.releases, tt.egressBase)
+			}
+		})
+	}
+}
+
+func TestSelectStageLayout(t *testing.T) {
+	tests := []struct {
+		schema   string
+		releases string
+	}{
+		{schema: "20.41.0", releases: ">= 24.09"},
+		{schema: "20.37.0", releases: ">= 24.09"},
+		{schema: "20.33.0", releases: "23.09 - 24.03"},
+		{schema: "20.29.0", releases: "23.09 - 24.03"},
+		{schema: "20.27.0"},
+		{schema: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schema, func(t *testing.T) {
+			layout := selectStageLayout(tt.schema)
+			releases := ""
+			if layout != nil {
+				releases = layout.Releases
+			}
+			if releases != tt.releases {
+				t.Errorf("selectStageLayout(%q) = %q, want %q", tt.schema, releases, tt.releases)
+			}
+		})
+	}
+}
+
+func TestStageName(t *testing.T) {
+	tests := []struct {
+		schema   string
+		dpType   DatapathType
+		pipeline string
+		tableID  int
+		stage    string
+	}{
+		{schema: "20.37.0", dpType: DatapathTypeSwitch, pipeline: sbdb.LogicalFlowPipelineIngress, tableID: 8, stage: "ls_in_acl_eval"},
+		{schema: "20.37.0", dpType: DatapathTypeSwitch, pipeline: sbdb.LogicalFlowPipelineIngress, tableID: 9, stage: "ls_in_acl_sample"},
+		{schema: "20.33.0", dpType: DatapathTypeSwitch, pipeline: sbdb.LogicalFlowPipelineIngress, tableID: 9, stage: "ls_in_acl_action"},
+		{schema: "20.37.0", dpType: DatapathTypeSwitch, pipeline: sbdb.LogicalFlowPipelineEgress, tableID: 5, stage: "ls_out_acl_eval"},
+		{schema: "20.33.0", dpType: DatapathTypeSwitch, pipeline: sbdb.LogicalFlowPipelineEgress, tableID: 4, stage: "ls_out_acl_eval"},
+		{schema: "20.37.0", dpType: DatapathTypeRouter, pipeline: sbdb.LogicalFlowPipelineIngress, tableID: 16, stage: "lr_in_policy"},
+		{schema: "20.33.0", dpType: DatapathTypeRouter, pipeline: sbdb.LogicalFlowPipelineIngress, tableID: 15, stage: "lr_in_policy"},
+		{schema: "20.37.0", dpType: DatapathTypeRouter, pipeline: sbdb.LogicalFlowPipelineEgress, tableID: 3, stage: "lr_out_snat"},
+		{schema: "20.37.0", dpType: DatapathTypeSwitch, pipeline: sbdb.LogicalFlowPipelineEgress, tableID: 12},
+		{schema: "20.37.0", dpType: DatapathTypeSwitch, pipeline: sbdb.LogicalFlowPipelineIngress, tableID: -1},
+		{schema: "20.37.0", dpType: DatapathTypePhysical, pipeline: sbdb.LogicalFlowPipelineIngress, tableID: 0},
+		{schema: "20.27.0", dpType: DatapathTypeSwitch, pipeline: sbdb.LogicalFlowPipelineIngress, tableID: 8},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%s/%s/%d", tt.schema, tt.dpType, tt.pipeline, tt.tableID), func(t *testing.T) {
+			if stage := selectStageLayout(tt.schema).StageName(tt.dpType, tt.pipeline, tt.tableID); stage != tt.stage {
+				t.Errorf("StageName() = %q, want %q", stage, tt.stage)
+			}
+		})
+	}
+}
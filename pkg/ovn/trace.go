@@ -0,0 +1,238 @@
+package ovn
+
+import (
+	"amorenoz/ovs-flowmon/pkg/flowmon"
+	"amorenoz/ovs-flowmon/pkg/ovn/sbdb"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTraceCommand is the default ovn-trace binary.
+	DefaultTraceCommand = "ovn-trace"
+	// traceTimeout is the maximum time ovn-trace is allowed to run.
+	traceTimeout = 60 * time.Second
+)
+
+// portAddresses parses the Port_Binding's mac column. Each entry has the format
+// "MAC [IP...]". Special values such as "unknown" or "router" are ignored.
+func portAddresses(pb *sbdb.PortBinding) ([]net.HardwareAddr, []net.IP) {
+	macs := []net.HardwareAddr{}
+	ips := []net.IP{}
+	for _, entry := range pb.MAC {
+		for _, field := range strings.Fields(entry) {
+			if mac, err := net.ParseMAC(field); err == nil {
+				macs = append(macs, mac)
+				continue
+			}
+			// IPs might be followed by a prefix length.
+			if ip, _, err := net.ParseCIDR(field); err == nil {
+				ips = append(ips, ip)
+			} else if ip := net.ParseIP(field); ip != nil {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return macs, ips
+}
+
+// portHasMac returns whether the Port_Binding owns the given MAC address.
+func portHasMac(pb *sbdb.PortBinding, mac net.HardwareAddr) bool {
+	macs, _ := portAddresses(pb)
+	for _, m := range macs {
+		if bytes.Equal(m, mac) {
+			return true
+		}
+	}
+	return false
+}
+
+// portHasIP returns whether the Port_Binding owns the given IP address.
+func portHasIP(pb *sbdb.PortBinding, ip net.IP) bool {
+	_, ips := portAddresses(pb)
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// getDatapathByName returns the Datapath_Binding whose external_ids:name is the given one.
+func (o *OVNClient) getDatapathByName(name string) (*sbdb.DatapathBinding, error) {
+	dps := []sbdb.DatapathBinding{}
+	err := o.sb.WhereCache(
+		func(dp *sbdb.DatapathBinding) bool {
+			return dp.ExternalIDs["name"] == name
+		}).List(&dps)
+	if err != nil {
+		return nil, err
+	}
+	if len(dps) == 0 {
+		return nil, fmt.Errorf("No DatapathBinding found with name %s", name)
+	}
+	return &dps[0], nil
+}
+
+// getInport returns the Port_Binding the traffic described by the FlowKey entered the
+// datapath through. Ports owning the source MAC are preferred, then ports owning the
+// destination MAC (i.e: router ports) and finally ports owning the source IP.
+func (o *OVNClient) getInport(key *flowmon.FlowKey, datapath string) (*sbdb.PortBinding, error) {
+	pbs := []sbdb.PortBinding{}
+	err := o.sb.WhereCache(
+		func(pb *sbdb.PortBinding) bool {
+			return datapath == "" || pb.Datapath == datapath
+		}).List(&pbs)
+	if err != nil {
+		return nil, err
+	}
+	matchers := []func(pb *sbdb.PortBinding) bool{
+		func(pb *sbdb.PortBinding) bool { return key.SrcMac != nil && portHasMac(pb, key.SrcMac) },
+		func(pb *sbdb.PortBinding) bool { return key.DstMac != nil && portHasMac(pb, key.DstMac) },
+		func(pb *sbdb.PortBinding) bool { return key.SrcAddr != nil && portHasIP(pb, key.SrcAddr) },
+	}
+	for _, matcher := range matchers {
+		for i := range pbs {
+			if matcher(&pbs[i]) {
+				return &pbs[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("No Port_Binding owns the source address of the flow")
+}
+
+// traceMicroflow builds an ovn-trace microflow entering the logical port inport from the
+// given fields of the FlowKey. Fields not in the list are considered wildcarded. It also
+// returns the values that had to be assumed because they are not part of the FlowKey.
+func traceMicroflow(key *flowmon.FlowKey, fields []string, inport string) (string, []string) {
+	has := map[string]bool{}
+	for _, field := range fields {
+		has[field] = true
+	}
+	conds := []string{fmt.Sprintf("inport == %q", inport)}
+	if has["SrcMac"] && key.SrcMac != nil {
+		conds = append(conds, fmt.Sprintf("eth.src == %s", key.SrcMac))
+	}
+	if has["DstMac"] && key.DstMac != nil {
+		conds = append(conds, fmt.Sprintf("eth.dst == %s", key.DstMac))
+	}
+	ipPrefix, icmpPrefix := "", ""
+	switch key.Etype {
+	case flowmon.EtypeIPv4:
+		ipPrefix, icmpPrefix = "ip4", "icmp4"
+	case flowmon.EtypeIPv6:
+		ipPrefix, icmpPrefix = "ip6", "icmp6"
+	default:
+		if has["Etype"] && key.Etype != 0 {
+			conds = append(conds, fmt.Sprintf("eth.type == 0x%04x", uint32(key.Etype)))
+		}
+		return strings.Join(conds, " && "), nil
+	}
+	if has["SrcAddr"] && key.SrcAddr != nil {
+		conds = append(conds, fmt.Sprintf("%s.src == %s", ipPrefix, key.SrcAddr))
+	}
+	if has["DstAddr"] && key.DstAddr != nil {
+		conds = append(conds, fmt.Sprintf("%s.dst == %s", ipPrefix, key.DstAddr))
+	}
+	// The TTL is not sampled but ovn-trace defaults to 0, which makes logical routers
+	// drop the packet, so a common initial value has to be assumed.
+	conds = append(conds, "ip.ttl == 64")
+	assumed := []string{"ip.ttl == 64"}
+	if !has["Proto"] {
+		conds = append(conds, ipPrefix)
+		return strings.Join(conds, " && "), assumed
+	}
+	switch key.Proto {
+	case flowmon.ProtoTCP, flowmon.ProtoUDP, flowmon.ProtoSCTP:
+		l4 := strings.ToLower(key.Proto.String())
+		conds = append(conds, l4)
+		if has["SrcPort"] {
+			conds = append(conds, fmt.Sprintf("%s.src == %d", l4, key.SrcPort))
+		}
+		if has["DstPort"] {
+			conds = append(conds, fmt.Sprintf("%s.dst == %d", l4, key.DstPort))
+		}
+	case flowmon.ProtoICMP, flowmon.ProtoICMPv6:
+		conds = append(conds, icmpPrefix)
+		if has["ICMPType"] {
+			conds = append(conds, fmt.Sprintf("%s.type == %d", icmpPrefix, key.ICMPType))
+		}
+		if has["ICMPCode"] {
+			conds = append(conds, fmt.Sprintf("%s.code == %d", icmpPrefix, key.ICMPCode))
+		}
+	default:
+		conds = append(conds, fmt.Sprintf("ip.proto == %d", uint32(key.Proto)))
+	}
+	return strings.Join(conds, " && "), assumed
+}
+
+// TraceMicroflow synthesises an ovn-trace microflow from the given fields of the FlowKey.
+// It returns the logical datapath name, the microflow and the conditions of the
+// microflow that are assumed rather than taken from the FlowKey.
+func (o *OVNClient) TraceMicroflow(key *flowmon.FlowKey, fields []string) (string, string, []string, error) {
+	has := map[string]bool{}
+	for _, field := range fields {
+		has[field] = true
+	}
+	if !has["DPName"] || key.DPName == "" {
+		return "", "", nil, fmt.Errorf("The flow is not attributed to a logical datapath. DPName must be part of the aggregate")
+	}
+	dp, err := o.getDatapathByName(key.DPName)
+	if err != nil {
+		return "", "", nil, err
+	}
+	inport, err := o.getInport(key, dp.UUID)
+	if err != nil {
+		return "", "", nil, err
+	}
+	microflow, assumed := traceMicroflow(key, fields, inport.LogicalPort)
+	return key.DPName, microflow, assumed, nil
+}
+
+// SetTraceCommand sets the ovn-trace binary used by Trace.
+func (o *OVNClient) SetTraceCommand(command string) {
+	o.traceCmd = command
+}
+
+// Trace evaluates the microflow synthesised from the given fields of the FlowKey by
+// running ovn-trace against the configured SB database and returns its output.
+func (o *OVNClient) Trace(key *flowmon.FlowKey, fields []string) (string, error) {
+	traceCmd := o.traceCmd
+	if traceCmd == "" {
+		traceCmd = DefaultTraceCommand
+	}
+	if _, err := exec.LookPath(traceCmd); err != nil {
+		return "", fmt.Errorf("%s is required to trace flows, install it (e.g: from the ovn package) or set its path with --ovn-trace: %s",
+			traceCmd, err.Error())
+	}
+	datapath, microflow, assumed, err := o.TraceMicroflow(key, fields)
+	if err != nil {
+		return "", err
+	}
+	args := []string{"--db=" + o.sbStr}
+	if o.tlsOpts != nil && !o.tlsOpts.Empty() {
+		args = append(args,
+			"--private-key="+o.tlsOpts.PrivateKey,
+			"--certificate="+o.tlsOpts.Certificate,
+			"--ca-cert="+o.tlsOpts.CACert)
+	}
+	args = append(args, datapath, microflow)
+
+	ctx, cancel := context.WithTimeout(context.Background(), traceTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, traceCmd, args...).CombinedOutput()
+	header := fmt.Sprintf("$ %s %s '%s'\n", traceCmd, datapath, microflow)
+	for _, cond := range assumed {
+		header += fmt.Sprintf("# %s is not part of the sampled flow and has been assumed\n", cond)
+	}
+	header += "\n"
+	if err != nil {
+		return "", fmt.Errorf("%s%s failed: %s\n%s", header, traceCmd, err.Error(), string(output))
+	}
+	return header + string(output), nil
+}
@@ -0,0 +1,73 @@
+package ovn
+
+import (
+	"amorenoz/ovs-flowmon/pkg/flowmon"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestTraceMicroflow(t *testing.T) {
+	mac, _ := net.ParseMAC("0a:58:0a:f4:00:05")
+	tests := []struct {
+		name      string
+		key       *flowmon.FlowKey
+		fields    []string
+		microflow string
+		assumed   []string
+	}{
+		{
+			name:      "arp",
+			key:       &flowmon.FlowKey{SrcMac: mac, Etype: 0x0806},
+			fields:    []string{"SrcMac", "Etype"},
+			microflow: `inport == "pod1" && eth.src == 0a:58:0a:f4:00:05 && eth.type == 0x0806`,
+		},
+		{
+			name:      "ipv4 without proto",
+			key:       &flowmon.FlowKey{Etype: flowmon.EtypeIPv4, DstAddr: net.ParseIP("10.96.0.1"), Proto: flowmon.ProtoTCP},
+			fields:    []string{"DstAddr"},
+			microflow: `inport == "pod1" && ip4.dst == 10.96.0.1 && ip.ttl == 64 && ip4`,
+			assumed:   []string{"ip.ttl == 64"},
+		},
+		{
+			name: "tcp",
+			key: &flowmon.FlowKey{Etype: flowmon.EtypeIPv4, SrcAddr: net.ParseIP("10.244.0.5"),
+				Proto: flowmon.ProtoTCP, SrcPort: 1234, DstPort: 443},
+			fields:    []string{"SrcAddr", "Proto", "DstPort"},
+			microflow: `inport == "pod1" && ip4.src == 10.244.0.5 && ip.ttl == 64 && tcp && tcp.dst == 443`,
+			assumed:   []string{"ip.ttl == 64"},
+		},
+		{
+			name:      "sctp over ipv6",
+			key:       &flowmon.FlowKey{Etype: flowmon.EtypeIPv6, Proto: flowmon.ProtoSCTP, SrcPort: 1234, DstPort: 38412},
+			fields:    []string{"Proto", "SrcPort", "DstPort"},
+			microflow: `inport == "pod1" && ip.ttl == 64 && sctp && sctp.src == 1234 && sctp.dst == 38412`,
+			assumed:   []string{"ip.ttl == 64"},
+		},
+		{
+			name:      "icmpv6",
+			key:       &flowmon.FlowKey{Etype: flowmon.EtypeIPv6, Proto: flowmon.ProtoICMPv6, ICMPType: 135},
+			fields:    []string{"Proto", "ICMPType"},
+			microflow: `inport == "pod1" && ip.ttl == 64 && icmp6 && icmp6.type == 135`,
+			assumed:   []string{"ip.ttl == 64"},
+		},
+		{
+			name:      "other proto",
+			key:       &flowmon.FlowKey{Etype: flowmon.EtypeIPv4, Proto: 47},
+			fields:    []string{"Proto"},
+			microflow: `inport == "pod1" && ip.ttl == 64 && ip.proto == 47`,
+			assumed:   []string{"ip.ttl == 64"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			microflow, assumed := traceMicroflow(tt.key, tt.fields, "pod1")
+			if microflow != tt.microflow {
+				t.Errorf("traceMicroflow() = %s, want %s", microflow, tt.microflow)
+			}
+			if !reflect.DeepEqual(assumed, tt.assumed) {
+				t.Errorf("traceMicroflow() assumed %v, want %v", assumed, tt.assumed)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package ovs
+
+import (
+	"net"
+	"sync"
+
+	flowmessage "github.com/netsampler/goflow2/pb"
+	"github.com/sirupsen/logrus"
+)
+
+// ChassisEnricher implements netflow.Enricher. It labels each flow with the chassis
+// that exported it based on the address of the exporter.
+type ChassisEnricher struct {
+	mutex     sync.RWMutex
+	exporters map[string]string
+}
+
+// NewChassisEnricher returns a new ChassisEnricher with no known exporters.
+func NewChassisEnricher() *ChassisEnricher {
+	return &ChassisEnricher{
+		exporters: make(map[string]string),
+	}
+}
+
+// AddExporter registers the chassis name associated with an exporter address.
+func (c *ChassisEnricher) AddExporter(addr net.IP, chassis string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.exporters[addr.String()] = chassis
+}
+
+// Enrich adds the "Chassis" extra information. If the exporter is unknown, its
+// address is used instead.
+func (c *ChassisEnricher) Enrich(msg *flowmessage.FlowMessage, extra map[string]interface{}, log *logrus.Logger) map[string]interface{} {
+	addr := net.IP(msg.SamplerAddress).String()
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if chassis, ok := c.exporters[addr]; ok {
+		extra["Chassis"] = chassis
+	} else {
+		extra["Chassis"] = addr
+	}
+	return extra
+}
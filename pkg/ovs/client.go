@@ -1,7 +1,11 @@
 package ovs
 
 import (
+	"amorenoz/ovs-flowmon/pkg/dbmodel"
+	"amorenoz/ovs-flowmon/pkg/endpoint"
+	"amorenoz/ovs-flowmon/pkg/ovs/vswitchd"
 	"amorenoz/ovs-flowmon/pkg/stats"
+	"amorenoz/ovs-flowmon/pkg/unixctl"
 	"context"
 	"fmt"
 	"strconv"
@@ -19,6 +23,10 @@ const (
 	DefaultCacheMax      int = 0
 	DefaultActiveTimeout int = 0
 	DefaultSampling      int = 400
+
+	// flowSamplingOwner is the value of external_ids:owner of the
+	// Flow_Sample_Collector_Sets created by ovs-flowmon.
+	flowSamplingOwner = "ovs-flowmon"
 )
 
 var (
@@ -33,102 +41,53 @@ var (
 	statOrder = []string{"cpu", "memory", "load_average", "ovs-virt", "ovs-rss", "ovs-cpu"}
 )
 
-// IPFIX defines an object in IPFIX table
-type IPFIX struct {
-	UUID               string            `ovsdb:"_uuid"`
-	CacheActiveTimeout *int              `ovsdb:"cache_active_timeout"`
-	CacheMaxFlows      *int              `ovsdb:"cache_max_flows"`
-	ExternalIDs        map[string]string `ovsdb:"external_ids"`
-	ObsDomainID        *int              `ovsdb:"obs_domain_id"`
-	ObsPointID         *int              `ovsdb:"obs_point_id"`
-	OtherConfig        map[string]string `ovsdb:"other_config"`
-	Sampling           *int              `ovsdb:"sampling"`
-	Targets            []string          `ovsdb:"targets"`
-}
-
-// FlowSampleCollectorSet defines an object in Flow_Sample_Collector_Set table
-type FlowSampleCollectorSet struct {
-	UUID        string            `ovsdb:"_uuid"`
-	Bridge      string            `ovsdb:"bridge"`
-	ExternalIDs map[string]string `ovsdb:"external_ids"`
-	ID          int               `ovsdb:"id"`
-	IPFIX       *string           `ovsdb:"ipfix"`
-}
-
-// OpenvSwitch defines an object in Open_vSwitch table
-type OpenvSwitch struct {
-	UUID    string   `ovsdb:"_uuid"`
-	Bridges []string `ovsdb:"bridges"`
-	//	CurCfg          int               `ovsdb:"cur_cfg"`
-	//	DatapathTypes   []string          `ovsdb:"datapath_types"`
-	//	Datapaths       map[string]string `ovsdb:"datapaths"`
-	//	DbVersion       *string           `ovsdb:"db_version"`
-	//	DpdkInitialized bool              `ovsdb:"dpdk_initialized"`
-	//	DpdkVersion     *string           `ovsdb:"dpdk_version"`
-	//	ExternalIDs     map[string]string `ovsdb:"external_ids"`
-	//	IfaceTypes      []string          `ovsdb:"iface_types"`
-	//	ManagerOptions  []string          `ovsdb:"manager_options"`
-	//	NextCfg         int               `ovsdb:"next_cfg"`
-	OtherConfig map[string]string `ovsdb:"other_config"`
-	OVSVersion  *string           `ovsdb:"ovs_version"`
-	//	SSL             *string           `ovsdb:"ssl"`
-	Statistics map[string]string `ovsdb:"statistics"`
-	//	SystemType      *string           `ovsdb:"system_type"`
-	//	SystemVersion   *string           `ovsdb:"system_version"`
-}
-
-// Bridge defines an object in Bridge table
-type Bridge struct {
-	UUID string `ovsdb:"_uuid"`
-	//	AutoAttach          *string           `ovsdb:"auto_attach"`
-	//	Controller          []string          `ovsdb:"controller"`
-	//	DatapathID          *string           `ovsdb:"datapath_id"`
-	//	DatapathType        string            `ovsdb:"datapath_type"`
-	//	DatapathVersion     string            `ovsdb:"datapath_version"`
-	//	ExternalIDs         map[string]string `ovsdb:"external_ids"`
-	//	FailMode            *BridgeFailMode   `ovsdb:"fail_mode"`
-	//	FloodVLANs          [4096]int         `ovsdb:"flood_vlans"`
-	//	FlowTables          map[int]string    `ovsdb:"flow_tables"`
-	IPFIX *string `ovsdb:"ipfix"`
-	//	McastSnoopingEnable bool              `ovsdb:"mcast_snooping_enable"`
-	//	Mirrors             []string          `ovsdb:"mirrors"`
-	Name    string  `ovsdb:"name"`
-	Netflow *string `ovsdb:"netflow"`
-	//	OtherConfig         map[string]string `ovsdb:"other_config"`
-	Ports []string `ovsdb:"ports"`
-	//Protocols           []BridgeProtocols `ovsdb:"protocols"`
-	//RSTPEnable          bool              `ovsdb:"rstp_enable"`
-	//RSTPStatus          map[string]string `ovsdb:"rstp_status"`
-	Sflow  *string           `ovsdb:"sflow"`
-	Status map[string]string `ovsdb:"status"`
-	//STPEnable           bool              `ovsdb:"stp_enable"`
-}
-
 type OVSClient struct {
-	client client.Client
+	client *dbmodel.Client
 	stats  stats.StatsBackend
 	log    *logrus.Logger
+	// name is used to tell statistics apart when several clients share the same
+	// stats backend.
+	name string
+	// bridge is the bridge IPFIX sampling has been configured on.
+	bridge string
+	// ofports indexes the Interfaces by OpenFlow port number.
+	ofports *ofportIndex
+
+	// Interface statistics
+	ifaceStats        stats.InterfaceStatsBackend
+	ifaceUpdates      map[string]*interfaceUpdate
+	ifaceBridges      map[string]string
+	ifaceBridgesDirty bool
+
+	// unixctl client of ovs-vswitchd
+	appctl     *unixctl.Client
+	appctlStop chan struct{}
 }
 
-func NewOVSClient(connStr string, statsBackend stats.StatsBackend, log *logrus.Logger) (*OVSClient, error) {
-	dbmodel, err := model.NewDBModel("Open_vSwitch", map[string]model.Model{
-		"Bridge":                    &Bridge{},
-		"IPFIX":                     &IPFIX{},
-		"Open_vSwitch":              &OpenvSwitch{},
-		"Flow_Sample_Collector_Set": &FlowSampleCollectorSet{},
-	})
+// NewOVSClient returns a new OVSClient. connStr can be a comma-separated list of
+// OVSDB connection methods. tlsOpts are only needed if any of them uses ssl.
+func NewOVSClient(connStr string, tlsOpts *endpoint.TLSOptions, statsBackend stats.StatsBackend, log *logrus.Logger) (*OVSClient, error) {
+	opts, err := endpoint.ClientOptions(connStr, tlsOpts)
 	if err != nil {
 		return nil, err
 	}
 	logr := logrusr.New(log)
-	cli, err := client.NewOVSDBClient(dbmodel, client.WithEndpoint(connStr), client.WithLogger(&logr))
+	cli, err := dbmodel.NewClient("Open_vSwitch", map[string]dbmodel.Table{
+		"Bridge":                    {Model: &vswitchd.Bridge{}},
+		"IPFIX":                     {Model: &vswitchd.IPFIX{}},
+		"Open_vSwitch":              {Model: &vswitchd.OpenvSwitch{}},
+		"Flow_Sample_Collector_Set": {Model: &vswitchd.FlowSampleCollectorSet{}},
+		"Interface":                 {Model: &vswitchd.Interface{}},
+		"Port":                      {Model: &vswitchd.Port{}},
+	}, log, append(opts, client.WithLogger(&logr))...)
 	if err != nil {
 		return nil, err
 	}
 	return &OVSClient{
-		client: cli,
-		stats:  statsBackend,
-		log:    log,
+		client:  cli,
+		stats:   statsBackend,
+		log:     log,
+		ofports: newOfportIndex(),
 	}, nil
 }
 
@@ -147,32 +106,68 @@ func (o *OVSClient) Started() bool {
 	return o.client.Connected()
 }
 
-// SetFlowSampling on br-int
-func (o *OVSClient) SetFlowSampling(target string) error {
+// SetName sets the name used to label this client's statistics. Must be called before
+// EnableStatistics.
+func (o *OVSClient) SetName(name string) {
+	o.name = name
+}
+
+// SystemID returns the chassis identifier stored in the Open_vSwitch table's
+// external_ids:system-id.
+func (o *OVSClient) SystemID() (string, error) {
+	if !o.client.Connected() {
+		return "", fmt.Errorf("Client not connected")
+	}
+	ovsList := []vswitchd.OpenvSwitch{}
+	if err := o.client.List(&ovsList); err != nil {
+		return "", err
+	}
+	if len(ovsList) != 1 {
+		return "", fmt.Errorf("Wrong number of entries in Open_vSwitch table")
+	}
+	systemID, ok := ovsList[0].ExternalIDs["system-id"]
+	if !ok || systemID == "" {
+		return "", fmt.Errorf("external_ids:system-id not set")
+	}
+	return systemID, nil
+}
+
+// statName returns the name of the statistic as registered in the stats backend.
+func (o *OVSClient) statName(stat string) string {
+	if o.name == "" {
+		return statNames[stat]
+	}
+	return fmt.Sprintf("[%s] %s", o.name, statNames[stat])
+}
+
+// SetFlowSampling creates a Flow_Sample_Collector_Set with the given ID on br-int that
+// sends the samples to target. Other Flow_Sample_Collector_Sets are left untouched.
+func (o *OVSClient) SetFlowSampling(target string, collectorSetID int) error {
 	if !o.client.Connected() {
 		return fmt.Errorf("Client not connected")
 	}
-	bridge := &Bridge{
+	bridge := &vswitchd.Bridge{
 		Name: "br-int",
 	}
 	err := o.client.Get(bridge)
 	if err != nil {
 		return err
 	}
-	o.clearFlowBridge(bridge)
+	o.clearFlowBridge(bridge, collectorSetID)
 
 	namedIPFIX := "namedIPFIX"
 
 	bridge.IPFIX = &namedIPFIX
-	ipfix := &IPFIX{
+	ipfix := &vswitchd.IPFIX{
 		UUID:    namedIPFIX,
 		Targets: []string{target},
 	}
 
-	collector := &FlowSampleCollectorSet{
-		ID:     1,
-		IPFIX:  &namedIPFIX,
-		Bridge: bridge.UUID,
+	collector := &vswitchd.FlowSampleCollectorSet{
+		ID:          collectorSetID,
+		IPFIX:       &namedIPFIX,
+		Bridge:      bridge.UUID,
+		ExternalIDs: map[string]string{"owner": flowSamplingOwner},
 	}
 
 	ops, err := o.client.Create(ipfix, collector)
@@ -194,23 +189,40 @@ func (o *OVSClient) SetFlowSampling(target string) error {
 	if opErr, err := ovsdb.CheckOperationResults(response, ops); err != nil {
 		return fmt.Errorf("%s: %+v", err.Error(), opErr)
 	}
+	o.bridge = bridge.Name
 	return nil
 
 }
+
+// ClearFlowSampling deletes the Flow_Sample_Collector_Set created by SetFlowSampling.
+func (o *OVSClient) ClearFlowSampling(collectorSetID int) error {
+	if !o.client.Connected() {
+		return nil
+	}
+	bridge := &vswitchd.Bridge{
+		Name: "br-int",
+	}
+	if err := o.client.Get(bridge); err != nil {
+		return err
+	}
+	o.clearFlowBridge(bridge, collectorSetID)
+	return nil
+}
+
 func (o *OVSClient) SetIPFIX(bridgeName, target string, sampling, cacheMax, cacheTimeout int) error {
 	if !o.client.Connected() {
 		return fmt.Errorf("Client not connected")
 	}
 	// Reconfigurations don't trigger a template event, to force it first delete
 	// the current IPFIX config and only then create the new one
-	bridge := &Bridge{
+	bridge := &vswitchd.Bridge{
 		Name: bridgeName,
 	}
 	o.clearIpfixBridge(bridge.Name)
 
 	// Create new configuration
 	named := "id"
-	ipfix := &IPFIX{
+	ipfix := &vswitchd.IPFIX{
 		UUID:               named,
 		CacheActiveTimeout: &cacheTimeout,
 		CacheMaxFlows:      &cacheMax,
@@ -241,11 +253,12 @@ func (o *OVSClient) SetIPFIX(bridgeName, target string, sampling, cacheMax, cach
 	if opErr, err := ovsdb.CheckOperationResults(response, ops); err != nil {
 		return fmt.Errorf("%s: %+v", err.Error(), opErr)
 	}
+	o.bridge = bridgeName
 	return nil
 }
 
 func (o *OVSClient) ClearIPFIX() error {
-	bridges := []Bridge{}
+	bridges := []vswitchd.Bridge{}
 	if !o.client.Connected() {
 		return nil
 	}
@@ -266,20 +279,29 @@ func (o *OVSClient) Start() error {
 	if err != nil {
 		return err
 	}
+	o.client.OnReconnect(func() {
+		o.ofports.reset()
+		if err := o.buildOfportIndex(); err != nil {
+			o.log.Error(err)
+		}
+	})
+	o.client.AddEventHandler(o.ofports.eventHandler())
 	_, err = o.client.MonitorAll(context.TODO())
 	if err != nil {
 		return err
 	}
-	return nil
+	// Cache events might be dropped if many rows are added at once so fill the index
+	// from the cache.
+	return o.buildOfportIndex()
 }
 
 func (o *OVSClient) EnableStatistics() error {
 	for _, stat := range statOrder {
-		o.stats.RegisterStat(statNames[stat])
+		o.stats.RegisterStat(o.statName(stat))
 	}
 
 	// Enable statistics in OVS
-	ovsList := []OpenvSwitch{}
+	ovsList := []vswitchd.OpenvSwitch{}
 	o.client.List(&ovsList)
 	if len(ovsList) != 1 {
 		return fmt.Errorf("Wrong number of entries in Open_vSwitch table")
@@ -308,20 +330,22 @@ func (o *OVSClient) EnableStatistics() error {
 	}
 
 	// Register update callback
-	o.client.Cache().AddEventHandler(&cache.EventHandlerFuncs{
+	o.client.AddEventHandler(&cache.EventHandlerFuncs{
 		UpdateFunc: func(table string, oldModel, newModel model.Model) {
 			if table == "Open_vSwitch" {
-				newOvs := newModel.(*OpenvSwitch)
-				oldOvs := oldModel.(*OpenvSwitch)
+				newOvs := newModel.(*vswitchd.OpenvSwitch)
+				oldOvs := oldModel.(*vswitchd.OpenvSwitch)
 				o.updateStatistics(oldOvs.Statistics, newOvs.Statistics)
 			}
 		},
 	})
+	o.enableDatapathStatistics(DefaultDatapathStatsInterval)
 	return nil
 }
 
 func (o *OVSClient) DisableStatistics() error {
-	ovsList := []OpenvSwitch{}
+	o.disableDatapathStatistics()
+	ovsList := []vswitchd.OpenvSwitch{}
 	o.client.List(&ovsList)
 	if len(ovsList) != 1 {
 		return fmt.Errorf("Wrong number of entries in Open_vSwitch table")
@@ -359,10 +383,10 @@ func (o *OVSClient) updateStatistics(old_statistics, statistics map[string]strin
 	o.log.WithFields(logFields).Debug("Updating Statistics")
 
 	if cpu, ok := statistics["cpu"]; ok {
-		o.stats.UpdateStat(statNames["cpu"], cpu)
+		o.stats.UpdateStat(o.statName("cpu"), cpu)
 	}
 	if load, ok := statistics["load_average"]; ok {
-		o.stats.UpdateStat(statNames["load_average"], load)
+		o.stats.UpdateStat(o.statName("load_average"), load)
 	}
 	if mem, ok := statistics["memory"]; ok {
 		mem_stat := []string{}
@@ -374,7 +398,7 @@ func (o *OVSClient) updateStatistics(old_statistics, statistics map[string]strin
 			}
 			mem_stat = append(mem_stat, fmt.Sprintf("%.2f", float_val/1024))
 		}
-		o.stats.UpdateStat(statNames["memory"], strings.Join(mem_stat, ","))
+		o.stats.UpdateStat(o.statName("memory"), strings.Join(mem_stat, ","))
 	}
 	o.updateProcessStatistics(old_statistics, statistics)
 	o.stats.Draw()
@@ -402,13 +426,13 @@ func (o *OVSClient) updateProcessStatistics(old_statistics, statistics map[strin
 		return
 	}
 
-	o.stats.UpdateStat(statNames["ovs-virt"], fmt.Sprintf("%.2f", float64(virt)/1024))
-	o.stats.UpdateStat(statNames["ovs-rss"], fmt.Sprintf("%.2f", float64(rss)/1024))
-	o.stats.UpdateStat(statNames["ovs-cpu"], fmt.Sprintf("%.2f", cpu_percent))
+	o.stats.UpdateStat(o.statName("ovs-virt"), fmt.Sprintf("%.2f", float64(virt)/1024))
+	o.stats.UpdateStat(o.statName("ovs-rss"), fmt.Sprintf("%.2f", float64(rss)/1024))
+	o.stats.UpdateStat(o.statName("ovs-cpu"), fmt.Sprintf("%.2f", cpu_percent))
 }
 
 func (o *OVSClient) clearIpfixBridge(bridgeName string) {
-	bridge := &Bridge{
+	bridge := &vswitchd.Bridge{
 		Name:  bridgeName,
 		IPFIX: nil,
 	}
@@ -426,28 +450,56 @@ func (o *OVSClient) clearIpfixBridge(bridgeName string) {
 	}
 }
 
-func (o *OVSClient) clearFlowBridge(bridge *Bridge) {
-	collector := &FlowSampleCollectorSet{}
-
-	delOps, err := o.client.Where(collector, model.Condition{
-		Field:    &collector.Bridge,
-		Function: ovsdb.ConditionEqual,
-		Value:    bridge.UUID,
-	}).Delete()
-
-	bridge.IPFIX = nil
-	clearOps, err := o.client.Where(bridge).Update(bridge, &bridge.IPFIX)
-	ops := append(delOps, clearOps...)
-
-	if err != nil {
+// clearFlowBridge deletes the Flow_Sample_Collector_Set with the given ID from the bridge.
+func (o *OVSClient) clearFlowBridge(bridge *vswitchd.Bridge, collectorSetID int) {
+	collectors := []vswitchd.FlowSampleCollectorSet{}
+	if err := o.client.List(&collectors); err != nil {
 		o.log.Error(err)
-	} else {
-		response, err := o.client.Transact(context.TODO(), ops...)
+		return
+	}
+	ops := []ovsdb.Operation{}
+	for i := range collectors {
+		collector := &collectors[i]
+		if collector.Bridge != bridge.UUID || collector.ID != collectorSetID {
+			continue
+		}
+		if owner := collector.ExternalIDs["owner"]; owner != flowSamplingOwner {
+			o.log.Warningf("Replacing Flow_Sample_Collector_Set %d on %s created by %q", collectorSetID, bridge.Name, owner)
+		}
+		delOps, err := o.client.Where(collector).Delete()
 		if err != nil {
 			o.log.Error(err)
+			return
 		}
-		if opErr, err := ovsdb.CheckOperationResults(response, ops); err != nil {
-			o.log.Errorf("%s: %+v", err.Error(), opErr)
+		ops = append(ops, delOps...)
+	}
+	if len(ops) == 0 {
+		return
+	}
+	response, err := o.client.Transact(context.TODO(), ops...)
+	if err != nil {
+		o.log.Error(err)
+	}
+	if opErr, err := ovsdb.CheckOperationResults(response, ops); err != nil {
+		o.log.Errorf("%s: %+v", err.Error(), opErr)
+	}
+}
+
+// CollectorSetIDs returns the IDs of the Flow_Sample_Collector_Sets that were not created
+// by ovs-flowmon.
+func (o *OVSClient) CollectorSetIDs() ([]int, error) {
+	if !o.client.Connected() {
+		return nil, fmt.Errorf("Client not connected")
+	}
+	collectors := []vswitchd.FlowSampleCollectorSet{}
+	if err := o.client.List(&collectors); err != nil {
+		return nil, err
+	}
+	ids := []int{}
+	for _, collector := range collectors {
+		if collector.ExternalIDs["owner"] != flowSamplingOwner {
+			ids = append(ids, collector.ID)
 		}
 	}
+	return ids, nil
 }
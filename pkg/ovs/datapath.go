@@ -0,0 +1,205 @@
+package ovs
+
+import (
+	"amorenoz/ovs-flowmon/pkg/unixctl"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultDatapathStatsInterval is the default refresh interval of the statistics
+	// retrieved through ovs-vswitchd's unixctl socket.
+	DefaultDatapathStatsInterval = 5 * time.Second
+)
+
+var (
+	datapathStatNames map[string]string = map[string]string{
+		"dp-lookups":  "Datapath lookups (hit, missed, lost)",
+		"dp-flows":    "Datapath flows",
+		"upcall":      "Upcall flows (current, avg, max, limit)",
+		"dump":        "Upcall dump duration",
+		"revalidator": "Revalidators (count, keys)",
+		"memory":      "OVS memory usage",
+	}
+	datapathStatOrder = []string{"dp-lookups", "dp-flows", "upcall", "dump", "revalidator", "memory"}
+
+	lookupsRe     = regexp.MustCompile(`lookups: hit:(\d+) missed:(\d+) lost:(\d+)`)
+	flowsRe       = regexp.MustCompile(`^\s*flows: (\d+)`)
+	upcallFlowsRe = regexp.MustCompile(`flows\s*: \(current (\d+)\) \(avg (\d+)\) \(max (\d+)\) \(limit (\d+)\)`)
+	dumpRe        = regexp.MustCompile(`dump duration\s*: (\S+)`)
+	revalidatorRe = regexp.MustCompile(`^\s*\d+: \(keys (\d+)\)`)
+)
+
+// DatapathStats holds the datapath statistics of a single datapath as reported by
+// "dpctl/show" and "upcall/show".
+type DatapathStats struct {
+	Name string
+	// dpctl/show
+	Hit    uint64
+	Missed uint64
+	Lost   uint64
+	Flows  uint64
+	// upcall/show
+	UpcallFlows     uint64
+	UpcallFlowsAvg  uint64
+	UpcallFlowsMax  uint64
+	FlowLimit       uint64
+	DumpDuration    string
+	Revalidators    int
+	RevalidatorKeys uint64
+}
+
+// parseDpctlShow parses the output of "dpctl/show".
+func parseDpctlShow(output string, dps map[string]*DatapathStats) {
+	var dp *DatapathStats
+	for _, line := range strings.Split(output, "\n") {
+		if line != "" && !strings.HasPrefix(line, " ") && strings.HasSuffix(line, ":") {
+			name := strings.TrimSuffix(line, ":")
+			if _, ok := dps[name]; !ok {
+				dps[name] = &DatapathStats{Name: name}
+			}
+			dp = dps[name]
+			continue
+		}
+		if dp == nil {
+			continue
+		}
+		if m := lookupsRe.FindStringSubmatch(line); m != nil {
+			dp.Hit, _ = strconv.ParseUint(m[1], 10, 64)
+			dp.Missed, _ = strconv.ParseUint(m[2], 10, 64)
+			dp.Lost, _ = strconv.ParseUint(m[3], 10, 64)
+		} else if m := flowsRe.FindStringSubmatch(line); m != nil {
+			dp.Flows, _ = strconv.ParseUint(m[1], 10, 64)
+		}
+	}
+}
+
+// parseUpcallShow parses the output of "upcall/show".
+func parseUpcallShow(output string, dps map[string]*DatapathStats) {
+	var dp *DatapathStats
+	for _, line := range strings.Split(output, "\n") {
+		if line != "" && !strings.HasPrefix(line, " ") && strings.HasSuffix(line, ":") {
+			name := strings.TrimSuffix(line, ":")
+			if _, ok := dps[name]; !ok {
+				dps[name] = &DatapathStats{Name: name}
+			}
+			dp = dps[name]
+			continue
+		}
+		if dp == nil {
+			continue
+		}
+		if m := upcallFlowsRe.FindStringSubmatch(line); m != nil {
+			dp.UpcallFlows, _ = strconv.ParseUint(m[1], 10, 64)
+			dp.UpcallFlowsAvg, _ = strconv.ParseUint(m[2], 10, 64)
+			dp.UpcallFlowsMax, _ = strconv.ParseUint(m[3], 10, 64)
+			dp.FlowLimit, _ = strconv.ParseUint(m[4], 10, 64)
+		} else if m := dumpRe.FindStringSubmatch(line); m != nil {
+			dp.DumpDuration = m[1]
+		} else if m := revalidatorRe.FindStringSubmatch(line); m != nil {
+			keys, _ := strconv.ParseUint(m[1], 10, 64)
+			dp.Revalidators++
+			dp.RevalidatorKeys += keys
+		}
+	}
+}
+
+// SetAppCtl sets the unixctl client of the ovs-vswitchd daemon. If set, datapath, upcall
+// and memory statistics are also reported when statistics are enabled.
+func (o *OVSClient) SetAppCtl(appctl *unixctl.Client) {
+	o.appctl = appctl
+}
+
+// AppCtl returns the unixctl client of the ovs-vswitchd daemon (if any).
+func (o *OVSClient) AppCtl() *unixctl.Client {
+	return o.appctl
+}
+
+// enableDatapathStatistics registers the datapath statistics and starts refreshing them
+// periodically until DisableStatistics is called.
+func (o *OVSClient) enableDatapathStatistics(interval time.Duration) {
+	if o.appctl == nil || o.appctlStop != nil {
+		return
+	}
+	for _, stat := range datapathStatOrder {
+		o.stats.RegisterStat(o.datapathStatName(stat))
+	}
+	o.appctlStop = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			o.updateDatapathStatistics()
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}(o.appctlStop)
+}
+
+func (o *OVSClient) disableDatapathStatistics() {
+	if o.appctlStop != nil {
+		close(o.appctlStop)
+		o.appctlStop = nil
+	}
+}
+
+// datapathStatName returns the name of the datapath statistic as registered in the stats backend.
+func (o *OVSClient) datapathStatName(stat string) string {
+	if o.name == "" {
+		return datapathStatNames[stat]
+	}
+	return fmt.Sprintf("[%s] %s", o.name, datapathStatNames[stat])
+}
+
+func (o *OVSClient) updateDatapathStatistics() {
+	dps := map[string]*DatapathStats{}
+	if output, err := o.appctl.Call("dpctl/show"); err != nil {
+		o.log.Debugf("Failed to retrieve datapath statistics: %s", err.Error())
+	} else {
+		parseDpctlShow(output, dps)
+	}
+	if output, err := o.appctl.Call("upcall/show"); err != nil {
+		o.log.Debugf("Failed to retrieve upcall statistics: %s", err.Error())
+	} else {
+		parseUpcallShow(output, dps)
+	}
+
+	names := []string{}
+	for name := range dps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lookups, flows, upcall, dump, revalidator := []string{}, []string{}, []string{}, []string{}, []string{}
+	for _, name := range names {
+		dp := dps[name]
+		prefix := ""
+		if len(dps) > 1 {
+			prefix = dp.Name + ": "
+		}
+		lookups = append(lookups, fmt.Sprintf("%s%d, %d, %d", prefix, dp.Hit, dp.Missed, dp.Lost))
+		flows = append(flows, fmt.Sprintf("%s%d", prefix, dp.Flows))
+		upcall = append(upcall, fmt.Sprintf("%s%d, %d, %d, %d", prefix, dp.UpcallFlows, dp.UpcallFlowsAvg,
+			dp.UpcallFlowsMax, dp.FlowLimit))
+		dump = append(dump, prefix+dp.DumpDuration)
+		revalidator = append(revalidator, fmt.Sprintf("%s%d, %d", prefix, dp.Revalidators, dp.RevalidatorKeys))
+	}
+	o.stats.UpdateStat(o.datapathStatName("dp-lookups"), strings.Join(lookups, "; "))
+	o.stats.UpdateStat(o.datapathStatName("dp-flows"), strings.Join(flows, "; "))
+	o.stats.UpdateStat(o.datapathStatName("upcall"), strings.Join(upcall, "; "))
+	o.stats.UpdateStat(o.datapathStatName("dump"), strings.Join(dump, "; "))
+	o.stats.UpdateStat(o.datapathStatName("revalidator"), strings.Join(revalidator, "; "))
+
+	if output, err := o.appctl.Call("memory/show"); err != nil {
+		o.log.Debugf("Failed to retrieve memory usage: %s", err.Error())
+	} else {
+		o.stats.UpdateStat(o.datapathStatName("memory"), strings.TrimSpace(output))
+	}
+	o.stats.Draw()
+}
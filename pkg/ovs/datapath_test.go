@@ -0,0 +1,75 @@
+package ovs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDatapathStats(t *testing.T) {
+	dpctlShow := `system@ovs-system:
+  lookups: hit:1186 missed:361 lost:2
+  flows: 12
+  masks: hit:2921 total:4 hit/pkt:1.89
+  port 0: ovs-system (internal)
+  port 1: br-int (internal)
+netdev@ovs-netdev:
+  lookups: hit:0 missed:0 lost:0
+  flows: 0
+`
+	upcallShow := `system@ovs-system:
+  flows         : (current 12) (avg 10) (max 40) (limit 200000)
+  dump duration : 2ms
+  ufid enabled : true
+
+  7: (keys 5)
+  8: (keys 7)
+`
+	tests := []struct {
+		name   string
+		parse  func(string, map[string]*DatapathStats)
+		output string
+		dps    map[string]*DatapathStats
+	}{
+		{
+			name:   "dpctl/show",
+			parse:  parseDpctlShow,
+			output: dpctlShow,
+			dps: map[string]*DatapathStats{
+				"system@ovs-system": {Name: "system@ovs-system", Hit: 1186, Missed: 361, Lost: 2, Flows: 12},
+				"netdev@ovs-netdev": {Name: "netdev@ovs-netdev"},
+			},
+		},
+		{
+			name:   "upcall/show",
+			parse:  parseUpcallShow,
+			output: upcallShow,
+			dps: map[string]*DatapathStats{
+				"system@ovs-system": {Name: "system@ovs-system", UpcallFlows: 12, UpcallFlowsAvg: 10,
+					UpcallFlowsMax: 40, FlowLimit: 200000, DumpDuration: "2ms", Revalidators: 2, RevalidatorKeys: 12},
+			},
+		},
+		{
+			name:   "lines before the first datapath",
+			parse:  parseDpctlShow,
+			output: "  flows: 3\n",
+			dps:    map[string]*DatapathStats{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dps := map[string]*DatapathStats{}
+			tt.parse(tt.output, dps)
+			if !reflect.DeepEqual(dps, tt.dps) {
+				t.Errorf("got %+v, want %+v", dps, tt.dps)
+			}
+		})
+	}
+
+	// Both outputs are merged into the same stats.
+	dps := map[string]*DatapathStats{}
+	parseDpctlShow(dpctlShow, dps)
+	parseUpcallShow(upcallShow, dps)
+	if dp := dps["system@ovs-system"]; dp.Flows != 12 || dp.UpcallFlows != 12 || dp.Hit != 1186 {
+		t.Errorf("merged stats = %+v", dp)
+	}
+}
@@ -0,0 +1,373 @@
+package ovs
+
+import (
+	"amorenoz/ovs-flowmon/pkg/ovs/vswitchd"
+	"amorenoz/ovs-flowmon/pkg/stats"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	flowmessage "github.com/netsampler/goflow2/pb"
+	"github.com/ovn-org/libovsdb/cache"
+	"github.com/ovn-org/libovsdb/model"
+	"github.com/sirupsen/logrus"
+)
+
+// InterfaceInfo is the information of an OVS Interface associated with an OpenFlow port.
+type InterfaceInfo struct {
+	Name        string
+	Type        string
+	IfaceID     string
+	AttachedMac string
+	VMID        string
+	// RemoteIP is the remote end of tunnel interfaces.
+	RemoteIP string
+}
+
+// interfaceType returns the type of an interface. An empty type means "system".
+func interfaceType(iface *vswitchd.Interface) string {
+	if iface.Type == "" {
+		return "system"
+	}
+	return iface.Type
+}
+
+// ofportIndex keeps the UUIDs of the Interfaces indexed by OpenFlow port number so
+// samples can be enriched without scanning the cache. Several bridges can use the same
+// OpenFlow port number.
+type ofportIndex struct {
+	mutex  sync.RWMutex
+	ifaces map[int][]string
+}
+
+func newOfportIndex() *ofportIndex {
+	return &ofportIndex{ifaces: make(map[int][]string)}
+}
+
+// reset removes everything from the index.
+func (i *ofportIndex) reset() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.ifaces = make(map[int][]string)
+}
+
+func (i *ofportIndex) add(iface *vswitchd.Interface) {
+	if iface.Ofport == nil {
+		return
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	for _, uuid := range i.ifaces[*iface.Ofport] {
+		if uuid == iface.UUID {
+			return
+		}
+	}
+	i.ifaces[*iface.Ofport] = append(i.ifaces[*iface.Ofport], iface.UUID)
+}
+
+func (i *ofportIndex) delete(iface *vswitchd.Interface) {
+	if iface.Ofport == nil {
+		return
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	uuids := i.ifaces[*iface.Ofport]
+	for idx, uuid := range uuids {
+		if uuid == iface.UUID {
+			uuids = append(uuids[:idx], uuids[idx+1:]...)
+			break
+		}
+	}
+	if len(uuids) == 0 {
+		delete(i.ifaces, *iface.Ofport)
+	} else {
+		i.ifaces[*iface.Ofport] = uuids
+	}
+}
+
+// lookup returns the UUIDs of the Interfaces with the given OpenFlow port number.
+func (i *ofportIndex) lookup(ofport int) []string {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return append([]string{}, i.ifaces[ofport]...)
+}
+
+// eventHandler returns the cache event handler that keeps the index up to date.
+func (i *ofportIndex) eventHandler() cache.EventHandler {
+	return &cache.EventHandlerFuncs{
+		AddFunc: func(table string, newModel model.Model) {
+			if table == "Interface" {
+				i.add(newModel.(*vswitchd.Interface))
+			}
+		},
+		UpdateFunc: func(table string, oldModel, newModel model.Model) {
+			if table == "Interface" {
+				i.delete(oldModel.(*vswitchd.Interface))
+				i.add(newModel.(*vswitchd.Interface))
+			}
+		},
+		DeleteFunc: func(table string, oldModel model.Model) {
+			if table == "Interface" {
+				i.delete(oldModel.(*vswitchd.Interface))
+			}
+		},
+	}
+}
+
+// buildOfportIndex adds all the Interfaces in the cache to the index.
+func (o *OVSClient) buildOfportIndex() error {
+	ifaces := []vswitchd.Interface{}
+	if err := o.client.List(&ifaces); err != nil {
+		return err
+	}
+	for i := range ifaces {
+		o.ofports.add(&ifaces[i])
+	}
+	return nil
+}
+
+// GetInterface returns the information of the interface that has the given OpenFlow port
+// number in the given bridge.
+func (o *OVSClient) GetInterface(bridgeName string, ofport int) (*InterfaceInfo, error) {
+	ifaces := []vswitchd.Interface{}
+	for _, uuid := range o.ofports.lookup(ofport) {
+		iface := vswitchd.Interface{UUID: uuid}
+		if err := o.client.Get(&iface); err != nil {
+			continue
+		}
+		ifaces = append(ifaces, iface)
+	}
+	if len(ifaces) == 0 {
+		return nil, fmt.Errorf("No Interface found with ofport %d", ofport)
+	}
+	iface := &ifaces[0]
+	if len(ifaces) > 1 {
+		// Same ofport in different bridges.
+		var err error
+		iface, err = o.bridgeInterface(bridgeName, ifaces)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &InterfaceInfo{
+		Name:        iface.Name,
+		Type:        interfaceType(iface),
+		IfaceID:     iface.ExternalIDs["iface-id"],
+		AttachedMac: iface.ExternalIDs["attached-mac"],
+		VMID:        iface.ExternalIDs["vm-id"],
+		RemoteIP:    iface.Options["remote_ip"],
+	}, nil
+}
+
+// bridgeInterface returns the interface among the candidates that belongs to the bridge.
+func (o *OVSClient) bridgeInterface(bridgeName string, candidates []vswitchd.Interface) (*vswitchd.Interface, error) {
+	bridge := &vswitchd.Bridge{
+		Name: bridgeName,
+	}
+	if err := o.client.Get(bridge); err != nil {
+		return nil, fmt.Errorf("Failed to get bridge %s: %s", bridgeName, err.Error())
+	}
+	bridgeIfaces := map[string]bool{}
+	for _, portUUID := range bridge.Ports {
+		port := &vswitchd.Port{
+			UUID: portUUID,
+		}
+		if err := o.client.Get(port); err != nil {
+			continue
+		}
+		for _, ifaceUUID := range port.Interfaces {
+			bridgeIfaces[ifaceUUID] = true
+		}
+	}
+	for i := range candidates {
+		if bridgeIfaces[candidates[i].UUID] {
+			return &candidates[i], nil
+		}
+	}
+	return nil, fmt.Errorf("No Interface found in bridge %s with ofport %d", bridgeName, *candidates[0].Ofport)
+}
+
+// Enrich implements netflow.Enricher. It adds the information of the interfaces
+// associated with the sample's input and output OpenFlow ports in the sampled bridge.
+func (o *OVSClient) Enrich(msg *flowmessage.FlowMessage, extra map[string]interface{}, log *logrus.Logger) map[string]interface{} {
+	if !o.client.Connected() || o.bridge == "" {
+		return extra
+	}
+	for prefix, ofport := range map[string]uint32{"In": msg.InIf, "Out": msg.OutIf} {
+		if ofport == 0 {
+			continue
+		}
+		iface, err := o.GetInterface(o.bridge, int(ofport))
+		if err != nil {
+			log.Debug(err)
+			continue
+		}
+		extra[prefix+"IfName"] = iface.Name
+		extra[prefix+"IfType"] = iface.Type
+		extra[prefix+"IfaceID"] = iface.IfaceID
+		extra[prefix+"AttachedMac"] = iface.AttachedMac
+		extra[prefix+"VMID"] = iface.VMID
+		if iface.RemoteIP != "" {
+			extra[prefix+"IfRemoteIP"] = iface.RemoteIP
+		}
+	}
+	return extra
+}
+
+// interfaceUpdate stores the last statistics reported for an interface.
+type interfaceUpdate struct {
+	time  time.Time
+	stats *stats.InterfaceStats
+}
+
+// EnableInterfaceStatistics starts reporting the statistics of every interface to the
+// given backend. Rates are computed from successive updates of the Interface table.
+func (o *OVSClient) EnableInterfaceStatistics(backend stats.InterfaceStatsBackend) error {
+	if !o.client.Connected() {
+		return fmt.Errorf("Client not connected")
+	}
+	o.ifaceStats = backend
+	o.ifaceUpdates = make(map[string]*interfaceUpdate)
+	o.ifaceBridgesDirty = true
+
+	ifaces := []vswitchd.Interface{}
+	if err := o.client.List(&ifaces); err != nil {
+		return err
+	}
+	for i := range ifaces {
+		o.updateInterfaceStatistics(nil, &ifaces[i])
+	}
+	o.ifaceStats.Draw()
+
+	o.client.OnReconnect(o.removeStaleInterfaces)
+	o.client.AddEventHandler(&cache.EventHandlerFuncs{
+		AddFunc: func(table string, newModel model.Model) {
+			switch table {
+			case "Interface":
+				o.updateInterfaceStatistics(nil, newModel.(*vswitchd.Interface))
+				o.ifaceStats.Draw()
+			case "Bridge", "Port":
+				o.ifaceBridgesDirty = true
+			}
+		},
+		UpdateFunc: func(table string, oldModel, newModel model.Model) {
+			switch table {
+			case "Interface":
+				o.updateInterfaceStatistics(oldModel.(*vswitchd.Interface), newModel.(*vswitchd.Interface))
+				o.ifaceStats.Draw()
+			case "Bridge", "Port":
+				o.ifaceBridgesDirty = true
+			}
+		},
+		DeleteFunc: func(table string, oldModel model.Model) {
+			switch table {
+			case "Interface":
+				iface := oldModel.(*vswitchd.Interface)
+				delete(o.ifaceUpdates, iface.UUID)
+				o.ifaceStats.RemoveInterface(o.interfaceKey(iface))
+				o.ifaceStats.Draw()
+			case "Bridge", "Port":
+				o.ifaceBridgesDirty = true
+			}
+		},
+	})
+	return nil
+}
+
+// removeStaleInterfaces stops reporting the interfaces that were deleted while the client
+// was reconnecting, as no delete event is sent for them.
+func (o *OVSClient) removeStaleInterfaces() {
+	o.ifaceBridgesDirty = true
+	for uuid := range o.ifaceUpdates {
+		iface := &vswitchd.Interface{UUID: uuid}
+		if err := o.client.Get(iface); err == nil {
+			continue
+		}
+		delete(o.ifaceUpdates, uuid)
+		o.ifaceStats.RemoveInterface(o.interfaceKey(iface))
+	}
+	o.ifaceStats.Draw()
+}
+
+func (o *OVSClient) interfaceKey(iface *vswitchd.Interface) string {
+	return o.name + "/" + iface.UUID
+}
+
+// interfaceBridge returns the name of the bridge the interface belongs to.
+// Must only be called from cache event handlers (or before they are registered).
+func (o *OVSClient) interfaceBridge(ifaceUUID string) string {
+	if o.ifaceBridgesDirty {
+		o.ifaceBridges = make(map[string]string)
+		bridges := []vswitchd.Bridge{}
+		if err := o.client.List(&bridges); err != nil {
+			o.log.Error(err)
+		}
+		for _, bridge := range bridges {
+			for _, portUUID := range bridge.Ports {
+				port := &vswitchd.Port{
+					UUID: portUUID,
+				}
+				if err := o.client.Get(port); err != nil {
+					continue
+				}
+				for _, uuid := range port.Interfaces {
+					o.ifaceBridges[uuid] = bridge.Name
+				}
+			}
+		}
+		o.ifaceBridgesDirty = false
+	}
+	return o.ifaceBridges[ifaceUUID]
+}
+
+// updateInterfaceStatistics computes the interface's rates from its previous and current
+// statistics and reports them to the backend.
+func (o *OVSClient) updateInterfaceStatistics(oldIface, iface *vswitchd.Interface) {
+	now := time.Now()
+	ifStats := &stats.InterfaceStats{
+		Chassis:   o.name,
+		Bridge:    o.interfaceBridge(iface.UUID),
+		Name:      iface.Name,
+		Type:      interfaceType(iface),
+		RxPackets: int64(iface.Statistics["rx_packets"]),
+		TxPackets: int64(iface.Statistics["tx_packets"]),
+		RxBytes:   int64(iface.Statistics["rx_bytes"]),
+		TxBytes:   int64(iface.Statistics["tx_bytes"]),
+		RxDropped: int64(iface.Statistics["rx_dropped"]),
+		TxDropped: int64(iface.Statistics["tx_dropped"]),
+		RxErrors:  int64(iface.Statistics["rx_errors"]),
+		TxErrors:  int64(iface.Statistics["tx_errors"]),
+	}
+	if iface.LinkState != nil {
+		ifStats.LinkState = *iface.LinkState
+	}
+
+	last, ok := o.ifaceUpdates[iface.UUID]
+	switch {
+	case !ok || oldIface == nil:
+		o.ifaceUpdates[iface.UUID] = &interfaceUpdate{time: now, stats: ifStats}
+	case reflect.DeepEqual(oldIface.Statistics, iface.Statistics):
+		// Other columns changed, keep the last rates.
+		ifStats.RxPps, ifStats.TxPps = last.stats.RxPps, last.stats.TxPps
+		ifStats.RxBps, ifStats.TxBps = last.stats.RxBps, last.stats.TxBps
+		ifStats.DropsIncreasing = last.stats.DropsIncreasing
+		ifStats.ErrorsIncreasing = last.stats.ErrorsIncreasing
+		last.stats = ifStats
+	default:
+		elapsed := now.Sub(last.time).Seconds()
+		delta := func(name string) float64 {
+			return float64(iface.Statistics[name] - oldIface.Statistics[name])
+		}
+		if elapsed > 0 {
+			ifStats.RxPps = delta("rx_packets") / elapsed
+			ifStats.TxPps = delta("tx_packets") / elapsed
+			ifStats.RxBps = 8 * delta("rx_bytes") / elapsed
+			ifStats.TxBps = 8 * delta("tx_bytes") / elapsed
+		}
+		ifStats.DropsIncreasing = delta("rx_dropped") > 0 || delta("tx_dropped") > 0
+		ifStats.ErrorsIncreasing = delta("rx_errors") > 0 || delta("tx_errors") > 0
+		o.ifaceUpdates[iface.UUID] = &interfaceUpdate{time: now, stats: ifStats}
+	}
+	o.ifaceStats.UpdateInterface(o.interfaceKey(iface), ifStats)
+}
@@ -0,0 +1,93 @@
+package ovs
+
+import (
+	"amorenoz/ovs-flowmon/pkg/ovs/vswitchd"
+	"reflect"
+	"testing"
+)
+
+func TestOfportIndex(t *testing.T) {
+	iface := func(uuid string, ofport int) *vswitchd.Interface {
+		return &vswitchd.Interface{UUID: uuid, Ofport: &ofport}
+	}
+	type update struct{ old, new *vswitchd.Interface }
+	tests := []struct {
+		name    string
+		added   []*vswitchd.Interface
+		updated []update
+		deleted []*vswitchd.Interface
+		ofport  int
+		want    []string
+	}{
+		{
+			name:   "single",
+			added:  []*vswitchd.Interface{iface("veth1", 7), iface("veth2", 8)},
+			ofport: 7,
+			want:   []string{"veth1"},
+		},
+		{
+			name:   "same ofport in two bridges",
+			added:  []*vswitchd.Interface{iface("br-int-veth", 7), iface("breth0-eth0", 7)},
+			ofport: 7,
+			want:   []string{"br-int-veth", "breth0-eth0"},
+		},
+		{
+			name:   "added twice",
+			added:  []*vswitchd.Interface{iface("veth1", 7), iface("veth1", 7)},
+			ofport: 7,
+			want:   []string{"veth1"},
+		},
+		{
+			name:   "no ofport yet",
+			added:  []*vswitchd.Interface{{UUID: "veth1"}},
+			ofport: 0,
+			want:   []string{},
+		},
+		{
+			name:    "ofport assigned",
+			added:   []*vswitchd.Interface{{UUID: "veth1"}},
+			updated: []update{{&vswitchd.Interface{UUID: "veth1"}, iface("veth1", 9)}},
+			ofport:  9,
+			want:    []string{"veth1"},
+		},
+		{
+			name:    "ofport changed",
+			added:   []*vswitchd.Interface{iface("veth1", 7)},
+			updated: []update{{iface("veth1", 7), iface("veth1", 9)}},
+			ofport:  7,
+			want:    []string{},
+		},
+		{
+			name:    "deleted",
+			added:   []*vswitchd.Interface{iface("br-int-veth", 7), iface("breth0-eth0", 7)},
+			deleted: []*vswitchd.Interface{iface("br-int-veth", 7)},
+			ofport:  7,
+			want:    []string{"breth0-eth0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := newOfportIndex()
+			handler := i.eventHandler()
+			for _, iface := range tt.added {
+				handler.OnAdd("Interface", iface)
+			}
+			for _, u := range tt.updated {
+				handler.OnUpdate("Interface", u.old, u.new)
+			}
+			for _, iface := range tt.deleted {
+				handler.OnDelete("Interface", iface)
+			}
+			if got := i.lookup(tt.ofport); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lookup(%d) = %v, want %v", tt.ofport, got, tt.want)
+			}
+		})
+	}
+
+	i := newOfportIndex()
+	i.add(iface("veth1", 7))
+	i.reset()
+	if got := i.lookup(7); len(got) != 0 {
+		t.Errorf("lookup() after reset = %v", got)
+	}
+}
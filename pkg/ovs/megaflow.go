@@ -0,0 +1,305 @@
+package ovs
+
+import (
+	"amorenoz/ovs-flowmon/pkg/flowmon"
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	dpifPortRe = regexp.MustCompile(`^\s+(\S+) (\d+|\S+)/(\d+):`)
+)
+
+// DatapathFlow is a datapath flow (a.k.a megaflow) as printed by "dpctl/dump-flows".
+type DatapathFlow struct {
+	Match   string
+	Packets uint64
+	Bytes   uint64
+	Used    string
+	Actions string
+
+	// attrs maps match attributes (e.g: "ipv4.src" or "in_port") to their
+	// (possibly masked) value.
+	attrs map[string]string
+}
+
+// String returns the datapath flow in a format similar to "dpctl/dump-flows".
+func (f *DatapathFlow) String() string {
+	return fmt.Sprintf("%s, packets:%d, bytes:%d, used:%s, actions:%s", f.Match, f.Packets, f.Bytes, f.Used, f.Actions)
+}
+
+// splitTopLevel splits a string by commas that are not enclosed in parentheses.
+func splitTopLevel(s string) []string {
+	parts := []string{}
+	depth := 0
+	start := 0
+	for i, c := range s {
+		switch c {
+		case '(', '{':
+			depth++
+		case ')', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if start < len(s) {
+		parts = append(parts, s[start:])
+	}
+	return parts
+}
+
+// parseMatchAttrs parses the match of a datapath flow. Nested attributes (encap) are
+// flattened.
+func parseMatchAttrs(match string, attrs map[string]string) {
+	for _, part := range splitTopLevel(match) {
+		part = strings.TrimSpace(part)
+		open := strings.Index(part, "(")
+		if open < 0 || !strings.HasSuffix(part, ")") {
+			continue
+		}
+		name := part[:open]
+		content := part[open+1 : len(part)-1]
+		if name == "encap" {
+			parseMatchAttrs(content, attrs)
+			continue
+		}
+		if !strings.Contains(content, "=") {
+			attrs[name] = content
+			continue
+		}
+		for _, field := range splitTopLevel(content) {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			attrs[name+"."+kv[0]] = kv[1]
+		}
+	}
+}
+
+// ParseDatapathFlows parses the output of "dpctl/dump-flows".
+func ParseDatapathFlows(output string) []*DatapathFlow {
+	flows := []*DatapathFlow{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		idx := strings.Index(line, ", packets:")
+		if idx < 0 {
+			continue
+		}
+		flow := &DatapathFlow{
+			Match: line[:idx],
+			attrs: make(map[string]string),
+		}
+		stats := line[idx+2:]
+		if actIdx := strings.Index(stats, "actions:"); actIdx >= 0 {
+			flow.Actions = stats[actIdx+len("actions:"):]
+			stats = stats[:actIdx]
+		}
+		for _, field := range strings.Split(stats, ", ") {
+			kv := strings.SplitN(strings.TrimSpace(field), ":", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "packets":
+				flow.Packets, _ = strconv.ParseUint(kv[1], 10, 64)
+			case "bytes":
+				flow.Bytes, _ = strconv.ParseUint(kv[1], 10, 64)
+			case "used":
+				flow.Used = kv[1]
+			}
+		}
+		parseMatchAttrs(flow.Match, flow.attrs)
+		flows = append(flows, flow)
+	}
+	return flows
+}
+
+// parseDpifPorts parses the output of "dpif/show" and returns, for each bridge, a map of
+// OpenFlow port numbers to datapath port numbers.
+func parseDpifPorts(output string) map[string]map[int]int {
+	bridges := map[string]map[int]int{}
+	var ports map[int]int
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(line, "  ") && !strings.HasPrefix(line, "    ") && strings.HasSuffix(trimmed, ":") {
+			ports = make(map[int]int)
+			bridges[strings.TrimSuffix(trimmed, ":")] = ports
+			continue
+		}
+		if ports == nil {
+			continue
+		}
+		if m := dpifPortRe.FindStringSubmatch(line); m != nil {
+			ofport, err := strconv.Atoi(m[2])
+			if err != nil {
+				// e.g: "br-int 65534/1" is numeric but "LOCAL" might be printed.
+				continue
+			}
+			odport, _ := strconv.Atoi(m[3])
+			ports[ofport] = odport
+		}
+	}
+	return bridges
+}
+
+// matchesMasked returns whether value matches the (possibly masked) attribute
+// using the parse function to convert both value and mask to bytes.
+func matchesMasked(attr string, value []byte, parse func(string) []byte) bool {
+	parts := strings.SplitN(attr, "/", 2)
+	attrValue := parse(parts[0])
+	if attrValue == nil || len(attrValue) != len(value) {
+		return false
+	}
+	mask := bytes.Repeat([]byte{0xff}, len(value))
+	if len(parts) == 2 {
+		mask = parse(parts[1])
+		if mask == nil || len(mask) != len(value) {
+			return false
+		}
+	}
+	for i := range value {
+		if value[i]&mask[i] != attrValue[i]&mask[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func parseUintBytes(s string) []byte {
+	val, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return nil
+	}
+	b := make([]byte, 8)
+	for i := 0; i < 8; i++ {
+		b[7-i] = byte(val >> (8 * i))
+	}
+	return b
+}
+
+func uintBytes(val uint64) []byte {
+	return parseUintBytes(strconv.FormatUint(val, 10))
+}
+
+func parseMacBytes(s string) []byte {
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		return nil
+	}
+	return mac
+}
+
+func parseIPBytes(s string) []byte {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+func ipBytes(ip net.IP) []byte {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+// Covers returns whether the datapath flow's match covers the given fields of a FlowKey.
+// Fields that are not part of the datapath flow's match are wildcarded. ofToOdp maps
+// OpenFlow port numbers to datapath port numbers.
+func (f *DatapathFlow) Covers(key *flowmon.FlowKey, fields []string, ofToOdp map[int]int) bool {
+	check := func(attrNames []string, value []byte, parse func(string) []byte) bool {
+		for _, name := range attrNames {
+			if attr, ok := f.attrs[name]; ok {
+				if !matchesMasked(attr, value, parse) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	l4 := func(field string) []string {
+		return []string{"tcp." + field, "udp." + field, "sctp." + field}
+	}
+	for _, field := range fields {
+		ok := true
+		switch field {
+		case "InIf":
+			odport, found := ofToOdp[int(key.InIf)]
+			if !found {
+				continue
+			}
+			ok = check([]string{"in_port"}, uintBytes(uint64(odport)), parseUintBytes)
+		case "SrcMac":
+			ok = check([]string{"eth.src"}, key.SrcMac, parseMacBytes)
+		case "DstMac":
+			ok = check([]string{"eth.dst"}, key.DstMac, parseMacBytes)
+		case "Etype":
+			ok = check([]string{"eth_type"}, uintBytes(uint64(key.Etype)), parseUintBytes)
+		case "VlanID":
+			if key.VlanID != 0 {
+				ok = check([]string{"vlan.vid"}, uintBytes(uint64(key.VlanID)), parseUintBytes)
+			}
+		case "SrcAddr":
+			ok = check([]string{"ipv4.src", "ipv6.src"}, ipBytes(key.SrcAddr), parseIPBytes)
+		case "DstAddr":
+			ok = check([]string{"ipv4.dst", "ipv6.dst"}, ipBytes(key.DstAddr), parseIPBytes)
+		case "Proto":
+			ok = check([]string{"ipv4.proto", "ipv6.proto"}, uintBytes(uint64(key.Proto)), parseUintBytes)
+		case "SrcPort":
+			ok = check(l4("src"), uintBytes(uint64(key.SrcPort)), parseUintBytes)
+		case "DstPort":
+			ok = check(l4("dst"), uintBytes(uint64(key.DstPort)), parseUintBytes)
+		case "ICMPType":
+			ok = check([]string{"icmp.type", "icmpv6.type"}, uintBytes(uint64(key.ICMPType)), parseUintBytes)
+		case "ICMPCode":
+			ok = check([]string{"icmp.code", "icmpv6.code"}, uintBytes(uint64(key.ICMPCode)), parseUintBytes)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchingDatapathFlows returns the datapath flows whose match covers the given fields of
+// the FlowKey. The ovs-vswitchd unixctl client must be configured.
+func (o *OVSClient) MatchingDatapathFlows(key *flowmon.FlowKey, fields []string) ([]*DatapathFlow, error) {
+	if o.appctl == nil {
+		return nil, fmt.Errorf("ovs-vswitchd control socket not available")
+	}
+	ofToOdp := map[int]int{}
+	if output, err := o.appctl.Call("dpif/show"); err != nil {
+		o.log.Warningf("Failed to retrieve datapath ports, in_port will not be matched: %s", err.Error())
+	} else if ports, ok := parseDpifPorts(output)[o.bridge]; ok {
+		ofToOdp = ports
+	}
+	// Port names in in_port would not match the datapath port numbers. OVS versions
+	// that do not support "--no-names" do not print names either.
+	output, err := o.appctl.Call("dpctl/dump-flows", "--no-names")
+	if err != nil {
+		output, err = o.appctl.Call("dpctl/dump-flows")
+	}
+	if err != nil {
+		return nil, err
+	}
+	matching := []*DatapathFlow{}
+	for _, flow := range ParseDatapathFlows(output) {
+		if flow.Covers(key, fields, ofToOdp) {
+			matching = append(matching, flow)
+		}
+	}
+	return matching, nil
+}
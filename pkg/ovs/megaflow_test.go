@@ -0,0 +1,165 @@
+package ovs
+
+import (
+	"amorenoz/ovs-flowmon/pkg/flowmon"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParseDatapathFlows(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		flows  []*DatapathFlow
+	}{
+		{
+			name:   "empty",
+			output: "",
+			flows:  []*DatapathFlow{},
+		},
+		{
+			name: "ipv4 tcp",
+			output: "recirc_id(0),in_port(2),eth(src=0a:58:0a:f4:00:05,dst=0a:58:0a:f4:00:01),eth_type(0x0800)," +
+				"ipv4(src=10.244.0.5,dst=10.96.0.0/255.255.0.0,proto=6,frag=no),tcp(dst=443), " +
+				"packets:12, bytes:1500, used:0.510s, flags:S., actions:ct(zone=3),recirc(0x2)\n",
+			flows: []*DatapathFlow{{
+				Match: "recirc_id(0),in_port(2),eth(src=0a:58:0a:f4:00:05,dst=0a:58:0a:f4:00:01),eth_type(0x0800)," +
+					"ipv4(src=10.244.0.5,dst=10.96.0.0/255.255.0.0,proto=6,frag=no),tcp(dst=443)",
+				Packets: 12,
+				Bytes:   1500,
+				Used:    "0.510s",
+				Actions: "ct(zone=3),recirc(0x2)",
+				attrs: map[string]string{
+					"recirc_id": "0", "in_port": "2", "eth.src": "0a:58:0a:f4:00:05", "eth.dst": "0a:58:0a:f4:00:01",
+					"eth_type": "0x0800", "ipv4.src": "10.244.0.5", "ipv4.dst": "10.96.0.0/255.255.0.0",
+					"ipv4.proto": "6", "ipv4.frag": "no", "tcp.dst": "443",
+				},
+			}},
+		},
+		{
+			name: "vlan encap and header line",
+			output: "flow-dump from the main thread:\n" +
+				"in_port(3),eth(),eth_type(0x8100),vlan(vid=10,pcp=0),encap(eth_type(0x0800),ipv4(proto=17)), " +
+				"packets:0, bytes:0, used:never, actions:drop\n",
+			flows: []*DatapathFlow{{
+				Match:   "in_port(3),eth(),eth_type(0x8100),vlan(vid=10,pcp=0),encap(eth_type(0x0800),ipv4(proto=17))",
+				Used:    "never",
+				Actions: "drop",
+				attrs: map[string]string{
+					"in_port": "3", "eth": "", "eth_type": "0x0800", "vlan.vid": "10", "vlan.pcp": "0",
+					"ipv4.proto": "17",
+				},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if flows := ParseDatapathFlows(tt.output); !reflect.DeepEqual(flows, tt.flows) {
+				t.Errorf("ParseDatapathFlows() = %+v, want %+v", flows, tt.flows)
+			}
+		})
+	}
+}
+
+func TestParseDpifPorts(t *testing.T) {
+	output := `system@ovs-system: hit:1186 missed:361
+  br-int:
+    br-int 65534/1: (internal)
+    genev_sys_6081 4/3: (geneve: packet_type=ptap)
+    veth1 7/5: (system)
+  breth0:
+    breth0 65534/2: (internal)
+    eth0 1/4: (system)
+`
+	want := map[string]map[int]int{
+		"br-int": {65534: 1, 4: 3, 7: 5},
+		"breth0": {65534: 2, 1: 4},
+	}
+	if ports := parseDpifPorts(output); !reflect.DeepEqual(ports, want) {
+		t.Errorf("parseDpifPorts() = %v, want %v", ports, want)
+	}
+}
+
+func TestDatapathFlowCovers(t *testing.T) {
+	flow := ParseDatapathFlows("in_port(5),eth(src=0a:58:0a:f4:00:05),eth_type(0x0800)," +
+		"ipv4(src=10.244.0.0/255.255.0.0,proto=6),tcp(dst=443), packets:1, bytes:60, used:1.0s, actions:2")[0]
+	named := ParseDatapathFlows("in_port(veth1),eth_type(0x0800), packets:1, bytes:60, used:1.0s, actions:2")[0]
+	mac, _ := net.ParseMAC("0a:58:0a:f4:00:05")
+	key := &flowmon.FlowKey{
+		InIf:    7,
+		SrcMac:  mac,
+		Etype:   flowmon.EtypeIPv4,
+		SrcAddr: net.ParseIP("10.244.1.2"),
+		DstAddr: net.ParseIP("10.96.0.1"),
+		Proto:   flowmon.ProtoTCP,
+		DstPort: 443,
+	}
+	ofToOdp := map[int]int{7: 5, 8: 6}
+	tests := []struct {
+		name    string
+		flow    *DatapathFlow
+		key     func(k flowmon.FlowKey) *flowmon.FlowKey
+		fields  []string
+		ofToOdp map[int]int
+		covers  bool
+	}{
+		{
+			name:    "all fields",
+			flow:    flow,
+			fields:  []string{"InIf", "SrcMac", "Etype", "SrcAddr", "DstAddr", "Proto", "DstPort"},
+			ofToOdp: ofToOdp,
+			covers:  true,
+		},
+		{
+			name:    "other in_port",
+			flow:    flow,
+			key:     func(k flowmon.FlowKey) *flowmon.FlowKey { k.InIf = 8; return &k },
+			fields:  []string{"InIf"},
+			ofToOdp: ofToOdp,
+		},
+		{
+			name:   "unknown datapath port",
+			flow:   flow,
+			key:    func(k flowmon.FlowKey) *flowmon.FlowKey { k.InIf = 8; return &k },
+			fields: []string{"InIf"},
+			covers: true,
+		},
+		{
+			name:    "port name",
+			flow:    named,
+			fields:  []string{"InIf"},
+			ofToOdp: ofToOdp,
+		},
+		{
+			name:   "masked address",
+			flow:   flow,
+			key:    func(k flowmon.FlowKey) *flowmon.FlowKey { k.SrcAddr = net.ParseIP("10.245.0.1"); return &k },
+			fields: []string{"SrcAddr"},
+		},
+		{
+			name:   "other port",
+			flow:   flow,
+			key:    func(k flowmon.FlowKey) *flowmon.FlowKey { k.DstPort = 80; return &k },
+			fields: []string{"DstPort"},
+		},
+		{
+			name:   "wildcarded field",
+			flow:   flow,
+			key:    func(k flowmon.FlowKey) *flowmon.FlowKey { k.SrcPort = 1234; return &k },
+			fields: []string{"SrcPort"},
+			covers: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := key
+			if tt.key != nil {
+				k = tt.key(*key)
+			}
+			if covers := tt.flow.Covers(k, tt.fields, tt.ofToOdp); covers != tt.covers {
+				t.Errorf("Covers() = %v, want %v", covers, tt.covers)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package ovs
+
+import (
+	"amorenoz/ovs-flowmon/pkg/flowmon"
+	"fmt"
+	"strings"
+)
+
+// OFProtoTraceFlow builds an "ofproto/trace" flow string from the given fields of a
+// FlowKey. Fields not in the list are considered wildcarded and are not added, except for
+// the prerequisites OVS requires to match on the others: dl_type is added if any L3 field
+// is and nw_proto if any L4 field is.
+func OFProtoTraceFlow(key *flowmon.FlowKey, fields []string) string {
+	has := map[string]bool{}
+	for _, field := range fields {
+		has[field] = true
+	}
+	isIPv4 := key.Etype == flowmon.EtypeIPv4
+	isIPv6 := key.Etype == flowmon.EtypeIPv6
+	icmpProto, icmpType, icmpCode := flowmon.ProtoICMP, "icmp_type", "icmp_code"
+	if isIPv6 {
+		icmpProto, icmpType, icmpCode = flowmon.ProtoICMPv6, "icmpv6_type", "icmpv6_code"
+	}
+
+	l4 := []string{}
+	switch key.Proto {
+	case flowmon.ProtoTCP, flowmon.ProtoUDP, flowmon.ProtoSCTP:
+		if has["SrcPort"] {
+			l4 = append(l4, fmt.Sprintf("tp_src=%d", key.SrcPort))
+		}
+		if has["DstPort"] {
+			l4 = append(l4, fmt.Sprintf("tp_dst=%d", key.DstPort))
+		}
+	case icmpProto:
+		if has["ICMPType"] {
+			l4 = append(l4, fmt.Sprintf("%s=%d", icmpType, key.ICMPType))
+		}
+		if has["ICMPCode"] {
+			l4 = append(l4, fmt.Sprintf("%s=%d", icmpCode, key.ICMPCode))
+		}
+	}
+	withProto := (has["Proto"] || len(l4) > 0) && key.Proto != 0
+
+	l3 := []string{}
+	if isIPv4 || isIPv6 {
+		srcField, dstField := "nw_src", "nw_dst"
+		if isIPv6 {
+			srcField, dstField = "ipv6_src", "ipv6_dst"
+		}
+		if has["SrcAddr"] && key.SrcAddr != nil {
+			l3 = append(l3, fmt.Sprintf("%s=%s", srcField, key.SrcAddr))
+		}
+		if has["DstAddr"] && key.DstAddr != nil {
+			l3 = append(l3, fmt.Sprintf("%s=%s", dstField, key.DstAddr))
+		}
+		if withProto {
+			l3 = append(l3, fmt.Sprintf("nw_proto=%d", uint32(key.Proto)))
+			l3 = append(l3, l4...)
+		}
+	}
+
+	parts := []string{}
+	if has["InIf"] && key.InIf != 0 {
+		parts = append(parts, fmt.Sprintf("in_port=%d", key.InIf))
+	}
+	if has["SrcMac"] && key.SrcMac != nil {
+		parts = append(parts, fmt.Sprintf("dl_src=%s", key.SrcMac))
+	}
+	if has["DstMac"] && key.DstMac != nil {
+		parts = append(parts, fmt.Sprintf("dl_dst=%s", key.DstMac))
+	}
+	if has["VlanID"] && key.VlanID != 0 {
+		parts = append(parts, fmt.Sprintf("dl_vlan=%d", key.VlanID))
+	}
+	if (has["Etype"] || len(l3) > 0) && key.Etype != 0 {
+		parts = append(parts, fmt.Sprintf("dl_type=0x%04x", uint32(key.Etype)))
+	}
+	parts = append(parts, l3...)
+	return strings.Join(parts, ",")
+}
+
+// OFProtoTrace runs "ofproto/trace" on the sampled bridge with a flow built from the
+// given fields of the FlowKey and returns its output.
+func (o *OVSClient) OFProtoTrace(key *flowmon.FlowKey, fields []string) (string, error) {
+	if o.appctl == nil {
+		return "", fmt.Errorf("ovs-vswitchd control socket not available")
+	}
+	bridge := o.bridge
+	if bridge == "" {
+		bridge = "br-int"
+	}
+	flow := OFProtoTraceFlow(key, fields)
+	output, err := o.appctl.Call("ofproto/trace", bridge, flow)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("$ ovs-appctl ofproto/trace %s '%s'\n\n%s", bridge, flow, output), nil
+}
@@ -0,0 +1,108 @@
+package ovs
+
+import (
+	"amorenoz/ovs-flowmon/pkg/flowmon"
+	"net"
+	"testing"
+)
+
+func TestOFProtoTraceFlow(t *testing.T) {
+	mac, _ := net.ParseMAC("0a:58:0a:f4:00:05")
+	tcp := &flowmon.FlowKey{
+		InIf:    3,
+		SrcMac:  mac,
+		Etype:   flowmon.EtypeIPv4,
+		SrcAddr: net.ParseIP("10.244.0.5").To4(),
+		DstAddr: net.ParseIP("10.96.0.1").To4(),
+		Proto:   flowmon.ProtoTCP,
+		SrcPort: 34567,
+		DstPort: 443,
+	}
+	sctp := &flowmon.FlowKey{
+		Etype:   flowmon.EtypeIPv6,
+		SrcAddr: net.ParseIP("fd00::5"),
+		DstAddr: net.ParseIP("fd00::6"),
+		Proto:   flowmon.ProtoSCTP,
+		SrcPort: 36412,
+		DstPort: 38412,
+	}
+	icmp := &flowmon.FlowKey{
+		Etype:    flowmon.EtypeIPv4,
+		SrcAddr:  net.ParseIP("10.244.0.5").To4(),
+		Proto:    flowmon.ProtoICMP,
+		ICMPType: 8,
+		ICMPCode: 0,
+	}
+	arp := &flowmon.FlowKey{
+		SrcMac: mac,
+		Etype:  flowmon.EtypeARP,
+	}
+	tests := []struct {
+		name   string
+		key    *flowmon.FlowKey
+		fields []string
+		flow   string
+	}{
+		{
+			name:   "all fields",
+			key:    tcp,
+			fields: []string{"InIf", "SrcMac", "Etype", "SrcAddr", "DstAddr", "Proto", "SrcPort", "DstPort"},
+			flow:   "in_port=3,dl_src=0a:58:0a:f4:00:05,dl_type=0x0800,nw_src=10.244.0.5,nw_dst=10.96.0.1,nw_proto=6,tp_src=34567,tp_dst=443",
+		},
+		{
+			name:   "no fields",
+			key:    tcp,
+			fields: []string{},
+			flow:   "",
+		},
+		{
+			name:   "L3 field without Etype",
+			key:    tcp,
+			fields: []string{"DstAddr"},
+			flow:   "dl_type=0x0800,nw_dst=10.96.0.1",
+		},
+		{
+			name:   "L4 field without Etype and Proto",
+			key:    tcp,
+			fields: []string{"DstPort"},
+			flow:   "dl_type=0x0800,nw_proto=6,tp_dst=443",
+		},
+		{
+			name:   "Proto without Etype",
+			key:    tcp,
+			fields: []string{"Proto"},
+			flow:   "dl_type=0x0800,nw_proto=6",
+		},
+		{
+			name:   "SCTP over IPv6",
+			key:    sctp,
+			fields: []string{"SrcAddr", "SrcPort", "DstPort"},
+			flow:   "dl_type=0x86dd,ipv6_src=fd00::5,nw_proto=132,tp_src=36412,tp_dst=38412",
+		},
+		{
+			name:   "ICMP type",
+			key:    icmp,
+			fields: []string{"ICMPType"},
+			flow:   "dl_type=0x0800,nw_proto=1,icmp_type=8",
+		},
+		{
+			name:   "ports of ICMP flow",
+			key:    icmp,
+			fields: []string{"SrcPort", "DstPort"},
+			flow:   "",
+		},
+		{
+			name:   "non-IP",
+			key:    arp,
+			fields: []string{"SrcMac", "Etype", "SrcAddr"},
+			flow:   "dl_src=0a:58:0a:f4:00:05,dl_type=0x0806",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if flow := OFProtoTraceFlow(tt.key, tt.fields); flow != tt.flow {
+				t.Errorf("OFProtoTraceFlow() = %q, want %q", flow, tt.flow)
+			}
+		})
+	}
+}
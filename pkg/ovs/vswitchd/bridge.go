@@ -0,0 +1,15 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package vswitchd
+
+// Bridge defines an object in Bridge table
+type Bridge struct {
+	UUID    string            `ovsdb:"_uuid"`
+	IPFIX   *string           `ovsdb:"ipfix"`
+	Name    string            `ovsdb:"name"`
+	Netflow *string           `ovsdb:"netflow"`
+	Ports   []string          `ovsdb:"ports"`
+	Sflow   *string           `ovsdb:"sflow"`
+	Status  map[string]string `ovsdb:"status"`
+}
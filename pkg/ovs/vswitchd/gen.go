@@ -0,0 +1,7 @@
+// Package vswitchd contains the libovsdb models of the Open_vSwitch tables used by
+// ovs-flowmon. vswitch.ovsschema is generated from the upstream schema of the release
+// pinned in hack/update-schemas.sh and keeps only the tables and columns listed in
+// vswitch.tables: do not edit it, list the columns there and run make update-schemas.
+package vswitchd
+
+//go:generate go run github.com/ovn-org/libovsdb/cmd/modelgen -p vswitchd -o . vswitch.ovsschema
@@ -0,0 +1,25 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package vswitchd
+
+type (
+	InterfaceLinkState = string
+)
+
+var (
+	InterfaceLinkStateUp   InterfaceLinkState = "up"
+	InterfaceLinkStateDown InterfaceLinkState = "down"
+)
+
+// Interface defines an object in Interface table
+type Interface struct {
+	UUID        string              `ovsdb:"_uuid"`
+	ExternalIDs map[string]string   `ovsdb:"external_ids"`
+	LinkState   *InterfaceLinkState `ovsdb:"link_state"`
+	Name        string              `ovsdb:"name"`
+	Ofport      *int                `ovsdb:"ofport"`
+	Options     map[string]string   `ovsdb:"options"`
+	Statistics  map[string]int      `ovsdb:"statistics"`
+	Type        string              `ovsdb:"type"`
+}
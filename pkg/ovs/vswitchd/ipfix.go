@@ -0,0 +1,17 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package vswitchd
+
+// IPFIX defines an object in IPFIX table
+type IPFIX struct {
+	UUID               string            `ovsdb:"_uuid"`
+	CacheActiveTimeout *int              `ovsdb:"cache_active_timeout"`
+	CacheMaxFlows      *int              `ovsdb:"cache_max_flows"`
+	ExternalIDs        map[string]string `ovsdb:"external_ids"`
+	ObsDomainID        *int              `ovsdb:"obs_domain_id"`
+	ObsPointID         *int              `ovsdb:"obs_point_id"`
+	OtherConfig        map[string]string `ovsdb:"other_config"`
+	Sampling           *int              `ovsdb:"sampling"`
+	Targets            []string          `ovsdb:"targets"`
+}
@@ -0,0 +1,11 @@
+// Code generated by "libovsdb.modelgen"
+// DO NOT EDIT.
+
+package vswitchd
+
+// Port defines an object in Port table
+type Port struct {
+	UUID       string   `ovsdb:"_uuid"`
+	Interfaces []string `ovsdb:"interfaces"`
+	Name       string   `ovsdb:"name"`
+}
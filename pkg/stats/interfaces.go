@@ -0,0 +1,268 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// InterfaceStats holds the statistics of a network interface.
+type InterfaceStats struct {
+	Chassis   string
+	Bridge    string
+	Name      string
+	Type      string
+	LinkState string
+
+	// Counters
+	RxPackets int64
+	TxPackets int64
+	RxBytes   int64
+	TxBytes   int64
+	RxDropped int64
+	TxDropped int64
+	RxErrors  int64
+	TxErrors  int64
+
+	// Rates computed from the last two updates
+	RxPps float64
+	TxPps float64
+	RxBps float64
+	TxBps float64
+
+	// Whether drop or error counters increased in the last update
+	DropsIncreasing  bool
+	ErrorsIncreasing bool
+}
+
+// InterfaceStatsBackend is the interface that must be implemented to consume
+// per-interface statistics.
+type InterfaceStatsBackend interface {
+	// UpdateInterface adds or updates the statistics of the interface identified by key.
+	UpdateInterface(key string, stats *InterfaceStats)
+	// RemoveInterface removes the interface identified by key.
+	RemoveInterface(key string)
+	Draw()
+}
+
+// interfaceColumn defines how a column of the InterfaceStatsView is printed and sorted.
+type interfaceColumn struct {
+	name  string
+	value func(s *InterfaceStats) string
+	less  func(one, other *InterfaceStats) bool
+}
+
+func counterColumn(name string, get func(s *InterfaceStats) int64) interfaceColumn {
+	return interfaceColumn{
+		name:  name,
+		value: func(s *InterfaceStats) string { return fmt.Sprintf("%d", get(s)) },
+		less:  func(one, other *InterfaceStats) bool { return get(one) < get(other) },
+	}
+}
+
+func rateColumn(name string, get func(s *InterfaceStats) float64) interfaceColumn {
+	return interfaceColumn{
+		name:  name,
+		value: func(s *InterfaceStats) string { return fmt.Sprintf("%.1f", get(s)) },
+		less:  func(one, other *InterfaceStats) bool { return get(one) < get(other) },
+	}
+}
+
+func stringColumn(name string, get func(s *InterfaceStats) string) interfaceColumn {
+	return interfaceColumn{
+		name:  name,
+		value: get,
+		less:  func(one, other *InterfaceStats) bool { return get(one) < get(other) },
+	}
+}
+
+var interfaceColumns = []interfaceColumn{
+	stringColumn("Chassis", func(s *InterfaceStats) string { return s.Chassis }),
+	stringColumn("Bridge", func(s *InterfaceStats) string { return s.Bridge }),
+	stringColumn("Name", func(s *InterfaceStats) string { return s.Name }),
+	stringColumn("Type", func(s *InterfaceStats) string { return s.Type }),
+	stringColumn("Link", func(s *InterfaceStats) string { return s.LinkState }),
+	rateColumn("Rx(kbps)", func(s *InterfaceStats) float64 { return s.RxBps / 1000 }),
+	rateColumn("Tx(kbps)", func(s *InterfaceStats) float64 { return s.TxBps / 1000 }),
+	rateColumn("Rx(pps)", func(s *InterfaceStats) float64 { return s.RxPps }),
+	rateColumn("Tx(pps)", func(s *InterfaceStats) float64 { return s.TxPps }),
+	counterColumn("RxPackets", func(s *InterfaceStats) int64 { return s.RxPackets }),
+	counterColumn("TxPackets", func(s *InterfaceStats) int64 { return s.TxPackets }),
+	counterColumn("RxBytes", func(s *InterfaceStats) int64 { return s.RxBytes }),
+	counterColumn("TxBytes", func(s *InterfaceStats) int64 { return s.TxBytes }),
+	counterColumn("RxDropped", func(s *InterfaceStats) int64 { return s.RxDropped }),
+	counterColumn("TxDropped", func(s *InterfaceStats) int64 { return s.TxDropped }),
+	counterColumn("RxErrors", func(s *InterfaceStats) int64 { return s.RxErrors }),
+	counterColumn("TxErrors", func(s *InterfaceStats) int64 { return s.TxErrors }),
+}
+
+// InterfaceStatsView implements InterfaceStatsBackend and shows a sortable table of
+// interfaces. Interfaces whose drop or error counters are increasing are highlighted.
+type InterfaceStatsView struct {
+	// mutex protects interfaces
+	mutex      sync.Mutex
+	interfaces map[string]*InterfaceStats
+
+	table *tview.Table
+	app   *tview.Application
+
+	// configuration
+	sortColumn int
+	reverse    bool
+	// bridge is the bridge whose interfaces are shown. Empty means all.
+	bridge string
+	done   func()
+}
+
+// NewInterfaceStatsView returns a new Interface Statistics Viewer
+func NewInterfaceStatsView(app *tview.Application) *InterfaceStatsView {
+	table := tview.NewTable().
+		SetFixed(1, 0).
+		SetSelectable(true, false)
+	table.SetBorder(true).SetBorderPadding(1, 1, 2, 0)
+	isv := &InterfaceStatsView{
+		interfaces: make(map[string]*InterfaceStats),
+		table:      table,
+		app:        app,
+		sortColumn: 2,
+	}
+	table.SetInputCapture(isv.handleKey)
+	isv.updateTitle()
+	return isv
+}
+
+// View returns the main primitive
+func (s *InterfaceStatsView) View() tview.Primitive {
+	return s.table
+}
+
+// SetDoneFunc sets the callback that is called when the user leaves the view.
+func (s *InterfaceStatsView) SetDoneFunc(fn func()) *InterfaceStatsView {
+	s.done = fn
+	return s
+}
+
+// UpdateInterface adds or updates the statistics of an interface
+// Caller must call Draw() after all interfaces have been updated
+func (s *InterfaceStatsView) UpdateInterface(key string, stats *InterfaceStats) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.interfaces[key] = stats
+}
+
+// RemoveInterface removes an interface
+// Caller must call Draw() after all interfaces have been updated
+func (s *InterfaceStatsView) RemoveInterface(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.interfaces, key)
+}
+
+func (s *InterfaceStatsView) Draw() {
+	go s.app.QueueUpdateDraw(s.refresh)
+}
+
+// handleKey handles the keyboard shortcuts:
+//
+//	s: sort by next column
+//	r: reverse sort order
+//	b: show next bridge
+//	Esc: leave the view
+func (s *InterfaceStatsView) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	switch {
+	case event.Key() == tcell.KeyEscape:
+		if s.done != nil {
+			s.done()
+		}
+		return nil
+	case event.Rune() == 's':
+		s.sortColumn = (s.sortColumn + 1) % len(interfaceColumns)
+	case event.Rune() == 'r':
+		s.reverse = !s.reverse
+	case event.Rune() == 'b':
+		s.nextBridge()
+	default:
+		return event
+	}
+	s.updateTitle()
+	s.refresh()
+	return nil
+}
+
+// nextBridge selects the next bridge to show. Showing all bridges is part of the cycle.
+func (s *InterfaceStatsView) nextBridge() {
+	s.mutex.Lock()
+	bridgeMap := map[string]bool{}
+	for _, iface := range s.interfaces {
+		bridgeMap[iface.Bridge] = true
+	}
+	s.mutex.Unlock()
+	bridges := []string{""}
+	for bridge := range bridgeMap {
+		bridges = append(bridges, bridge)
+	}
+	sort.Strings(bridges)
+	for i, bridge := range bridges {
+		if bridge == s.bridge {
+			s.bridge = bridges[(i+1)%len(bridges)]
+			return
+		}
+	}
+	s.bridge = ""
+}
+
+func (s *InterfaceStatsView) updateTitle() {
+	bridge := s.bridge
+	if bridge == "" {
+		bridge = "all"
+	}
+	order := "asc"
+	if s.reverse {
+		order = "desc"
+	}
+	s.table.SetTitle(fmt.Sprintf("Interfaces (bridge: %s, sort: %s %s) [s: sort, r: reverse, b: bridge, Esc: back]",
+		bridge, interfaceColumns[s.sortColumn].name, order))
+}
+
+func (s *InterfaceStatsView) refresh() {
+	s.mutex.Lock()
+	ifaces := make([]*InterfaceStats, 0, len(s.interfaces))
+	for _, iface := range s.interfaces {
+		if s.bridge != "" && iface.Bridge != s.bridge {
+			continue
+		}
+		ifaces = append(ifaces, iface)
+	}
+	s.mutex.Unlock()
+
+	column := interfaceColumns[s.sortColumn]
+	sort.SliceStable(ifaces, func(i, j int) bool {
+		if s.reverse {
+			return column.less(ifaces[j], ifaces[i])
+		}
+		return column.less(ifaces[i], ifaces[j])
+	})
+
+	s.table.Clear()
+	for col, column := range interfaceColumns {
+		color := tcell.ColorWhite
+		if col == s.sortColumn {
+			color = tcell.ColorYellow
+		}
+		s.table.SetCell(0, col, tview.NewTableCell(column.name).
+			SetTextColor(color).
+			SetSelectable(false))
+	}
+	for row, iface := range ifaces {
+		color := tcell.ColorWhite
+		if iface.DropsIncreasing || iface.ErrorsIncreasing {
+			color = tcell.ColorRed
+		}
+		for col, column := range interfaceColumns {
+			s.table.SetCell(1+row, col, tview.NewTableCell(column.value(iface)).SetTextColor(color))
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package unixctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTimeout is the default timeout of unixctl commands.
+	DefaultTimeout = 10 * time.Second
+)
+
+// request is a unixctl JSON-RPC request.
+type request struct {
+	ID     int      `json:"id"`
+	Method string   `json:"method"`
+	Params []string `json:"params"`
+}
+
+// response is a unixctl JSON-RPC response.
+type response struct {
+	ID     int             `json:"id"`
+	Result *string         `json:"result"`
+	Error  json.RawMessage `json:"error"`
+}
+
+// Client is a client of an OVS daemon's unixctl control socket, i.e. what ovs-appctl uses.
+type Client struct {
+	path    string
+	timeout time.Duration
+	// mutex protects id
+	mutex sync.Mutex
+	id    int
+}
+
+// NewClient returns a client of the unixctl control socket at the given path.
+func NewClient(path string) *Client {
+	return &Client{
+		path:    path,
+		timeout: DefaultTimeout,
+	}
+}
+
+// NewDaemonClient returns a client of the control socket of the given daemon (e.g: "ovs-vswitchd")
+// that runs in rundir. The daemon's pid is read from its pidfile.
+func NewDaemonClient(rundir, daemon string) (*Client, error) {
+	pidfile := filepath.Join(rundir, daemon+".pid")
+	data, err := ioutil.ReadFile(pidfile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read pidfile of %s: %s", daemon, err.Error())
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("Malformed pidfile %s: %s", pidfile, err.Error())
+	}
+	return NewClient(filepath.Join(rundir, fmt.Sprintf("%s.%d.ctl", daemon, pid))), nil
+}
+
+// Path returns the path of the control socket.
+func (c *Client) Path() string {
+	return c.path
+}
+
+// SetTimeout sets the timeout of each command.
+func (c *Client) SetTimeout(timeout time.Duration) *Client {
+	c.timeout = timeout
+	return c
+}
+
+// Call runs a unixctl command and returns its output, e.g: Call("dpctl/show", "-s").
+func (c *Client) Call(command string, args ...string) (string, error) {
+	conn, err := net.DialTimeout("unix", c.path, c.timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return "", err
+	}
+
+	c.mutex.Lock()
+	id := c.id
+	c.id++
+	c.mutex.Unlock()
+
+	if args == nil {
+		args = []string{}
+	}
+	if err := json.NewEncoder(conn).Encode(&request{
+		ID:     id,
+		Method: command,
+		Params: args,
+	}); err != nil {
+		return "", err
+	}
+
+	var resp response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return "", fmt.Errorf("Failed to decode %s response: %s", command, err.Error())
+	}
+	if resp.ID != id {
+		return "", fmt.Errorf("Unexpected %s response id %d (expected %d)", command, resp.ID, id)
+	}
+	if len(resp.Error) != 0 && string(resp.Error) != "null" {
+		var errStr string
+		if err := json.Unmarshal(resp.Error, &errStr); err != nil {
+			errStr = string(resp.Error)
+		}
+		return "", fmt.Errorf("%s failed: %s", command, strings.TrimSpace(errStr))
+	}
+	if resp.Result == nil {
+		return "", nil
+	}
+	return *resp.Result, nil
+}
@@ -0,0 +1,99 @@
+package unixctl
+
+import (
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// serve answers every request received on a unix socket with the reply built for it and
+// returns the socket's path.
+func serve(t *testing.T, reply func(req *request) string) string {
+	path := filepath.Join(t.TempDir(), "test.ctl")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var req request
+			if err := json.NewDecoder(conn).Decode(&req); err == nil {
+				conn.Write([]byte(reply(&req)))
+			}
+			conn.Close()
+		}
+	}()
+	return path
+}
+
+func TestCall(t *testing.T) {
+	tests := []struct {
+		name   string
+		reply  func(req *request) string
+		result string
+		ok     bool
+	}{
+		{
+			name: "result",
+			reply: func(req *request) string {
+				return `{"id":` + strconv.Itoa(req.ID) + `,"result":"` + req.Method + ` ` + req.Params[0] + `\n","error":null}`
+			},
+			result: "dpctl/dump-flows --no-names\n",
+			ok:     true,
+		},
+		{
+			name: "null result",
+			reply: func(req *request) string {
+				return `{"id":` + strconv.Itoa(req.ID) + `,"result":null,"error":null}`
+			},
+			ok: true,
+		},
+		{
+			name: "error",
+			reply: func(req *request) string {
+				return `{"id":` + strconv.Itoa(req.ID) + `,"result":null,"error":"\"dpctl/dump-flows\" command takes at most 2 arguments\n"}`
+			},
+		},
+		{
+			name: "unexpected id",
+			reply: func(req *request) string {
+				return `{"id":` + strconv.Itoa(req.ID+1) + `,"result":"","error":null}`
+			},
+		},
+		{
+			name:  "malformed",
+			reply: func(req *request) string { return `{"id":` },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(serve(t, tt.reply)).SetTimeout(time.Second)
+			result, err := c.Call("dpctl/dump-flows", "--no-names")
+			if tt.ok != (err == nil) {
+				t.Fatalf("Call() error = %v, want ok %v", err, tt.ok)
+			}
+			if result != tt.result {
+				t.Errorf("Call() = %q, want %q", result, tt.result)
+			}
+		})
+	}
+}
+
+func TestCallNoParams(t *testing.T) {
+	c := NewClient(serve(t, func(req *request) string {
+		params, _ := json.Marshal(req.Params)
+		return `{"id":` + strconv.Itoa(req.ID) + `,"result":` + strconv.Quote(string(params)) + `,"error":null}`
+	}))
+	// ovs-vswitchd rejects requests whose params are not an array.
+	if result, err := c.Call("version"); err != nil || result != "[]" {
+		t.Errorf("Call() = %q, %v, want []", result, err)
+	}
+}
@@ -0,0 +1,178 @@
+package view
+
+import (
+	"amorenoz/ovs-flowmon/pkg/flowmon"
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const (
+	// FlowDetailsPage shows the details of the selected flow aggregate.
+	FlowDetailsPage PageName = "details"
+	// FlowActionPage shows the output of an action run on the selected flow aggregate.
+	FlowActionPage PageName = "action"
+)
+
+// FlowDetailFunc returns additional information about a flow aggregate to be shown
+// in the details page. It is called outside of the UI goroutine so it can block. The
+// aggregate is a copy that is not updated as new flows arrive.
+type FlowDetailFunc func(agg *flowmon.FlowAggregate) (string, error)
+
+type flowDetail struct {
+	title string
+	fn    FlowDetailFunc
+}
+
+type flowAction struct {
+	name string
+	key  rune
+	fn   FlowDetailFunc
+}
+
+// AddFlowAction registers an action that can be run on the selected flow aggregate by
+// pressing the given key in the flow table. Its output is shown in a scrollable page.
+// Must be called before Run().
+func (m *App) AddFlowAction(name string, key rune, fn FlowDetailFunc) *App {
+	m.flowActions = append(m.flowActions, flowAction{
+		name: name,
+		key:  key,
+		fn:   fn,
+	})
+	return m
+}
+
+// AddFlowDetail registers a function that provides additional information about the
+// selected flow aggregate. Must be called before Run().
+func (m *App) AddFlowDetail(title string, fn FlowDetailFunc) *App {
+	m.flowDetails = append(m.flowDetails, flowDetail{
+		title: title,
+		fn:    fn,
+	})
+	return m
+}
+
+func (m *App) buildDetailsPage() {
+	m.details = tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true).
+		SetWrap(false)
+	m.details.SetBorder(true).SetBorderPadding(1, 1, 2, 0).SetTitle("Flow details [Esc: back]")
+	m.details.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEscape {
+			m.ShowPage(MainPage)
+			m.app.SetFocus(m.flowTable.View)
+		}
+	})
+	m.AddPage(FlowDetailsPage, m.details, true, false)
+
+	m.actionOutput = tview.NewTextView().
+		SetScrollable(true).
+		SetWrap(false)
+	m.actionOutput.SetBorder(true).SetBorderPadding(1, 1, 2, 0)
+	m.actionOutput.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEscape {
+			m.ShowPage(MainPage)
+			m.app.SetFocus(m.flowTable.View)
+		}
+	})
+	m.AddPage(FlowActionPage, m.actionOutput, true, false)
+
+	if len(m.flowActions) > 0 {
+		help := []string{"Enter: details"}
+		for _, action := range m.flowActions {
+			help = append(help, fmt.Sprintf("%c: %s", action.key, action.name))
+		}
+		m.flowsHelp = strings.Join(help, ", ")
+		m.updateFlowsTitle()
+		m.flowTable.View.SetInputCapture(m.handleFlowAction)
+	}
+}
+
+// handleFlowAction runs the flow action associated with the pressed key (if any) on the
+// selected row.
+func (m *App) handleFlowAction(event *tcell.EventKey) *tcell.EventKey {
+	if m.flowTable.mode != ModeRows {
+		return event
+	}
+	for _, action := range m.flowActions {
+		if event.Rune() != action.key {
+			continue
+		}
+		row, _ := m.flowTable.View.GetSelection()
+		agg := m.flowTable.GetAggregate(row - 1)
+		if agg == nil {
+			return nil
+		}
+		m.actionOutput.SetTitle(fmt.Sprintf("%s [Esc: back]", action.name))
+		m.actionOutput.SetText("Running...").ScrollToBeginning()
+		m.ShowPage(FlowActionPage)
+		m.app.SetFocus(m.actionOutput)
+		go func(action flowAction) {
+			output, err := action.fn(agg)
+			if err != nil {
+				output = fmt.Sprintf("Error: %s", err.Error())
+			}
+			m.app.QueueUpdateDraw(func() {
+				m.actionOutput.SetText(output).ScrollToBeginning()
+			})
+		}(action)
+		return nil
+	}
+	return event
+}
+
+// showDetails shows the details page of the aggregate in the given row of the flow table.
+func (m *App) showDetails(row, col int) {
+	agg := m.flowTable.GetAggregate(row - 1)
+	if agg == nil {
+		m.app.SetFocus(m.menu)
+		return
+	}
+	m.details.SetText(describeAggregate(agg)).ScrollToBeginning()
+	m.ShowPage(FlowDetailsPage)
+	m.app.SetFocus(m.details)
+
+	for _, detail := range m.flowDetails {
+		go func(detail flowDetail) {
+			var text string
+			content, err := detail.fn(agg)
+			if err != nil {
+				text = fmt.Sprintf("\n[yellow]%s[white]\n  Error: %s\n", detail.title, tview.Escape(err.Error()))
+			} else {
+				text = fmt.Sprintf("\n[yellow]%s[white]\n%s\n", detail.title, tview.Escape(content))
+			}
+			m.app.QueueUpdateDraw(func() {
+				fmt.Fprint(m.details, text)
+			})
+		}(detail)
+	}
+}
+
+// describeAggregate returns a textual representation of the aggregate's keys and counters.
+func describeAggregate(agg *flowmon.FlowAggregate) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[yellow]Flow Key[white]\n")
+	for _, key := range agg.Keys {
+		value, err := agg.GetFieldString(key)
+		if err != nil {
+			value = "err"
+		}
+		if value == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "  %-16s %s\n", key+":", tview.Escape(value))
+	}
+	fmt.Fprintf(&b, "\n[yellow]Counters[white]\n")
+	fmt.Fprintf(&b, "  %-16s %d\n", "Flows:", len(agg.Flows))
+	fmt.Fprintf(&b, "  %-16s %d\n", "TotalBytes:", int(agg.TotalBytes))
+	fmt.Fprintf(&b, "  %-16s %d\n", "TotalPackets:", int(agg.TotalPackets))
+	if agg.Estimated() {
+		fmt.Fprintf(&b, "  %-16s %d\n", "SampledBytes:", int(agg.SampledBytes))
+		fmt.Fprintf(&b, "  %-16s %d\n", "SampledPackets:", int(agg.SampledPackets))
+	}
+	fmt.Fprintf(&b, "  %-16s %.1f\n", "Rate(kbps):", float64(agg.LastBps)/1000)
+	return b.String()
+}
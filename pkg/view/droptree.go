@@ -0,0 +1,304 @@
+package view
+
+import (
+	"amorenoz/ovs-flowmon/pkg/flowmon"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	flowmessage "github.com/netsampler/goflow2/pb"
+	"github.com/rivo/tview"
+)
+
+// DropTreePage is the page that shows the OVN drop summary.
+const DropTreePage PageName = "drops"
+
+// dropTreeRedrawInterval is how often the drop summary is redrawn if it changed.
+const dropTreeRedrawInterval = 500 * time.Millisecond
+
+// dropNode is a node of the drop summary. Its counters include the ones of all its
+// children.
+type dropNode struct {
+	label    string
+	children map[string]*dropNode
+	node     *tview.TreeNode
+	// sorted are the children in the order they were last added to node.
+	sorted []*dropNode
+	// changed is set when the counters or children changed since the last refresh.
+	changed bool
+
+	packets           float64
+	bytes             float64
+	firstTimeReceived uint64
+	lastTimeReceived  uint64
+}
+
+func newDropNode(label string) *dropNode {
+	n := &dropNode{
+		label:    label,
+		children: make(map[string]*dropNode),
+		node:     tview.NewTreeNode(label).SetExpanded(false).SetSelectable(true),
+		changed:  true,
+	}
+	n.node.SetReference(n)
+	return n
+}
+
+func (n *dropNode) add(flowInfo *flowmon.FlowInfo) {
+	rate := flowInfo.SamplingRate
+	if rate < 1 {
+		rate = 1
+	}
+	n.packets += float64(flowInfo.Packets) * rate
+	n.bytes += float64(flowInfo.Bytes) * rate
+	if n.firstTimeReceived == 0 {
+		n.firstTimeReceived = uint64(flowInfo.TimeReceived)
+	}
+	n.lastTimeReceived = uint64(flowInfo.TimeReceived)
+	n.changed = true
+}
+
+// child returns the child with the given label, creating it if needed.
+func (n *dropNode) child(label string) *dropNode {
+	c, ok := n.children[label]
+	if !ok {
+		c = newDropNode(label)
+		n.children[label] = c
+	}
+	return c
+}
+
+// pps returns the average packet rate since the first sample was received.
+func (n *dropNode) pps() float64 {
+	if n.lastTimeReceived <= n.firstTimeReceived {
+		return 0
+	}
+	return n.packets / float64(n.lastTimeReceived-n.firstTimeReceived)
+}
+
+// setText updates the text of the node.
+func (n *dropNode) setText() {
+	text := fmt.Sprintf("%s [yellow](packets: %.0f, bytes: %.0f, rate: %.1f pps)[white]",
+		tview.Escape(n.label), n.packets, n.bytes, n.pps())
+	if len(n.children) > 0 {
+		if n.node.IsExpanded() {
+			text = "▾ " + text
+		} else {
+			text = "▸ " + text
+		}
+	}
+	n.node.SetText(text)
+}
+
+// setTextAll updates the text of the node and all its descendants, e.g: after they are
+// expanded or collapsed.
+func (n *dropNode) setTextAll() {
+	n.setText()
+	for _, c := range n.sorted {
+		c.setTextAll()
+	}
+}
+
+// refresh updates the node and the children that changed since the last refresh. Children
+// are sorted by number of packets and only re-added to the tree if their order changed.
+func (n *dropNode) refresh() {
+	if !n.changed {
+		return
+	}
+	n.changed = false
+	n.setText()
+	children := make([]*dropNode, 0, len(n.children))
+	for _, c := range n.children {
+		children = append(children, c)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].packets != children[j].packets {
+			return children[i].packets > children[j].packets
+		}
+		return children[i].label < children[j].label
+	})
+	if !sameDropNodes(children, n.sorted) {
+		n.node.ClearChildren()
+		for _, c := range children {
+			n.node.AddChild(c.node)
+		}
+		n.sorted = children
+	}
+	for _, c := range children {
+		c.refresh()
+	}
+}
+
+func sameDropNodes(a, b []*dropNode) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// DropTree shows the OVN drops grouped hierarchically: datapath, pipeline and stage,
+// logical flow and 5-tuple. Each level shows its packet and byte counters and rate.
+// Redraws are coalesced: Draw only marks the tree dirty and it is redrawn every
+// dropTreeRedrawInterval.
+type DropTree struct {
+	// mutex protects the drop nodes and dirty
+	mutex sync.Mutex
+	root  *dropNode
+	dirty bool
+
+	tree *tview.TreeView
+	app  *tview.Application
+	done func()
+}
+
+// NewDropTree returns a new OVN drop summary. It is redrawn periodically for the lifetime
+// of the application.
+func NewDropTree(app *tview.Application) *DropTree {
+	root := newDropNode("OVN drops")
+	root.node.SetExpanded(true)
+	tree := tview.NewTreeView().SetRoot(root.node).SetCurrentNode(root.node)
+	tree.SetBorder(true).SetBorderPadding(1, 1, 2, 0).
+		SetTitle("OVN drops [Enter: expand/collapse, +: expand all, -: collapse all, Esc: back]")
+	dt := &DropTree{
+		root: root,
+		tree: tree,
+		app:  app,
+	}
+	tree.SetSelectedFunc(func(node *tview.TreeNode) {
+		node.SetExpanded(!node.IsExpanded())
+		dt.mutex.Lock()
+		defer dt.mutex.Unlock()
+		node.GetReference().(*dropNode).setText()
+	})
+	tree.SetInputCapture(dt.handleKey)
+	go dt.redraw()
+	return dt
+}
+
+// View returns the main primitive
+func (dt *DropTree) View() tview.Primitive {
+	return dt.tree
+}
+
+// SetDoneFunc sets the callback that is called when the user leaves the view.
+func (dt *DropTree) SetDoneFunc(fn func()) *DropTree {
+	dt.done = fn
+	return dt
+}
+
+// ProcessMessage adds an OVN drop sample to the tree. Samples that OVNClient.Enrich could
+// not attribute to a datapath are ignored.
+func (dt *DropTree) ProcessMessage(msg *flowmessage.FlowMessage, extra map[string]interface{}) {
+	flowInfo := flowmon.NewFlowInfo(msg, extra)
+	key := flowInfo.Key
+	if key.DPType == "" {
+		return
+	}
+	path := []string{
+		strings.TrimSpace(fmt.Sprintf("%s %s", key.DPType, key.DPName)),
+		dropStage(key),
+		dropLogicalFlow(key),
+		dropFiveTuple(key),
+	}
+
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+	node := dt.root
+	node.add(flowInfo)
+	for _, label := range path {
+		node = node.child(label)
+		node.add(flowInfo)
+	}
+}
+
+// Draw schedules a redraw of the tree.
+func (dt *DropTree) Draw() {
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+	dt.dirty = true
+}
+
+// redraw refreshes the tree every dropTreeRedrawInterval if Draw was called since the
+// last time.
+func (dt *DropTree) redraw() {
+	ticker := time.NewTicker(dropTreeRedrawInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		dt.mutex.Lock()
+		dirty := dt.dirty
+		dt.dirty = false
+		dt.mutex.Unlock()
+		if dirty {
+			dt.app.QueueUpdateDraw(dt.refresh)
+		}
+	}
+}
+
+func (dt *DropTree) refresh() {
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+	dt.root.refresh()
+}
+
+// handleKey handles the keyboard shortcuts:
+//
+//	+: expand all
+//	-: collapse all
+//	Esc: leave the view
+func (dt *DropTree) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	switch {
+	case event.Key() == tcell.KeyEscape:
+		if dt.done != nil {
+			dt.done()
+		}
+		return nil
+	case event.Rune() == '+':
+		dt.root.node.ExpandAll()
+	case event.Rune() == '-':
+		dt.root.node.CollapseAll()
+		dt.root.node.SetExpanded(true)
+	default:
+		return event
+	}
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+	dt.root.setTextAll()
+	return nil
+}
+
+func dropStage(key *flowmon.FlowKey) string {
+	if key.LFPipeline == "" && key.LFStage == "" {
+		if key.OFTableName != "" {
+			return key.OFTableName
+		}
+		return fmt.Sprintf("table %d", key.OFTable)
+	}
+	return fmt.Sprintf("%s/%s", key.LFPipeline, key.LFStage)
+}
+
+func dropLogicalFlow(key *flowmon.FlowKey) string {
+	if key.LFUUID == "" {
+		return "unknown logical flow"
+	}
+	label := fmt.Sprintf("%s match: %q actions: %q", key.LFUUID, key.LFMatch, key.LFActions)
+	if key.LFAmbiguity != "" {
+		label += fmt.Sprintf(" (%s)", key.LFAmbiguity)
+	}
+	return label
+}
+
+func dropFiveTuple(key *flowmon.FlowKey) string {
+	if key.SrcAddr == nil && key.DstAddr == nil {
+		return fmt.Sprintf("%s %s -> %s", key.Etype, key.SrcMac, key.DstMac)
+	}
+	return fmt.Sprintf("%s %s:%d -> %s:%d", key.Proto,
+		key.SrcAddr, key.SrcPort, key.DstAddr, key.DstPort)
+}
@@ -37,27 +37,92 @@ var fieldList []string = []string{
 	"SvcPort",
 	"FlowDirection"}
 
+var chassisFieldList []string = []string{
+	"Chassis",
+}
+
+var interfaceFieldList []string = []string{
+	"InIfName",
+	"InIfType",
+	"InIfaceID",
+	"InAttachedMac",
+	"InVMID",
+	"OutIfName",
+	"OutIfType",
+	"OutIfaceID",
+	"OutAttachedMac",
+	"OutVMID",
+}
+
 var ovnFieldList []string = []string{
 	"LFUUID",
 	"LFMatch",
 	"LFActions",
 	"LFPipeline",
 	"LFStage",
+	"LFAmbiguity",
+	"NBDescription",
 	"DPType",
 	"DPName",
 	"OFTable",
+	"OFTableName",
+	"OFTableDesc",
+	"SrcLPort",
+	"SrcLPortType",
+	"SrcLPortChassis",
+	"SrcLPortExtIDs",
+	"DstLPort",
+	"DstLPortType",
+	"DstLPortChassis",
+	"DstLPortExtIDs",
+}
+
+var aclSamplingFieldList []string = []string{
+	"ACLName",
+	"ACLAction",
+	"ACLSample",
+	"NBDescription",
+}
+
+var tunnelFieldList []string = []string{
+	"TunnelType",
+	"TunnelKey",
+	"TunnelSrc",
+	"TunnelDst",
+	"TunnelSrcPort",
+	"TunnelDstPort",
+	"VirtualObsID",
+}
+
+var tunnelChassisFieldList []string = []string{
+	"SrcChassis",
+	"DstChassis",
+}
+
+var podFieldList []string = []string{
+	"SrcPod",
+	"SrcNamespace",
+	"SrcNode",
+	"DstPod",
+	"DstNamespace",
+	"DstNode",
 }
 
 // FlowConsumer implementes the netflow.Consumer interface and adds the flowmessages
-// to a FlowTable
+// to a FlowTable and, optionally, to a DropTree
 type FlowConsumer struct {
 	FlowTable *FlowTable
+	DropTree  *DropTree
 	App       *tview.Application
 }
 
 // Consume adds the flowmessage to the FlowTable
 func (fc *FlowConsumer) Consume(msg *flowmessage.FlowMessage, extra map[string]interface{}, log *logrus.Logger) {
 	fc.FlowTable.ProcessMessage(msg, extra)
+	if fc.DropTree != nil {
+		fc.DropTree.ProcessMessage(msg, extra)
+		fc.DropTree.Draw()
+	}
 	fc.App.QueueUpdateDraw(func() {
 		fc.FlowTable.Draw()
 	})
@@ -81,6 +146,9 @@ type FlowTable struct {
 	aggregateKeyMap  map[string]bool
 	keys             []string
 	mode             SelectMode
+	// filters maps field names to the string representation of the value
+	// flows must have to be shown
+	filters map[string]string
 
 	// Stats
 	nMessages int
@@ -102,6 +170,7 @@ func NewFlowTable() *FlowTable {
 		aggregateKeyList: nil,
 		aggregateKeyMap:  nil,
 		keys:             fields,
+		filters:          make(map[string]string),
 		lessFunc: func(one, other *flowmon.FlowAggregate) bool {
 			return one.LastTimeReceived < other.LastTimeReceived
 		},
@@ -128,6 +197,148 @@ func (ft *FlowTable) SetOVN(ovn bool) *FlowTable {
 	return ft
 }
 
+// SetChassis adds the Chassis field in front of the rest of fields. Useful when
+// flows from several exporters are collected.
+func (ft *FlowTable) SetChassis(chassis bool) *FlowTable {
+	if chassis {
+		ft.keys = append(append([]string{}, chassisFieldList...), ft.keys...)
+	}
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+	ft.updateFieldsLocked()
+	return ft
+}
+
+// SetInterfaces adds the OVS Interface fields.
+func (ft *FlowTable) SetInterfaces(interfaces bool) *FlowTable {
+	if interfaces {
+		ft.keys = append(ft.keys, interfaceFieldList...)
+	}
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+	ft.updateFieldsLocked()
+	return ft
+}
+
+// SetACLSampling adds the OVN ACL sampling fields.
+func (ft *FlowTable) SetACLSampling(acls bool) *FlowTable {
+	if acls {
+		ft.keys = append(ft.keys, aclSamplingFieldList...)
+	}
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+	ft.updateFieldsLocked()
+	return ft
+}
+
+// SetTunnels adds the tunnel fields exported by OVS.
+func (ft *FlowTable) SetTunnels(tunnels bool) *FlowTable {
+	if tunnels {
+		ft.keys = append(ft.keys, tunnelFieldList...)
+	}
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+	ft.updateFieldsLocked()
+	return ft
+}
+
+// SetTunnelChassis adds the fields of the chassis flows are tunneled from and to.
+func (ft *FlowTable) SetTunnelChassis(chassis bool) *FlowTable {
+	if chassis {
+		ft.keys = append(ft.keys, tunnelChassisFieldList...)
+	}
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+	ft.updateFieldsLocked()
+	return ft
+}
+
+// SetCustomFields adds the fields decoded with a user-defined mapping.
+func (ft *FlowTable) SetCustomFields(fields []string) *FlowTable {
+	ft.keys = append(ft.keys, fields...)
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+	ft.updateFieldsLocked()
+	return ft
+}
+
+// SetPods adds the OVN-Kubernetes pod fields.
+func (ft *FlowTable) SetPods(pods bool) *FlowTable {
+	if pods {
+		ft.keys = append(ft.keys, podFieldList...)
+	}
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+	ft.updateFieldsLocked()
+	return ft
+}
+
+// Keys returns the list of fields of the flow table.
+func (ft *FlowTable) Keys() []string {
+	return ft.keys
+}
+
+// Filters returns a copy of the currently configured filters.
+func (ft *FlowTable) Filters() map[string]string {
+	ft.mutex.RLock()
+	defer ft.mutex.RUnlock()
+	filters := make(map[string]string, len(ft.filters))
+	for k, v := range ft.filters {
+		filters[k] = v
+	}
+	return filters
+}
+
+// SetFilter only shows flows whose field has the given value. An empty value
+// removes the filter on that field.
+func (ft *FlowTable) SetFilter(key, value string) error {
+	found := false
+	for _, k := range ft.keys {
+		if k == key {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("Cannot filter by %s", key)
+	}
+	ft.mutex.Lock()
+	if value == "" {
+		delete(ft.filters, key)
+	} else {
+		ft.filters[key] = value
+	}
+	ft.recompute()
+	ft.mutex.Unlock()
+
+	ft.View.Clear()
+	ft.Draw()
+	return nil
+}
+
+// ClearFilters removes all filters.
+func (ft *FlowTable) ClearFilters() {
+	ft.mutex.Lock()
+	ft.filters = make(map[string]string)
+	ft.recompute()
+	ft.mutex.Unlock()
+
+	ft.View.Clear()
+	ft.Draw()
+}
+
+// GetAggregate returns a copy of the aggregate at the given index (i.e: row - 1) or nil
+// if it does not exist. The copy can be read without holding the FlowTable's lock, e.g:
+// by FlowDetailFuncs.
+func (ft *FlowTable) GetAggregate(index int) *flowmon.FlowAggregate {
+	ft.mutex.RLock()
+	defer ft.mutex.RUnlock()
+	if index < 0 || index >= len(ft.aggregates) {
+		return nil
+	}
+	return ft.aggregates[index].Copy()
+}
+
 func (ft *FlowTable) GetAggregates() map[string]bool {
 	return ft.aggregateKeyMap
 }
@@ -267,6 +478,9 @@ func (ft *FlowTable) ProcessMessage(msg *flowmessage.FlowMessage, extra map[stri
 func (ft *FlowTable) ProcessFlow(flowInfo *flowmon.FlowInfo) {
 	var matched bool = false
 	var err error = nil
+	if !ft.passesFilters(flowInfo) {
+		return
+	}
 	for i, agg := range ft.aggregates {
 		matched, err = agg.AppendIfMatches(flowInfo)
 		if err != nil {
@@ -292,6 +506,18 @@ func (ft *FlowTable) ProcessFlow(flowInfo *flowmon.FlowInfo) {
 	}
 }
 
+// passesFilters returns whether the flow matches all the filters.
+// Caller must hold mutex
+func (ft *FlowTable) passesFilters(flowInfo *flowmon.FlowInfo) bool {
+	for key, value := range ft.filters {
+		fieldStr, err := flowInfo.Key.GetFieldString(key)
+		if err != nil || fieldStr != value {
+			return false
+		}
+	}
+	return true
+}
+
 // SetSortingKey sets the field that will be used for sorting the aggregates
 func (ft *FlowTable) SetSortingColumn(index int) error {
 	colName := ft.View.GetCell(0, index).Text
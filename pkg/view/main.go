@@ -2,6 +2,14 @@ package view
 
 import (
 	"amorenoz/ovs-flowmon/pkg/stats"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
@@ -17,6 +25,10 @@ const (
 	// WelcomePage is the first page that is shown with a welcome message. After pressing any key, this page
 	// is hidden and is never shown again.
 	Welcome PageName = "welcome"
+	// FilterPage is the page that allows the user to filter the flows by field values.
+	FilterPage PageName = "filter"
+	// NotificationPage is a modal that shows a message until the user dismisses it.
+	NotificationPage PageName = "notification"
 )
 
 // App represents the main FlowMonitoring Application
@@ -30,10 +42,25 @@ type App struct {
 	stats     *stats.StatsView
 	status    *tview.TextView
 	menu      *tview.List
+	details   *tview.TextView
+	// actionOutput shows the output of flow actions
+	actionOutput *tview.TextView
 
 	// Callbacks
 	extraMenu func(menu *tview.List, log *logrus.Logger) error
 	onExit    func()
+	// exitOnce makes sure onExit is only called once however the application exits.
+	exitOnce sync.Once
+	// handleExit installs the signal and log.Fatal handlers the first time OnExit is called.
+	handleExit sync.Once
+	// running is set (atomically) while the tview application runs.
+	running int32
+
+	// Flow details providers and actions
+	flowDetails []flowDetail
+	flowActions []flowAction
+	// flowsHelp lists the keys available in the flow table
+	flowsHelp string
 }
 
 // App() returns the underlying tview Application.
@@ -53,12 +80,37 @@ func (m *App) Stats() *stats.StatsView {
 }
 
 // OnExit configures the OnExit callback.
-// This callback will be called just before the application exits.
+// This callback will be called just before the application exits, be it because the
+// user exits, the process receives SIGINT or SIGTERM or log.Fatal is called. It is
+// only called once.
 func (m *App) OnExit(fn func()) *App {
 	m.onExit = fn
+	m.handleExit.Do(func() {
+		logrus.RegisterExitHandler(m.runOnExit)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			sig := <-signals
+			m.log.Infof("Received %s", sig)
+			m.exit()
+			if atomic.LoadInt32(&m.running) == 0 {
+				// Run will not return, exit here.
+				os.Exit(1)
+			}
+		}()
+	})
 	return m
 }
 
+// runOnExit calls the OnExit callback if it was not called already.
+func (m *App) runOnExit() {
+	m.exitOnce.Do(func() {
+		if m.onExit != nil {
+			m.onExit()
+		}
+	})
+}
+
 // ExtraMenu configures the ExtraMenu callback.
 // This callback will be when building the application. It allows the user to insert
 // additional elements in the main menu.
@@ -105,6 +157,18 @@ Welcome to OvS Flow Monitor!
 	m.pages.AddPage(Welcome, welcome, true, true)
 }
 
+// Notify shows the message in a modal on top of the current page until the user
+// dismisses it. It can be called from any goroutine.
+func (m *App) Notify(message string) {
+	m.app.QueueUpdateDraw(func() {
+		modal := tview.NewModal().SetText(message).AddButtons([]string{"OK"}).
+			SetDoneFunc(func(index int, label string) {
+				m.pages.RemovePage(NotificationPage)
+			})
+		m.pages.AddPage(NotificationPage, modal, true, true)
+	})
+}
+
 // AddPage adds a new page to the application. The user has to control when the page is shown using
 // ShowPage() and hide it when appropriate.
 func (m *App) AddPage(name PageName, obj tview.Primitive, resize, visible bool) {
@@ -158,6 +222,7 @@ func (m *App) build() error {
 	m.menu.AddItem("Flows", "", 'f', flows).
 		AddItem("Add/Remove Fields from aggregate", "", 'a', m.showAggregate).
 		AddItem("Sort by ", "", 's', m.sortBy).
+		AddItem("Filter flows", "", 'i', m.showFilter).
 		AddItem("Logs", "", 'l', logs).
 		AddItem("Exit", "", 'e', m.exit)
 
@@ -165,9 +230,7 @@ func (m *App) build() error {
 	m.flowTable.View.SetDoneFunc(func(key tcell.Key) {
 		m.app.SetFocus(m.menu)
 	})
-	m.flowTable.View.SetSelectedFunc(func(row, col int) {
-		m.app.SetFocus(m.menu)
-	})
+	m.flowTable.View.SetSelectedFunc(m.showDetails)
 	m.status.SetDoneFunc(func(key tcell.Key) {
 		m.app.SetFocus(m.menu)
 	})
@@ -179,6 +242,8 @@ func (m *App) build() error {
 	flex := tview.NewFlex().SetDirection(tview.FlexRow).AddItem(topBar, 0, 2, true).AddItem(m.flowTable.View, 0, 5, false).AddItem(m.status, 0, 1, false)
 
 	m.pages.AddPage(MainPage, flex, true, false)
+	m.buildFilterPage()
+	m.buildDetailsPage()
 	m.app.SetRoot(m.pages, true).SetFocus(m.pages)
 
 	// Configure Ctr-C callback.
@@ -195,9 +260,7 @@ func (m *App) build() error {
 // Called when the user hits exit on the main menu.
 func (m *App) exit() {
 	m.log.Info("Stopping app")
-	if m.onExit != nil {
-		m.onExit()
-	}
+	m.runOnExit()
 	if m.app != nil {
 		m.app.Stop()
 	}
@@ -212,9 +275,7 @@ func (m *App) showAggregate() {
 	m.flowTable.View.SetSelectedFunc(func(row, col int) {
 		m.flowTable.ToggleAggregate(col)
 		m.flowTable.SetSelectMode(ModeRows)
-		m.flowTable.View.SetSelectedFunc(func(row, col int) {
-			m.app.SetFocus(m.menu)
-		})
+		m.flowTable.View.SetSelectedFunc(m.showDetails)
 		m.app.SetFocus(m.menu)
 	})
 }
@@ -230,19 +291,82 @@ func (m *App) sortBy() {
 			m.log.Error(err)
 		}
 		m.flowTable.SetSelectMode(ModeRows)
-		m.flowTable.View.SetSelectedFunc(func(row, col int) {
-			m.app.SetFocus(m.menu)
-		})
+		m.flowTable.View.SetSelectedFunc(m.showDetails)
 		m.app.SetFocus(m.menu)
 	})
 }
 
+// buildFilterPage builds the page that allows users to add and remove filters.
+func (m *App) buildFilterPage() {
+	keys := m.flowTable.Keys()
+	key := keys[0]
+	value := ""
+	form := tview.NewForm()
+	form.AddDropDown("Field", keys, 0, func(option string, _ int) {
+		key = option
+	}).
+		AddInputField("Value", "", 30, nil, func(text string) {
+			value = text
+		}).
+		AddButton("Apply", func() {
+			if err := m.flowTable.SetFilter(key, value); err != nil {
+				m.log.Error(err)
+			}
+			m.updateFlowsTitle()
+			m.ShowPage(MainPage)
+		}).
+		AddButton("Clear all", func() {
+			m.flowTable.ClearFilters()
+			m.updateFlowsTitle()
+			m.ShowPage(MainPage)
+		}).
+		AddButton("Cancel", func() {
+			m.ShowPage(MainPage)
+		})
+	filterMenu := tview.NewFlex()
+	filterMenu.SetTitle("Filter flows").SetBorder(true)
+	filterMenu.SetDirection(tview.FlexRow).AddItem(tview.NewTextView().SetText(`Only show flows whose field has the given value
+
+Use <Tab> to move around the form
+Press <Apply> to add the filter (an empty value removes it)
+Press <Clear all> to remove all filters
+Press <Cancel> to go back to the main menu
+`), 0, 1, false).
+		AddItem(form, 0, 2, true)
+	m.AddPage(FilterPage, Center(filterMenu, 60, 20), true, false)
+}
+
+// updateFlowsTitle shows the current filters and the available keys in the Flows title.
+func (m *App) updateFlowsTitle() {
+	title := "Flows"
+	filters := m.flowTable.Filters()
+	if len(filters) > 0 {
+		filterStrs := []string{}
+		for k, v := range filters {
+			filterStrs = append(filterStrs, fmt.Sprintf("%s=%s", k, v))
+		}
+		sort.Strings(filterStrs)
+		title += fmt.Sprintf(" (%s)", strings.Join(filterStrs, ", "))
+	}
+	if m.flowsHelp != "" {
+		title += fmt.Sprintf(" [%s]", m.flowsHelp)
+	}
+	m.flowTable.View.SetTitle(title)
+}
+
+// Called when user hits the Filter button.
+func (m *App) showFilter() {
+	m.ShowPage(FilterPage)
+}
+
 // Run the main application
 func (m *App) Run() error {
 	if err := m.build(); err != nil {
 		return err
 	}
 	m.log.SetOutput(TextViewLogWriter(m.status))
+	atomic.StoreInt32(&m.running, 1)
+	defer atomic.StoreInt32(&m.running, 0)
 	if err := m.app.Run(); err != nil {
 		return err
 	}